@@ -5,15 +5,23 @@ import (
 	"fmt"
 	"strings"
 
+	"a-a/internal/actions/archive"
+	"a-a/internal/actions/ask"
+	"a-a/internal/actions/doc"
+	"a-a/internal/actions/feed"
 	"a-a/internal/actions/flow"
+	"a-a/internal/actions/format"
 	"a-a/internal/actions/html"
+	"a-a/internal/actions/json"
 	"a-a/internal/actions/list"
 	"a-a/internal/actions/llm"
 	"a-a/internal/actions/system"
 	"a-a/internal/actions/test"
+	"a-a/internal/actions/text"
 	"a-a/internal/actions/url"
 	"a-a/internal/actions/web"
 	"a-a/internal/parser"
+	"a-a/internal/utils"
 )
 
 func Execute(ctx context.Context, action *parser.Action) (map[string]any, error) {
@@ -40,9 +48,56 @@ func Execute(ctx context.Context, action *parser.Action) (map[string]any, error)
 		return list.HandleListAction(ctx, operation, action.Payload)
 	case "url":
 		return url.HandleURLAction(ctx, operation, action.Payload)
+	case "feed":
+		return feed.HandleFeedAction(ctx, operation, action.Payload)
+	case "json":
+		return json.HandleJSONAction(ctx, operation, action.Payload)
+	case "text":
+		return text.HandleTextAction(ctx, operation, action.Payload)
+	case "format":
+		return format.HandleFormatAction(ctx, operation, action.Payload)
+	case "archive":
+		return archive.HandleArchiveAction(ctx, operation, action.Payload)
+	case "doc":
+		return doc.HandleDocAction(ctx, operation, action.Payload)
+	case "ask":
+		return ask.HandleAskAction(ctx, operation, action.Payload)
 	case "flow":
 		return flow.HandleFlowAction(ctx, operation, action.Payload)
 	default:
 		return nil, fmt.Errorf("unknown action category: %s", category)
 	}
 }
+
+// Simulate reports the side effects action would have without running it.
+// Categories that only transform data report none.
+func Simulate(ctx context.Context, action *parser.Action) ([]utils.Effect, error) {
+	actionParts := strings.Split(action.Action, ".")
+	if len(actionParts) != 2 {
+		return nil, fmt.Errorf("invalid action type format: '%s'", action.Action)
+	}
+
+	category := actionParts[0]
+	operation := actionParts[1]
+
+	switch category {
+	case "system":
+		return system.SimulateSystemAction(ctx, operation, action.Payload)
+	case "web":
+		return web.SimulateWebAction(ctx, operation, action.Payload)
+	case "llm":
+		return llm.SimulateLlmAction(ctx, operation, action.Payload)
+	case "feed":
+		return feed.SimulateFeedAction(ctx, operation, action.Payload)
+	case "archive":
+		return archive.SimulateArchiveAction(ctx, operation, action.Payload)
+	case "doc":
+		return doc.SimulateDocAction(ctx, operation, action.Payload)
+	case "flow":
+		return flow.SimulateFlowAction(ctx, operation, action.Payload)
+	case "test", "html", "list", "url", "json", "text", "format", "ask":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown action category: %s", category)
+	}
+}
@@ -0,0 +1,295 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"a-a/internal/actions/system"
+	"a-a/internal/utils"
+)
+
+func HandleArchiveAction(ctx context.Context, operation string, payload map[string]any) (map[string]any, error) {
+	switch operation {
+	case "zip":
+		return handleCreate(ctx, payload, "zip")
+	case "tar_gz":
+		return handleCreate(ctx, payload, "tar_gz")
+	case "extract":
+		return handleExtract(ctx, payload)
+	default:
+		return nil, fmt.Errorf("unknown archive operation: %s", operation)
+	}
+}
+
+type member struct {
+	src  string // file on disk
+	name string // slash-separated entry name
+}
+
+// Packs files into a .zip or .tar.gz.
+// Required payload:
+//
+//	path:        archive to write (replaced atomically)
+//	inputs_json: array of files, directories (added recursively) or globs
+//	             ("tmp/**/*.json", "out/*.{csv,md}"); a single string also works
+//
+// Optional payload:
+//
+//	base_dir: entry names are relative to this directory (default "."); inputs
+//	          outside it are stored under their base name
+//
+// Output:
+//
+//	{ "path": string, "files": int, "bytes": int64, "entries_json": "<[name]>", "sha256": string }
+func handleCreate(ctx context.Context, payload map[string]any, kind string) (map[string]any, error) {
+	out, err := utils.GetStringPayload(payload, "path")
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := stringList(payload["inputs_json"])
+	if err != nil {
+		return nil, fmt.Errorf("inputs_json: %w", err)
+	}
+	if len(inputs) == 0 {
+		return nil, errors.New("inputs_json must name at least one path or glob")
+	}
+	baseDir, _ := payload["base_dir"].(string)
+	if baseDir == "" {
+		baseDir = "."
+	}
+	members, err := collect(inputs, baseDir, out)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("no files matched %v", inputs)
+	}
+
+	if dir := filepath.Dir(out); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("archive: create dir: %w", err)
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(out), filepath.Base(out)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("archive: create temp: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if kind == "zip" {
+		err = writeZip(ctx, tmp, members)
+	} else {
+		err = writeTarGz(ctx, tmp, members)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), out); err != nil {
+		return nil, fmt.Errorf("archive: rename: %w", err)
+	}
+
+	sum, err := system.Checksum(out, "")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(members))
+	for i, m := range members {
+		names[i] = m.name
+	}
+	b, _ := json.Marshal(names)
+	return map[string]any{
+		"path":         out,
+		"files":        len(members),
+		"bytes":        sum["bytes"],
+		"entries_json": string(b),
+		"sha256":       sum["sha256"],
+	}, nil
+}
+
+// Expands inputs into regular files with unique entry names, skipping the
+// archive being written.
+func collect(inputs []string, baseDir, out string) ([]member, error) {
+	baseAbs, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	outAbs, _ := filepath.Abs(out)
+	var members []member
+	byName := map[string]string{}
+
+	add := func(src string) error {
+		abs, err := filepath.Abs(src)
+		if err != nil || abs == outAbs || strings.HasPrefix(filepath.Base(abs), filepath.Base(outAbs)+".tmp-") {
+			return nil
+		}
+		name := filepath.Base(abs)
+		if rel, err := filepath.Rel(baseAbs, abs); err == nil && utils.Within(baseAbs, abs) {
+			name = rel
+		}
+		name = filepath.ToSlash(name)
+		if prev, dup := byName[name]; dup {
+			if prev == abs {
+				return nil
+			}
+			return fmt.Errorf("%s and %s would both be stored as %q; set base_dir", prev, abs, name)
+		}
+		byName[name] = abs
+		members = append(members, member{src: src, name: name})
+		return nil
+	}
+
+	for _, in := range inputs {
+		var paths []string
+		if strings.ContainsAny(in, "*?[{") {
+			paths, _, err = system.Glob("", in, system.GlobOptions{Dirs: true})
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			if _, err := os.Stat(in); err != nil {
+				return nil, fmt.Errorf("input %s: %w", in, err)
+			}
+			paths = []string{in}
+		}
+		for _, p := range paths {
+			fi, err := os.Stat(p)
+			if err != nil {
+				return nil, err
+			}
+			if !fi.IsDir() {
+				if err := add(p); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			err = filepath.WalkDir(p, func(q string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() {
+					return add(q)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.SliceStable(members, func(i, j int) bool { return members[i].name < members[j].name })
+	return members, nil
+}
+
+func writeZip(ctx context.Context, w io.Writer, members []member) error {
+	zw := zip.NewWriter(w)
+	for _, m := range members {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fi, err := os.Stat(m.src)
+		if err != nil {
+			return err
+		}
+		hdr, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
+		}
+		hdr.Name, hdr.Method = m.name, zip.Deflate
+		dst, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if err := copyFile(dst, m.src); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(ctx context.Context, w io.Writer, members []member) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, m := range members {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fi, err := os.Stat(m.src)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = m.name
+		hdr.Uname, hdr.Gname = "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err := copyFile(tw, m.src); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func copyFile(dst io.Writer, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+// Accepts a JSON array string, a plain path string or a slice.
+func stringList(v any) ([]string, error) {
+	switch t := v.(type) {
+	case nil:
+		return nil, errors.New("payload is missing required key: 'inputs_json'")
+	case string:
+		s := strings.TrimSpace(t)
+		if !strings.HasPrefix(s, "[") {
+			if s == "" {
+				return nil, nil
+			}
+			return []string{s}, nil
+		}
+		var arr []string
+		if err := json.Unmarshal([]byte(s), &arr); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, x := range t {
+			s, ok := x.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected strings, got %T", x)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	case []string:
+		return t, nil
+	}
+	return nil, fmt.Errorf("expected a JSON array of paths, got %T", v)
+}
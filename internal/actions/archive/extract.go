@@ -0,0 +1,286 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"a-a/internal/utils"
+)
+
+const (
+	maxExtractBytes = 4 << 30 // total uncompressed size
+	maxExtractFiles = 100000
+)
+
+type skipped struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Unpacks a .zip, .tar.gz/.tgz or .tar (detected from content) into dest.
+// Required payload:
+//
+//	path: archive file
+//	dest: target directory; must be inside the workspace
+//
+// Entries that would land outside dest ("../", absolute names - "zip slip"),
+// links, devices and (unless overwrite) existing files are skipped and
+// reported. Extraction stops at 4GB or 100000 files.
+//
+// Optional payload:
+//
+//	overwrite:        replace existing files (default false)
+//	strip_components: drop this many leading path elements (e.g. 1 for GitHub tarballs)
+//
+// Output:
+//
+//	{ "dest": string, "files": int, "bytes": int64, "entries_json": "<[path]>", "skipped_json": "<[{name, reason}]>" }
+func handleExtract(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	src, err := utils.GetStringPayload(payload, "path")
+	if err != nil {
+		return nil, err
+	}
+	destArg, err := utils.GetStringPayload(payload, "dest")
+	if err != nil {
+		return nil, err
+	}
+	dest, err := utils.InWorkspace(destArg)
+	if err != nil {
+		return nil, fmt.Errorf("archive.extract: %w", err)
+	}
+	overwrite, _ := payload["overwrite"].(bool)
+	strip := 0
+	if v, ok := payload["strip_components"]; ok {
+		if strip, err = utils.GetIntPayload(map[string]any{"v": v}, "v"); err != nil || strip < 0 {
+			return nil, fmt.Errorf("strip_components must be a non-negative integer")
+		}
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return nil, fmt.Errorf("archive.extract: create dest: %w", err)
+	}
+
+	x := &extractor{ctx: ctx, dest: dest, destReal: utils.RealPath(dest), overwrite: overwrite, strip: strip, entries: []string{}, skipped: []skipped{}}
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("could not open archive: %w", err)
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")) || bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		err = x.zip(f, fi.Size())
+		if err != nil {
+			return nil, fmt.Errorf("archive.extract: %w", err)
+		}
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(bufio.NewReader(f))
+		if err != nil {
+			return nil, fmt.Errorf("archive.extract: %w", err)
+		}
+		defer gz.Close()
+		if err := x.tar(gz); err != nil {
+			return nil, fmt.Errorf("archive.extract: %w", err)
+		}
+	case len(head) > 262 && string(head[257:262]) == "ustar":
+		if err := x.tar(f); err != nil {
+			return nil, fmt.Errorf("archive.extract: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("archive.extract: %s is not a zip, tar or tar.gz archive", src)
+	}
+
+	be, _ := json.Marshal(x.entries)
+	bs, _ := json.Marshal(x.skipped)
+	return map[string]any{
+		"dest":         destArg,
+		"files":        len(x.entries),
+		"bytes":        x.total,
+		"entries_json": string(be),
+		"skipped_json": string(bs),
+	}, nil
+}
+
+type extractor struct {
+	ctx       context.Context
+	dest      string
+	destReal  string
+	overwrite bool
+	strip     int
+	total     int64
+	entries   []string
+	skipped   []skipped
+}
+
+func (x *extractor) zip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if err := x.ctx.Err(); err != nil {
+			return err
+		}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			x.dir(f.Name)
+		case mode.IsRegular():
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+			err = x.file(f.Name, rc, mode.Perm())
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			x.skip(f.Name, "not a regular file ("+mode.Type().String()+")")
+		}
+	}
+	return nil
+}
+
+func (x *extractor) tar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		if err := x.ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			x.dir(hdr.Name)
+		case tar.TypeReg:
+			if err := x.file(hdr.Name, tr, os.FileMode(hdr.Mode).Perm()); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+		default:
+			x.skip(hdr.Name, fmt.Sprintf("unsupported entry type %q (links and devices are not extracted)", hdr.Typeflag))
+		}
+	}
+}
+
+// Maps an entry name to a path under dest. An empty path comes with the
+// reason to report, or no reason when strip_components consumed the name.
+func (x *extractor) target(name string) (string, string) {
+	n := strings.ReplaceAll(name, "\\", "/")
+	if path.IsAbs(n) || filepath.VolumeName(name) != "" {
+		return "", "absolute path"
+	}
+	clean := path.Clean(n)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", "path escapes the destination"
+	}
+	parts := strings.Split(clean, "/")
+	if len(parts) <= x.strip {
+		return "", ""
+	}
+	rel := filepath.FromSlash(strings.Join(parts[x.strip:], "/"))
+	if rel == "." {
+		return "", ""
+	}
+	full := filepath.Join(x.dest, rel)
+	if !utils.Within(x.dest, full) {
+		return "", "path escapes the destination"
+	}
+	return full, ""
+}
+
+func (x *extractor) dir(name string) {
+	full, why := x.target(name)
+	if full == "" {
+		if why != "" {
+			x.skip(name, why)
+		}
+		return
+	}
+	if err := x.safeMkdir(full); err != nil {
+		x.skip(name, err.Error())
+	}
+}
+
+func (x *extractor) file(name string, r io.Reader, perm os.FileMode) error {
+	full, why := x.target(name)
+	if full == "" {
+		if why != "" {
+			x.skip(name, why)
+		}
+		return nil
+	}
+	if len(x.entries) >= maxExtractFiles {
+		return fmt.Errorf("archive has more than %d files", maxExtractFiles)
+	}
+	if err := x.safeMkdir(filepath.Dir(full)); err != nil {
+		x.skip(name, err.Error())
+		return nil
+	}
+	if fi, err := os.Lstat(full); err == nil {
+		if !x.overwrite || !fi.Mode().IsRegular() {
+			x.skip(name, "already exists")
+			return nil
+		}
+	}
+
+	out, err := os.OpenFile(full, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm|0o600)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	budget := maxExtractBytes - x.total
+	n, err := io.Copy(out, io.LimitReader(r, budget+1))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	x.total += n
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if n > budget {
+		os.Remove(full)
+		return fmt.Errorf("archive expands to more than %d bytes", int64(maxExtractBytes))
+	}
+	rel, _ := filepath.Rel(x.dest, full)
+	x.entries = append(x.entries, filepath.ToSlash(rel))
+	return nil
+}
+
+// Creates dir unless an existing symlink would take it outside dest.
+func (x *extractor) safeMkdir(dir string) error {
+	if !utils.Within(x.destReal, utils.RealPath(dir)) {
+		return errors.New("directory resolves outside the destination")
+	}
+	return os.MkdirAll(dir, 0o755)
+}
+
+func (x *extractor) skip(name, reason string) {
+	x.skipped = append(x.skipped, skipped{Name: name, Reason: reason})
+}
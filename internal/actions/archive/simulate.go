@@ -0,0 +1,33 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+
+	"a-a/internal/utils"
+)
+
+// Reports the archive a zip/tar_gz would write or the folder extract fills.
+func SimulateArchiveAction(ctx context.Context, operation string, payload map[string]any) ([]utils.Effect, error) {
+	switch operation {
+	case "zip", "tar_gz":
+		path, err := utils.GetStringPayload(payload, "path")
+		if err != nil {
+			return nil, err
+		}
+		return []utils.Effect{utils.FileEffect(path, false)}, nil
+	case "extract":
+		dest, err := utils.GetStringPayload(payload, "dest")
+		if err != nil {
+			return nil, err
+		}
+		e := utils.FileEffect(dest, false)
+		e.Detail = "entries of the archive"
+		if overwrite, _ := payload["overwrite"].(bool); overwrite {
+			e.Detail += ", replacing existing files"
+		}
+		return []utils.Effect{e}, nil
+	default:
+		return nil, fmt.Errorf("unknown archive operation: %s", operation)
+	}
+}
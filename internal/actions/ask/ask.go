@@ -0,0 +1,246 @@
+package ask
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"a-a/internal/utils"
+)
+
+const (
+	defaultTimeout = 5 * time.Minute
+	maxTimeout     = time.Hour
+	maxChoices     = 50
+)
+
+var (
+	cfgMu sync.Mutex
+	cfg   = Config{DefaultTimeout: defaultTimeout}
+)
+
+// Config holds the ask.user settings taken from CLI flags.
+type Config struct {
+	DefaultTimeout time.Duration // wait for an answer when the payload sets no timeout_s
+}
+
+// Configure replaces the settings; a zero DefaultTimeout keeps 5 minutes.
+func Configure(c Config) {
+	if c.DefaultTimeout <= 0 {
+		c.DefaultTimeout = defaultTimeout
+	}
+	cfgMu.Lock()
+	cfg = c
+	cfgMu.Unlock()
+}
+
+func HandleAskAction(ctx context.Context, operation string, payload map[string]any) (map[string]any, error) {
+	switch operation {
+	case "user":
+		return askUser(ctx, payload)
+	default:
+		return nil, fmt.Errorf("unknown ask operation: %s", operation)
+	}
+}
+
+// Pauses the action until the user answers a question in the REPL.
+// Required payload:
+//
+//	question: text shown to the user, with the mission ID
+//
+// Optional payload:
+//
+//	kind:         "text" (default), "choice" or "yes_no"
+//	choices_json: array for "choice"; strings are shown as is, other items as
+//	              JSON (e.g. product objects from @results)
+//	default:      answer used when nobody answers in time (for "choice" a label
+//	              or 1-based number); without it a timeout fails the action
+//	timeout_s:    wait for an answer (default 300, --ask-timeout; max 3600)
+//
+// Choices are answered by number or label, yes/no by y/yes/n/no. Invalid
+// answers are asked again until the timeout.
+//
+// Output:
+//
+//	{
+//	  "answer":      string (the text, the chosen label, or "yes"/"no"),
+//	  "index":       int (0-based choice, -1 otherwise),
+//	  "choice_json": "<chosen element of choices_json>" ("" otherwise),
+//	  "confirmed":   bool (yes_no answered yes),
+//	  "timed_out":   bool (default used)
+//	}
+func askUser(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	q, choices, err := questionOf(payload)
+	if err != nil {
+		return nil, fmt.Errorf("ask.user: %w", err)
+	}
+	if q.Default != "" {
+		if _, err := interpret(q, choices, q.Default); err != nil {
+			return nil, fmt.Errorf("ask.user: default: %w", err)
+		}
+	}
+
+	asker := utils.AskerFromContext(ctx)
+	if asker == nil {
+		if q.Default == "" {
+			return nil, errors.New("ask.user: no interactive user for this mission and no default answer")
+		}
+		return answerOf(q, choices, q.Default, true)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, q.Timeout)
+	defer cancel()
+	prompt := q.Prompt
+	for {
+		raw, err := asker(waitCtx, q)
+		if err != nil {
+			// Our own deadline (or the action's) passed: fall back to the default
+			if errors.Is(err, context.DeadlineExceeded) && !errors.Is(ctx.Err(), context.Canceled) {
+				if q.Default == "" {
+					return nil, fmt.Errorf("ask.user: no answer within %s", q.Timeout)
+				}
+				return answerOf(q, choices, q.Default, true)
+			}
+			return nil, fmt.Errorf("ask.user: %w", err)
+		}
+		if strings.TrimSpace(raw) == "" && q.Default != "" {
+			raw = q.Default
+		}
+		out, err := answerOf(q, choices, raw, false)
+		if err == nil {
+			return out, nil
+		}
+		q.Prompt = fmt.Sprintf("%s\n(%v)", prompt, err)
+	}
+}
+
+func questionOf(payload map[string]any) (utils.Question, []any, error) {
+	prompt, err := utils.GetStringPayload(payload, "question")
+	if err != nil {
+		return utils.Question{}, nil, err
+	}
+	q := utils.Question{Prompt: strings.TrimSpace(prompt), Kind: utils.AskText}
+	if k, _ := payload["kind"].(string); strings.TrimSpace(k) != "" {
+		q.Kind = strings.ToLower(strings.TrimSpace(k))
+	}
+	q.Default, _ = payload["default"].(string)
+	if v, ok := payload["default"].(bool); ok && q.Kind == utils.AskYesNo {
+		q.Default = map[bool]string{true: "yes", false: "no"}[v]
+	}
+
+	cfgMu.Lock()
+	q.Timeout = cfg.DefaultTimeout
+	cfgMu.Unlock()
+	if v, ok := payload["timeout_s"]; ok {
+		n, err := utils.GetIntPayload(map[string]any{"v": v}, "v")
+		if err != nil || n < 1 || time.Duration(n)*time.Second > maxTimeout {
+			return q, nil, fmt.Errorf("timeout_s must be between 1 and %d", int(maxTimeout.Seconds()))
+		}
+		q.Timeout = time.Duration(n) * time.Second
+	}
+
+	var choices []any
+	switch q.Kind {
+	case utils.AskText, utils.AskYesNo:
+	case utils.AskChoice:
+		choices, err = choicesOf(payload["choices_json"])
+		if err != nil {
+			return q, nil, err
+		}
+		for _, c := range choices {
+			q.Choices = append(q.Choices, label(c))
+		}
+	default:
+		return q, nil, fmt.Errorf("kind must be \"text\", \"choice\" or \"yes_no\", got %q", q.Kind)
+	}
+	return q, choices, nil
+}
+
+// Accepts a JSON array string or a slice.
+func choicesOf(v any) ([]any, error) {
+	var choices []any
+	switch t := v.(type) {
+	case string:
+		if err := json.Unmarshal([]byte(t), &choices); err != nil {
+			return nil, fmt.Errorf("choices_json must be a JSON array: %w", err)
+		}
+	case []any:
+		choices = t
+	default:
+		return nil, errors.New("kind \"choice\" needs choices_json (array)")
+	}
+	if len(choices) == 0 {
+		return nil, errors.New("choices_json is empty")
+	}
+	if len(choices) > maxChoices {
+		return nil, fmt.Errorf("choices_json has %d items (max %d)", len(choices), maxChoices)
+	}
+	return choices, nil
+}
+
+func label(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// Checks raw against the question and returns the chosen index (-1 unless
+// kind is choice).
+func interpret(q utils.Question, choices []any, raw string) (int, error) {
+	ans := strings.TrimSpace(raw)
+	switch q.Kind {
+	case utils.AskChoice:
+		if n, err := strconv.Atoi(ans); err == nil && n >= 1 && n <= len(choices) {
+			return n - 1, nil
+		}
+		for i, l := range q.Choices {
+			if strings.EqualFold(l, ans) {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("answer with a number from 1 to %d", len(choices))
+	case utils.AskYesNo:
+		switch strings.ToLower(ans) {
+		case "y", "yes", "n", "no":
+			return -1, nil
+		}
+		return -1, errors.New("answer y or n")
+	default:
+		if ans == "" {
+			return -1, errors.New("the answer is empty")
+		}
+		return -1, nil
+	}
+}
+
+func answerOf(q utils.Question, choices []any, raw string, timedOut bool) (map[string]any, error) {
+	idx, err := interpret(q, choices, raw)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{
+		"answer":      strings.TrimSpace(raw),
+		"index":       idx,
+		"choice_json": "",
+		"confirmed":   false,
+		"timed_out":   timedOut,
+	}
+	switch q.Kind {
+	case utils.AskChoice:
+		b, _ := json.Marshal(choices[idx])
+		out["answer"] = q.Choices[idx]
+		out["choice_json"] = string(b)
+	case utils.AskYesNo:
+		yes := strings.HasPrefix(strings.ToLower(strings.TrimSpace(raw)), "y")
+		out["confirmed"] = yes
+		out["answer"] = map[bool]string{true: "yes", false: "no"}[yes]
+	}
+	return out, nil
+}
@@ -0,0 +1,376 @@
+package doc
+
+import (
+	"bytes"
+	"math"
+	"strings"
+)
+
+const maxFormDepth = 8
+
+// PDF matrices are [a b c d e f], applied to row vectors.
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2], m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2], m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4], m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translate(x, y float64) matrix { return matrix{1, 0, 0, 1, x, y} }
+
+// Leaf pages in document order, with inherited Resources filled in.
+func (f *pdfFile) pages() []pdfDict {
+	var out []pdfDict
+	seen := map[int]bool{}
+	var walk func(node any, inherited any)
+	walk = func(node any, inherited any) {
+		if r, ok := node.(pdfRef); ok {
+			if seen[r.num] {
+				return
+			}
+			seen[r.num] = true
+		}
+		d := f.dict(node)
+		if d == nil {
+			return
+		}
+		if res, ok := d["Resources"]; ok {
+			inherited = res
+		}
+		if kids := f.array(d["Kids"]); d["Type"] == pdfName("Pages") || (d["Type"] == nil && kids != nil) {
+			for _, k := range kids {
+				walk(k, inherited)
+			}
+			return
+		}
+		page := pdfDict{}
+		for k, v := range d {
+			page[k] = v
+		}
+		page["Resources"] = inherited
+		out = append(out, page)
+	}
+	root := f.dict(f.trailer["Root"])
+	walk(root["Pages"], nil)
+	return out
+}
+
+func (f *pdfFile) pageContent(page pdfDict) []byte {
+	var parts [][]byte
+	add := func(v any) {
+		if s, ok := f.resolve(v).(*pdfStream); ok {
+			if data, err := f.decodeStream(s); err == nil {
+				parts = append(parts, data)
+			}
+		}
+	}
+	switch c := f.resolve(page["Contents"]).(type) {
+	case []any:
+		for _, v := range c {
+			add(v)
+		}
+	default:
+		add(page["Contents"])
+	}
+	return bytes.Join(parts, []byte("\n"))
+}
+
+type gstate struct {
+	ctm                  matrix
+	font                 *pdfFont
+	size, tc, tw, th, tl float64
+}
+
+// Turns positioned glyphs back into reading text: a vertical move starts a
+// new line (a large one a new paragraph), a horizontal gap wider than a
+// fraction of the font size becomes a space.
+type textWriter struct {
+	f       *pdfFile
+	b       strings.Builder
+	started bool
+	lastX   float64
+	lastY   float64
+	size    float64
+	missing int // glyphs with no Unicode mapping
+}
+
+func (w *textWriter) glyph(text string, x, y, size float64, known bool) {
+	if w.started {
+		dy := math.Abs(y - w.lastY)
+		ref := max(size, w.size, 1)
+		switch {
+		case dy > 2*ref && y < w.lastY:
+			w.newline(2)
+		case dy > 0.5*ref:
+			w.newline(1)
+		case x-w.lastX > 0.2*ref || w.lastX-x > 2*ref:
+			w.space()
+		}
+	}
+	w.started = true
+	w.lastY, w.size = y, size
+	if !known {
+		w.missing++
+		return
+	}
+	for _, r := range text {
+		switch {
+		case r == '\t' || r == ' ' || r == '\u00a0':
+			w.space()
+		case r < 0x20 || r == '\u00ad' || r == '\uFFFD':
+			// Control characters, soft hyphens, unmappable glyphs
+		default:
+			w.b.WriteRune(r)
+		}
+	}
+}
+
+func (w *textWriter) space() {
+	s := w.b.String()
+	if s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		w.b.WriteByte(' ')
+	}
+}
+
+func (w *textWriter) newline(n int) {
+	s := strings.TrimRight(w.b.String(), " ")
+	if s == "" {
+		return
+	}
+	have := len(s) - len(strings.TrimRight(s, "\n"))
+	w.b.Reset()
+	w.b.WriteString(s)
+	for ; have < n; have++ {
+		w.b.WriteByte('\n')
+	}
+}
+
+func (w *textWriter) text() string {
+	lines := strings.Split(w.b.String(), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(l)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func (f *pdfFile) pageText(page pdfDict) (string, int) {
+	w := &textWriter{f: f}
+	w.run(f.pageContent(page), f.dict(page["Resources"]), identity, 0)
+	return w.text(), w.missing
+}
+
+func (w *textWriter) run(content []byte, res pdfDict, ctm matrix, depth int) {
+	f := w.f
+	gs := gstate{ctm: ctm, size: 1, th: 1}
+	var stack []gstate
+	tm, tlm := identity, identity
+	fonts := f.dict(res["Font"])
+	xobjects := f.dict(res["XObject"])
+
+	show := func(s pdfStr) {
+		if gs.font == nil {
+			gs.font = f.fontFor(nil)
+		}
+		for _, g := range gs.font.decode(s) {
+			m := tm.mul(gs.ctm)
+			size := math.Abs(gs.size) * math.Hypot(m[2], m[3])
+			w.glyph(g.text, m[4], m[5], size, g.known)
+			adv := g.width*gs.size + gs.tc
+			if g.space {
+				adv += gs.tw
+			}
+			tm = translate(adv*gs.th, 0).mul(tm)
+			w.lastX = tm.mul(gs.ctm)[4]
+		}
+	}
+	nextLine := func() {
+		tlm = translate(0, -gs.tl).mul(tlm)
+		tm = tlm
+	}
+
+	lx := &lexer{data: content}
+	var ops []any
+	for {
+		v, err := lx.object()
+		if err != nil {
+			return
+		}
+		kw, ok := v.(pdfKw)
+		if !ok {
+			ops = append(ops, v)
+			continue
+		}
+		switch kw {
+		case "q":
+			stack = append(stack, gs)
+		case "Q":
+			if n := len(stack); n > 0 {
+				gs, stack = stack[n-1], stack[:n-1]
+			}
+		case "cm":
+			if m, ok := toMatrix(ops); ok {
+				gs.ctm = m.mul(gs.ctm)
+			}
+		case "BT":
+			tm, tlm = identity, identity
+		case "Tc":
+			gs.tc = lastNum(ops)
+		case "Tw":
+			gs.tw = lastNum(ops)
+		case "Tz":
+			gs.th = lastNum(ops) / 100
+		case "TL":
+			gs.tl = lastNum(ops)
+		case "Tf":
+			if len(ops) >= 2 {
+				if name, ok := ops[0].(pdfName); ok {
+					gs.font = f.fontFor(fonts[string(name)])
+				}
+				gs.size = num(ops[1])
+			}
+		case "Td", "TD":
+			if len(ops) >= 2 {
+				tx, ty := num(ops[0]), num(ops[1])
+				if kw == "TD" {
+					gs.tl = -ty
+				}
+				tlm = translate(tx, ty).mul(tlm)
+				tm = tlm
+			}
+		case "Tm":
+			if m, ok := toMatrix(ops); ok {
+				tm, tlm = m, m
+			}
+		case "T*":
+			nextLine()
+		case "Tj":
+			if len(ops) > 0 {
+				if s, ok := ops[len(ops)-1].(pdfStr); ok {
+					show(s)
+				}
+			}
+		case "'":
+			nextLine()
+			if len(ops) > 0 {
+				if s, ok := ops[len(ops)-1].(pdfStr); ok {
+					show(s)
+				}
+			}
+		case "\"":
+			if len(ops) >= 3 {
+				gs.tw, gs.tc = num(ops[0]), num(ops[1])
+				nextLine()
+				if s, ok := ops[2].(pdfStr); ok {
+					show(s)
+				}
+			}
+		case "TJ":
+			if len(ops) > 0 {
+				arr, _ := ops[len(ops)-1].([]any)
+				for _, el := range arr {
+					switch t := el.(type) {
+					case pdfStr:
+						show(t)
+					case int, float64:
+						tm = translate(-num(t)/1000*gs.size*gs.th, 0).mul(tm)
+					}
+				}
+			}
+		case "Do":
+			if len(ops) > 0 && depth < maxFormDepth {
+				if name, ok := ops[0].(pdfName); ok {
+					w.form(xobjects[string(name)], res, gs.ctm, depth)
+				}
+			}
+		case "BI":
+			skipInlineImage(lx)
+		}
+		ops = ops[:0]
+	}
+}
+
+// Form XObjects carry their own content (and often all of a page's text).
+func (w *textWriter) form(v any, parentRes pdfDict, ctm matrix, depth int) {
+	s, ok := w.f.resolve(v).(*pdfStream)
+	if !ok || s.dict["Subtype"] != pdfName("Form") {
+		return
+	}
+	data, err := w.f.decodeStream(s)
+	if err != nil {
+		return
+	}
+	if m, ok := toMatrix(w.f.array(s.dict["Matrix"])); ok {
+		ctm = m.mul(ctm)
+	}
+	res := w.f.dict(s.dict["Resources"])
+	if res == nil {
+		res = parentRes
+	}
+	w.run(data, res, ctm, depth+1)
+}
+
+func (f *pdfFile) fontFor(v any) *pdfFont {
+	r, isRef := v.(pdfRef)
+	if isRef {
+		if font, ok := f.fonts[r]; ok {
+			return font
+		}
+	}
+	font := f.loadFont(v)
+	if isRef {
+		f.fonts[r] = font
+	}
+	return font
+}
+
+// Skips "BI <params> ID <binary data> EI".
+func skipInlineImage(lx *lexer) {
+	for {
+		v, err := lx.object()
+		if err != nil || v == pdfKw("ID") {
+			break
+		}
+	}
+	lx.pos++
+	for i := lx.pos; i+1 < len(lx.data); i++ {
+		if lx.data[i] == 'E' && lx.data[i+1] == 'I' && (i == 0 || isSpace(lx.data[i-1])) &&
+			(i+2 == len(lx.data) || isSpace(lx.data[i+2])) {
+			lx.pos = i + 2
+			return
+		}
+	}
+	lx.pos = len(lx.data)
+}
+
+func num(v any) float64 {
+	switch t := v.(type) {
+	case int:
+		return float64(t)
+	case float64:
+		return t
+	}
+	return 0
+}
+
+func lastNum(ops []any) float64 {
+	if len(ops) == 0 {
+		return 0
+	}
+	return num(ops[len(ops)-1])
+}
+
+func toMatrix(ops []any) (matrix, bool) {
+	if len(ops) < 6 {
+		return identity, false
+	}
+	var m matrix
+	for i := range 6 {
+		m[i] = num(ops[len(ops)-6+i])
+	}
+	return m, true
+}
@@ -0,0 +1,283 @@
+package doc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"a-a/internal/actions/web"
+	"a-a/internal/utils"
+)
+
+const maxDocBytes = 200 << 20 // 200MB
+
+type docPage struct {
+	Page  int    `json:"page"`
+	Text  string `json:"text"`
+	Chars int    `json:"chars"`
+}
+
+func HandleDocAction(ctx context.Context, operation string, payload map[string]any) (map[string]any, error) {
+	switch operation {
+	case "pdf_text":
+		return handlePDFText(ctx, payload)
+	case "docx_text":
+		return handleDocxText(ctx, payload)
+	default:
+		return nil, fmt.Errorf("unknown doc operation: %s", operation)
+	}
+}
+
+// Extracts text per page and the Info metadata from a PDF, offline.
+// Required payload (one of):
+//
+//	path:           local file, e.g. the path written by web.download
+//	content_base64: document bytes, base64-encoded
+//	content:        raw document bytes (e.g. @results.fetch.content of web.request)
+//	url:            fetched with web.request semantics (cache, politeness)
+//
+// Optional payload:
+//
+//	max_pages:    only extract the first N pages (page_count still reports all)
+//	max_chars:    cap the combined text; sets truncated=true
+//	page_markers: prefix each page in "text" with "--- page N ---" (default true when >1 page)
+//
+// Scanned (image-only) pages come back empty; encrypted files are rejected.
+//
+// Output:
+//
+//	{
+//	  "text":          all pages, ready for llm.extract_structured input,
+//	  "pages_json":    "<[{page, text, chars}]>",
+//	  "page_count":    int,
+//	  "metadata_json": "<{title, author, subject, keywords, creator, producer, created, modified, pdf_version}>",
+//	  "chars":         int,
+//	  "truncated":     bool,
+//	  "warnings_json": "<[string]>"
+//	}
+func handlePDFText(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	data, err := loadDocument(ctx, payload)
+	if err != nil {
+		return nil, fmt.Errorf("doc.pdf_text: %w", err)
+	}
+	f, err := openPDF(data)
+	if err != nil {
+		return nil, fmt.Errorf("doc.pdf_text: %w", err)
+	}
+	pageDicts := f.pages()
+	if len(pageDicts) == 0 {
+		return nil, errors.New("doc.pdf_text: PDF has no pages")
+	}
+	limit := pageLimit(payload, len(pageDicts))
+
+	var warnings []string
+	texts := make([]string, 0, limit)
+	missing, empty := 0, 0
+	for _, p := range pageDicts[:limit] {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		t, m := f.pageText(p)
+		missing += m
+		if t == "" {
+			empty++
+		}
+		texts = append(texts, t)
+	}
+	if missing > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d glyphs had no Unicode mapping and were dropped", missing))
+	}
+	if empty > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d of %d pages have no extractable text (scanned images need OCR)", empty, limit))
+	}
+
+	info := f.dict(f.trailer["Info"])
+	meta := map[string]any{"pdf_version": f.version}
+	for key, name := range map[string]string{
+		"Title": "title", "Author": "author", "Subject": "subject", "Keywords": "keywords",
+		"Creator": "creator", "Producer": "producer", "CreationDate": "created", "ModDate": "modified",
+	} {
+		v := strings.TrimSpace(textString(f.resolve(info[key])))
+		if v == "" {
+			continue
+		}
+		if key == "CreationDate" || key == "ModDate" {
+			v = pdfDate(v)
+		}
+		meta[name] = v
+	}
+	return docOutput(payload, texts, len(pageDicts), meta, warnings), nil
+}
+
+// Extracts text and core properties from a Word .docx file, offline.
+// Required payload (one of): path, content_base64, content, url (as doc.pdf_text).
+//
+// DOCX files have no fixed layout, so "pages" are split at explicit page
+// breaks and at the page breaks Word stored on its last save; files written by
+// other tools often come back as a single page.
+//
+// Optional payload: max_pages, max_chars, page_markers (as doc.pdf_text).
+//
+// Output: same keys as doc.pdf_text; metadata_json carries title, author,
+// subject, keywords, description, last_modified_by, revision, created,
+// modified, creator_app, declared_pages, declared_words.
+func handleDocxText(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	data, err := loadDocument(ctx, payload)
+	if err != nil {
+		return nil, fmt.Errorf("doc.docx_text: %w", err)
+	}
+	res, err := readDocx(data)
+	if err != nil {
+		return nil, fmt.Errorf("doc.docx_text: %w", err)
+	}
+	limit := pageLimit(payload, len(res.pages))
+	return docOutput(payload, res.pages[:limit], len(res.pages), res.metadata, nil), nil
+}
+
+func loadDocument(ctx context.Context, payload map[string]any) ([]byte, error) {
+	var data []byte
+	switch {
+	case payload["path"] != nil:
+		path, err := utils.GetStringPayload(payload, "path")
+		if err != nil {
+			return nil, err
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read file: %w", err)
+		}
+		if fi.Size() > maxDocBytes {
+			return nil, fmt.Errorf("%s is larger than %d MB", path, maxDocBytes>>20)
+		}
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read file: %w", err)
+		}
+	case payload["content_base64"] != nil:
+		s, err := utils.GetStringPayload(payload, "content_base64")
+		if err != nil {
+			return nil, err
+		}
+		data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("content_base64 is not valid base64: %w", err)
+		}
+	case payload["content"] != nil:
+		s, err := utils.GetStringPayload(payload, "content")
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(s)
+	case payload["url"] != nil:
+		u, err := utils.GetStringPayload(payload, "url")
+		if err != nil {
+			return nil, err
+		}
+		body, status, err := web.Get(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		if status >= 400 {
+			return nil, fmt.Errorf("fetch %s: HTTP %d", u, status)
+		}
+		data = []byte(body)
+	default:
+		return nil, errors.New("payload needs one of 'path', 'content_base64', 'content' or 'url'")
+	}
+	if len(data) == 0 {
+		return nil, errors.New("document is empty")
+	}
+	return data, nil
+}
+
+func pageLimit(payload map[string]any, total int) int {
+	if v, ok := payload["max_pages"]; ok {
+		if n, err := utils.GetIntPayload(map[string]any{"v": v}, "v"); err == nil && n > 0 && n < total {
+			return n
+		}
+	}
+	return total
+}
+
+func docOutput(payload map[string]any, texts []string, total int, meta map[string]any, warnings []string) map[string]any {
+	markers := len(texts) > 1
+	if v, ok := payload["page_markers"].(bool); ok {
+		markers = v
+	}
+	maxChars := 0
+	if v, ok := payload["max_chars"]; ok {
+		if n, err := utils.GetIntPayload(map[string]any{"v": v}, "v"); err == nil && n > 0 {
+			maxChars = n
+		}
+	}
+
+	pages := make([]docPage, len(texts))
+	parts := make([]string, len(texts))
+	for i, t := range texts {
+		pages[i] = docPage{Page: i + 1, Text: t, Chars: utf8.RuneCountInString(t)}
+		if markers {
+			t = fmt.Sprintf("--- page %d ---\n%s", i+1, t)
+		}
+		parts[i] = t
+	}
+	text := strings.Join(parts, "\n\n")
+	truncated := false
+	if maxChars > 0 && utf8.RuneCountInString(text) > maxChars {
+		text = string([]rune(text)[:maxChars])
+		truncated = true
+	}
+	if len(texts) < total {
+		warnings = append(warnings, fmt.Sprintf("only the first %d of %d pages were extracted", len(texts), total))
+	}
+	if warnings == nil {
+		warnings = []string{}
+	}
+	meta["page_count"] = total
+
+	bp, _ := json.Marshal(pages)
+	bm, _ := json.Marshal(meta)
+	bw, _ := json.Marshal(warnings)
+	return map[string]any{
+		"text":          text,
+		"pages_json":    string(bp),
+		"page_count":    total,
+		"metadata_json": string(bm),
+		"chars":         utf8.RuneCountInString(text),
+		"truncated":     truncated,
+		"warnings_json": string(bw),
+	}
+}
+
+var pdfDateRe = regexp.MustCompile(`^(?:D:)?(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?([Zz+\-])?(\d{2})?'?(\d{2})?'?$`)
+
+// "D:20240131153000+01'00'" -> "2024-01-31T15:30:00+01:00"; unparseable
+// dates are returned as-is.
+func pdfDate(s string) string {
+	m := pdfDateRe.FindStringSubmatch(s)
+	if m == nil {
+		return s
+	}
+	or := func(v, def string) string {
+		if v == "" {
+			return def
+		}
+		return v
+	}
+	zone := "Z"
+	if m[7] == "+" || m[7] == "-" {
+		zone = m[7] + or(m[8], "00") + ":" + or(m[9], "00")
+	}
+	stamp := fmt.Sprintf("%s-%s-%sT%s:%s:%s%s", m[1], or(m[2], "01"), or(m[3], "01"), or(m[4], "00"), or(m[5], "00"), or(m[6], "00"), zone)
+	t, err := time.Parse(time.RFC3339, stamp)
+	if err != nil {
+		return s
+	}
+	return t.Format(time.RFC3339)
+}
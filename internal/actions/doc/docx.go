@@ -0,0 +1,245 @@
+package doc
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const maxDocxPartBytes = 64 << 20
+
+type docxResult struct {
+	pages    []string
+	metadata map[string]any
+}
+
+// Reads word/document.xml. DOCX has no fixed pagination, so pages are cut
+// at explicit page breaks and at the breaks Word recorded when it last laid
+// the document out (w:lastRenderedPageBreak).
+func readDocx(data []byte) (*docxResult, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a DOCX file: %w", err)
+	}
+	parts := map[string]*zip.File{}
+	for _, f := range zr.File {
+		parts[f.Name] = f
+	}
+	body, ok := parts["word/document.xml"]
+	if !ok {
+		return nil, errors.New("not a DOCX file (missing word/document.xml)")
+	}
+	raw, err := readPart(body)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := docxText(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse word/document.xml: %w", err)
+	}
+
+	meta := map[string]any{}
+	if f, ok := parts["docProps/core.xml"]; ok {
+		if raw, err := readPart(f); err == nil {
+			docxProps(raw, meta, map[string]string{
+				"title": "title", "subject": "subject", "creator": "author",
+				"keywords": "keywords", "description": "description",
+				"lastModifiedBy": "last_modified_by", "revision": "revision",
+				"created": "created", "modified": "modified",
+			})
+		}
+	}
+	if f, ok := parts["docProps/app.xml"]; ok {
+		if raw, err := readPart(f); err == nil {
+			docxProps(raw, meta, map[string]string{
+				"Application": "creator_app", "Pages": "declared_pages", "Words": "declared_words",
+			})
+		}
+	}
+	return &docxResult{pages: pages, metadata: meta}, nil
+}
+
+func readPart(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxDocxPartBytes))
+}
+
+// Paragraphs become lines, tabs and table cells become tabs, table rows
+// become lines, numbered/bulleted paragraphs get a "- " prefix.
+func docxText(raw []byte) ([]string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(raw))
+	var pages []string
+	var page, para strings.Builder
+	inText := false
+	cellDepth := 0
+	listItem := false
+
+	flushPara := func(sep string) {
+		p := strings.TrimRight(para.String(), " \t")
+		para.Reset()
+		if listItem && strings.TrimSpace(p) != "" {
+			p = "- " + strings.TrimLeft(p, " \t")
+		}
+		listItem = false
+		page.WriteString(p)
+		page.WriteString(sep)
+	}
+	flushPage := func() {
+		if para.Len() > 0 {
+			flushPara("\n")
+		}
+		pages = append(pages, page.String())
+		page.Reset()
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				if !inText {
+					para.WriteByte('\t')
+				}
+			case "br", "cr":
+				if attr(t, "type") == "page" {
+					flushPage()
+				} else {
+					para.WriteByte('\n')
+				}
+			case "lastRenderedPageBreak":
+				if page.Len() > 0 || para.Len() > 0 {
+					flushPage()
+				}
+			case "noBreakHyphen":
+				para.WriteByte('-')
+			case "numPr":
+				listItem = true
+			case "tc":
+				cellDepth++
+			case "tabs", "delText", "instrText":
+				// Tab stop definitions, deleted revisions, field codes
+				if err := dec.Skip(); err != nil {
+					return nil, err
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if cellDepth > 0 {
+					flushPara(" ")
+				} else {
+					flushPara("\n")
+				}
+			case "tc":
+				cellDepth--
+				trimTrailing(&page, " ")
+				page.WriteByte('\t')
+			case "tr":
+				trimTrailing(&page, "\t")
+				page.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	flushPage()
+
+	out := make([]string, 0, len(pages))
+	for _, p := range pages {
+		out = append(out, tidy(p))
+	}
+	// Breaks at the very start or end of the body leave empty pages behind
+	for len(out) > 1 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	for len(out) > 1 && out[0] == "" {
+		out = out[1:]
+	}
+	return out, nil
+}
+
+func attr(e xml.StartElement, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func trimTrailing(b *strings.Builder, cut string) {
+	s := strings.TrimRight(b.String(), cut)
+	b.Reset()
+	b.WriteString(s)
+}
+
+// Copies simple elements of a docProps part into meta, renamed via keys.
+func docxProps(raw []byte, meta map[string]any, keys map[string]string) {
+	dec := xml.NewDecoder(bytes.NewReader(raw))
+	var current string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			current = keys[t.Name.Local]
+		case xml.CharData:
+			v := strings.TrimSpace(string(t))
+			if current == "" || v == "" {
+				continue
+			}
+			if n, err := strconv.Atoi(v); err == nil && strings.HasPrefix(current, "declared_") {
+				meta[current] = n
+			} else {
+				meta[current] = v
+			}
+		case xml.EndElement:
+			current = ""
+		}
+	}
+}
+
+// Trims line ends and collapses runs of blank lines.
+func tidy(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank := 0
+	for _, l := range lines {
+		l = strings.TrimRight(l, " \t")
+		if strings.TrimSpace(l) == "" {
+			blank++
+			if blank > 1 {
+				continue
+			}
+			l = ""
+		} else {
+			blank = 0
+		}
+		out = append(out, l)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
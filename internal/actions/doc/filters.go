@@ -0,0 +1,307 @@
+package doc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const maxStreamBytes = 64 << 20 // 64MB per decoded stream
+
+// Applies the stream's /Filter chain. Image codecs (DCT, JPX, CCITT, JBIG2)
+// are left encoded; they never carry text.
+func (f *pdfFile) decodeStream(s *pdfStream) ([]byte, error) {
+	data := s.raw
+	filters := f.resolve(s.dict["Filter"])
+	parms := f.resolve(s.dict["DecodeParms"])
+	if parms == nil {
+		parms = f.resolve(s.dict["DP"])
+	}
+
+	var names []any
+	var parmList []any
+	switch t := filters.(type) {
+	case nil:
+		return data, nil
+	case pdfName:
+		names = []any{t}
+		parmList = []any{parms}
+	case []any:
+		names = t
+		parmList, _ = parms.([]any)
+	}
+
+	for i, n := range names {
+		name, _ := f.resolve(n).(pdfName)
+		var p pdfDict
+		if i < len(parmList) {
+			p = f.dict(parmList[i])
+		}
+		var err error
+		switch name {
+		case "FlateDecode", "Fl":
+			data, err = inflate(data)
+			if err == nil {
+				data, err = f.unpredict(data, p)
+			}
+		case "LZWDecode", "LZW":
+			early := 1
+			if v, ok := f.resolve(p["EarlyChange"]).(int); ok {
+				early = v
+			}
+			data, err = lzwDecode(data, early == 1)
+			if err == nil {
+				data, err = f.unpredict(data, p)
+			}
+		case "ASCIIHexDecode", "AHx":
+			data = asciiHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		case "RunLengthDecode", "RL":
+			data = runLengthDecode(data)
+		case "Crypt":
+			// Identity crypt filter
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return data, nil
+}
+
+// zlib with a raw-deflate fallback; truncated streams keep what decoded.
+func inflate(data []byte) ([]byte, error) {
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		r = zr
+	} else {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxStreamBytes))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Undoes TIFF (2) and PNG (>= 10) predictors.
+func (f *pdfFile) unpredict(data []byte, p pdfDict) ([]byte, error) {
+	pred, _ := f.resolve(p["Predictor"]).(int)
+	if pred < 2 {
+		return data, nil
+	}
+	colors, bpc, columns := 1, 8, 1
+	if v, ok := f.resolve(p["Colors"]).(int); ok && v > 0 {
+		colors = v
+	}
+	if v, ok := f.resolve(p["BitsPerComponent"]).(int); ok && v > 0 {
+		bpc = v
+	}
+	if v, ok := f.resolve(p["Columns"]).(int); ok && v > 0 {
+		columns = v
+	}
+	bpp := max(colors*bpc/8, 1)
+	rowLen := (colors*bpc*columns + 7) / 8
+
+	if pred == 2 {
+		if bpc != 8 {
+			return data, nil
+		}
+		out := append([]byte{}, data...)
+		for r := 0; r+rowLen <= len(out); r += rowLen {
+			for i := bpp; i < rowLen; i++ {
+				out[r+i] += out[r+i-bpp]
+			}
+		}
+		return out, nil
+	}
+
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for r := 0; r+1+rowLen <= len(data); r += rowLen + 1 {
+		ft := data[r]
+		row := append([]byte{}, data[r+1:r+1+rowLen]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch ft {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			case 0:
+			default:
+				return nil, fmt.Errorf("bad PNG predictor row type %d", ft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func asciiHexDecode(data []byte) []byte {
+	return (&lexer{data: append([]byte{'<'}, data...)}).hexString()
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	var out []byte
+	var group [5]byte
+	n := 0
+	flush := func(count int) {
+		var v uint32
+		for i := range 5 {
+			v = v*85 + uint32(group[i]-'!')
+		}
+		b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+		out = append(out, b[:count]...)
+	}
+	for _, c := range data {
+		switch {
+		case isSpace(c):
+			continue
+		case c == 'z' && n == 0:
+			out = append(out, 0, 0, 0, 0)
+			continue
+		case c < '!' || c > 'u':
+			return nil, fmt.Errorf("invalid ASCII85 byte %q", c)
+		}
+		group[n] = c
+		n++
+		if n == 5 {
+			flush(4)
+			n = 0
+		}
+	}
+	if n > 0 {
+		for i := n; i < 5; i++ {
+			group[i] = 'u'
+		}
+		flush(n - 1)
+	}
+	return out, nil
+}
+
+func runLengthDecode(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		i++
+		switch {
+		case n == 128:
+			return out
+		case n < 128:
+			end := min(i+n+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		default:
+			if i < len(data) {
+				out = append(out, bytes.Repeat([]byte{data[i]}, 257-n)...)
+			}
+			i++
+		}
+	}
+	return out
+}
+
+// PDF flavour of LZW: MSB-first codes, 9-12 bits, usually with early change
+// (which compress/lzw does not support).
+func lzwDecode(data []byte, early bool) ([]byte, error) {
+	const clear, eod = 256, 257
+	var out []byte
+	table := make([][]byte, 258, 4096)
+	reset := func() {
+		table = table[:258]
+		for i := range 256 {
+			table[i] = []byte{byte(i)}
+		}
+	}
+	reset()
+	width := 9
+	var bitBuf uint32
+	bits := 0
+	var prev []byte
+	for _, b := range data {
+		bitBuf = bitBuf<<8 | uint32(b)
+		bits += 8
+		for bits >= width {
+			code := int(bitBuf>>(bits-width)) & (1<<width - 1)
+			bits -= width
+			switch {
+			case code == clear:
+				reset()
+				width = 9
+				prev = nil
+				continue
+			case code == eod:
+				return out, nil
+			}
+			var entry []byte
+			switch {
+			case code < len(table):
+				entry = table[code]
+			case code == len(table) && prev != nil:
+				entry = append(append([]byte{}, prev...), prev[0])
+			default:
+				return nil, errors.New("corrupt LZW data")
+			}
+			out = append(out, entry...)
+			if prev != nil && len(table) < 4096 {
+				table = append(table, append(append([]byte{}, prev...), entry[0]))
+			}
+			prev = entry
+			limit := len(table)
+			if early {
+				limit++
+			}
+			switch {
+			case limit >= 2048:
+				width = 12
+			case limit >= 1024:
+				width = 11
+			case limit >= 512:
+				width = 10
+			}
+			if len(out) > maxStreamBytes {
+				return nil, errors.New("decoded stream too large")
+			}
+		}
+	}
+	return out, nil
+}
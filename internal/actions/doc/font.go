@@ -0,0 +1,422 @@
+package doc
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Maps string bytes in a content stream to Unicode text and glyph widths.
+type pdfFont struct {
+	composite  bool // Type0: multi-byte CIDs
+	toUnicode  map[string]string
+	codespace  []codeRange
+	enc        [256]rune
+	widths     map[int]float64 // code (or CID) -> glyph space width
+	dflt       float64
+	widthScale float64 // glyph space -> text space (1/1000, or FontMatrix for Type3)
+}
+
+type codeRange struct{ lo, hi []byte }
+
+type glyph struct {
+	text  string
+	width float64 // text space, before font size
+	space bool    // single-byte code 32, which word spacing applies to
+	known bool
+}
+
+func (f *pdfFile) loadFont(v any) *pdfFont {
+	d := f.dict(v)
+	font := &pdfFont{dflt: 500, widthScale: 0.001, widths: map[int]float64{}}
+	if d == nil {
+		font.enc = winAnsi
+		return font
+	}
+	subtype, _ := f.resolve(d["Subtype"]).(pdfName)
+	if subtype == "Type0" {
+		font.composite = true
+		font.dflt = 1000
+		if desc := f.array(d["DescendantFonts"]); len(desc) > 0 {
+			dd := f.dict(desc[0])
+			if dw := f.number(dd["DW"]); dw > 0 {
+				font.dflt = dw
+			}
+			font.cidWidths(f, f.array(dd["W"]))
+		}
+	} else {
+		font.enc = f.simpleEncoding(d)
+		first := int(f.number(d["FirstChar"]))
+		for i, w := range f.array(d["Widths"]) {
+			font.widths[first+i] = f.number(w)
+		}
+		if subtype == "Type3" {
+			if m := f.array(d["FontMatrix"]); len(m) > 0 {
+				font.widthScale = f.number(m[0])
+			}
+		}
+		if fd := f.dict(d["FontDescriptor"]); fd != nil {
+			if mw := f.number(fd["MissingWidth"]); mw > 0 {
+				font.dflt = mw
+			}
+		}
+	}
+	if s, ok := f.resolve(d["ToUnicode"]).(*pdfStream); ok {
+		if data, err := f.decodeStream(s); err == nil {
+			font.toUnicode, font.codespace = parseCMap(data)
+		}
+	}
+	return font
+}
+
+// W array: [c [w1 w2 ...]] or [cFirst cLast w].
+func (font *pdfFont) cidWidths(f *pdfFile, w []any) {
+	for i := 0; i < len(w); {
+		start := int(f.number(w[i]))
+		if i+1 >= len(w) {
+			return
+		}
+		if arr, ok := f.resolve(w[i+1]).([]any); ok {
+			for k, x := range arr {
+				font.widths[start+k] = f.number(x)
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		end, width := int(f.number(w[i+1])), f.number(w[i+2])
+		for c := start; c <= end && c-start < 1<<16; c++ {
+			font.widths[c] = width
+		}
+		i += 3
+	}
+}
+
+func (f *pdfFile) simpleEncoding(d pdfDict) [256]rune {
+	enc := winAnsi
+	var diffs []any
+	switch e := f.resolve(d["Encoding"]).(type) {
+	case pdfName:
+		enc = namedEncoding(e)
+	case pdfDict:
+		if base, ok := f.resolve(e["BaseEncoding"]).(pdfName); ok {
+			enc = namedEncoding(base)
+		}
+		diffs = f.array(e["Differences"])
+	}
+	code := 0
+	for _, x := range diffs {
+		switch t := f.resolve(x).(type) {
+		case int:
+			code = t
+		case pdfName:
+			if code >= 0 && code < 256 {
+				if r := glyphRune(string(t)); r != 0 {
+					enc[code] = r
+				} else {
+					enc[code] = -1
+				}
+			}
+			code++
+		}
+	}
+	return enc
+}
+
+func namedEncoding(name pdfName) [256]rune {
+	if name == "MacRomanEncoding" {
+		return macRoman
+	}
+	return winAnsi
+}
+
+// Splits s into character codes and maps each to text and width.
+func (font *pdfFont) decode(s []byte) []glyph {
+	var out []glyph
+	for i := 0; i < len(s); {
+		n := font.codeLen(s[i:])
+		code := s[i : i+n]
+		i += n
+
+		cid := 0
+		for _, b := range code {
+			cid = cid<<8 | int(b)
+		}
+		g := glyph{width: font.dflt, space: n == 1 && code[0] == ' '}
+		if w, ok := font.widths[cid]; ok {
+			g.width = w
+		}
+		g.width *= font.widthScale
+
+		if t, ok := font.toUnicode[string(code)]; ok {
+			g.text, g.known = t, true
+		} else if !font.composite && n == 1 {
+			if r := font.enc[code[0]]; r > 0 {
+				g.text, g.known = string(r), true
+			}
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+func (font *pdfFont) codeLen(s []byte) int {
+	for _, r := range font.codespace {
+		n := len(r.lo)
+		if n == 0 || n > len(s) {
+			continue
+		}
+		match := true
+		for k := range n {
+			if s[k] < r.lo[k] || s[k] > r.hi[k] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return n
+		}
+	}
+	if font.composite && len(s) >= 2 {
+		return 2
+	}
+	return 1
+}
+
+// Reads bfchar/bfrange mappings and the codespace from a ToUnicode CMap.
+func parseCMap(data []byte) (map[string]string, []codeRange) {
+	m := map[string]string{}
+	var space []codeRange
+	l := &lexer{data: data}
+	var operands []any
+	for {
+		v, err := l.object()
+		if err != nil {
+			break
+		}
+		kw, isKw := v.(pdfKw)
+		if !isKw {
+			operands = append(operands, v)
+			continue
+		}
+		switch kw {
+		case "begincodespacerange", "beginbfchar", "beginbfrange":
+			operands = operands[:0]
+			continue
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfStr)
+				hi, ok2 := operands[i+1].(pdfStr)
+				if ok1 && ok2 && len(lo) == len(hi) {
+					space = append(space, codeRange{lo: lo, hi: hi})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok := operands[i].(pdfStr)
+				if !ok {
+					continue
+				}
+				switch dst := operands[i+1].(type) {
+				case pdfStr:
+					m[string(src)] = utf16BE(dst)
+				case pdfName:
+					if r := glyphRune(string(dst)); r != 0 {
+						m[string(src)] = string(r)
+					}
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfStr)
+				hi, ok2 := operands[i+1].(pdfStr)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 {
+					continue
+				}
+				start, end := bytesToInt(lo), bytesToInt(hi)
+				if end < start || end-start > 1<<16 {
+					continue
+				}
+				for c := start; c <= end; c++ {
+					code := intToBytes(c, len(lo))
+					switch dst := operands[i+2].(type) {
+					case pdfStr:
+						m[code] = utf16BE(incrementLast(dst, c-start))
+					case []any:
+						if k := c - start; k < len(dst) {
+							if s, ok := dst[k].(pdfStr); ok {
+								m[code] = utf16BE(s)
+							}
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	// Longer codes first so a 2-byte range is not shadowed by a 1-byte one
+	for i := 1; i < len(space); i++ {
+		for j := i; j > 0 && len(space[j].lo) > len(space[j-1].lo); j-- {
+			space[j], space[j-1] = space[j-1], space[j]
+		}
+	}
+	return m, space
+}
+
+func bytesToInt(b []byte) int {
+	v := 0
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+func intToBytes(v, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return string(b)
+}
+
+func incrementLast(b []byte, by int) []byte {
+	out := append([]byte{}, b...)
+	if len(out) >= 2 {
+		v := int(out[len(out)-2])<<8 | int(out[len(out)-1])
+		v += by
+		out[len(out)-2], out[len(out)-1] = byte(v>>8), byte(v)
+	} else if len(out) == 1 {
+		out[0] += byte(by)
+	}
+	return out
+}
+
+func utf16BE(b []byte) string {
+	if len(b)%2 == 1 {
+		b = append(b, 0)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(u))
+}
+
+// Text strings outside content streams (Info values, outlines): UTF-16BE
+// with a BOM, UTF-8 with a BOM (PDF 2.0), or PDFDocEncoding.
+func textString(v any) string {
+	s, ok := v.(pdfStr)
+	if !ok {
+		return ""
+	}
+	switch {
+	case len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF:
+		return utf16BE(s[2:])
+	case len(s) >= 3 && s[0] == 0xEF && s[1] == 0xBB && s[2] == 0xBF:
+		return string(s[3:])
+	}
+	var b strings.Builder
+	for _, c := range s {
+		if r, ok := pdfDocHigh[c]; ok {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+// PDFDocEncoding differs from Latin-1 only in 0x18-0x1F and 0x80-0x9F.
+var pdfDocHigh = map[byte]rune{
+	0x18: '˘', 0x19: 'ˇ', 0x1A: 'ˆ', 0x1B: '˙', 0x1C: '˝', 0x1D: '˛', 0x1E: '˚', 0x1F: '˜',
+	0x80: '•', 0x81: '†', 0x82: '‡', 0x83: '…', 0x84: '—', 0x85: '–', 0x86: 'ƒ', 0x87: '⁄',
+	0x88: '‹', 0x89: '›', 0x8A: '−', 0x8B: '‰', 0x8C: '„', 0x8D: '“', 0x8E: '”', 0x8F: '‘',
+	0x90: '’', 0x91: '‚', 0x92: '™', 0x93: 'ﬁ', 0x94: 'ﬂ', 0x95: 'Ł', 0x96: 'Œ', 0x97: 'Š',
+	0x98: 'Ÿ', 0x99: 'Ž', 0x9A: 'ı', 0x9B: 'ł', 0x9C: 'œ', 0x9D: 'š', 0x9E: 'ž', 0xA0: '€',
+}
+
+var winAnsi, macRoman = charmapTable(charmap.Windows1252), charmapTable(charmap.Macintosh)
+
+func charmapTable(cm *charmap.Charmap) [256]rune {
+	var t [256]rune
+	for i := range 256 {
+		if r := cm.DecodeByte(byte(i)); r != '\uFFFD' {
+			t[i] = r
+		}
+	}
+	return t
+}
+
+// Adobe glyph names for the characters that show up in Differences arrays.
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$',
+	"percent": '%', "ampersand": '&', "quotesingle": '\'', "parenleft": '(', "parenright": ')',
+	"asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-', "period": '.', "slash": '/',
+	"zero": '0', "one": '1', "two": '2', "three": '3', "four": '4', "five": '5', "six": '6',
+	"seven": '7', "eight": '8', "nine": '9', "colon": ':', "semicolon": ';', "less": '<',
+	"equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[',
+	"backslash": '\\', "bracketright": ']', "asciicircum": '^', "underscore": '_', "grave": '`',
+	"braceleft": '{', "bar": '|', "braceright": '}', "asciitilde": '~',
+	"quoteleft": '‘', "quoteright": '’', "quotedblleft": '“', "quotedblright": '”',
+	"quotesinglbase": '‚', "quotedblbase": '„', "guillemotleft": '«', "guillemotright": '»',
+	"guilsinglleft": '‹', "guilsinglright": '›', "endash": '–', "emdash": '—', "bullet": '•',
+	"ellipsis": '…', "dagger": '†', "daggerdbl": '‡', "trademark": '™', "copyright": '©',
+	"registered": '®', "degree": '°', "section": '§', "paragraph": '¶', "periodcentered": '·',
+	"minus": '−', "multiply": '×', "divide": '÷', "plusminus": '±', "Euro": '€', "sterling": '£',
+	"yen": '¥', "cent": '¢', "currency": '¤', "florin": 'ƒ', "perthousand": '‰', "fraction": '⁄',
+	"germandbls": 'ß', "ae": 'æ', "AE": 'Æ', "oe": 'œ', "OE": 'Œ', "oslash": 'ø', "Oslash": 'Ø',
+	"eth": 'ð', "Eth": 'Ð', "thorn": 'þ', "Thorn": 'Þ', "lslash": 'ł', "Lslash": 'Ł',
+	"dotlessi": 'ı', "mu": 'µ', "nbspace": '\u00a0', "sfthyphen": '\u00ad', "exclamdown": '¡',
+	"questiondown": '¿', "ordfeminine": 'ª', "ordmasculine": 'º', "onehalf": '½',
+	"onequarter": '¼', "threequarters": '¾', "logicalnot": '¬', "brokenbar": '¦',
+	"fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ', "circumflex": 'ˆ', "tilde": '˜',
+	"arrowright": '→', "arrowleft": '←', "checkmark": '✓', "infinity": '∞', "notequal": '≠',
+	"lessequal": '≤', "greaterequal": '≥', "approxequal": '≈',
+}
+
+var accentMarks = map[string]rune{
+	"acute": '\u0301', "grave": '\u0300', "circumflex": '\u0302', "dieresis": '\u0308',
+	"tilde": '\u0303', "ring": '\u030a', "cedilla": '\u0327', "caron": '\u030c',
+	"macron": '\u0304', "breve": '\u0306', "ogonek": '\u0328', "dotaccent": '\u0307',
+	"hungarumlaut": '\u030b',
+}
+
+// Resolves a glyph name: single letters, the table above, uniXXXX/uXXXXXX,
+// accented letters ("eacute") and suffixed variants ("a.sc", "one.oldstyle").
+// Returns 0 when the name carries no meaning (e.g. subset names like "g42").
+func glyphRune(name string) rune {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	if r, ok := glyphNames[name]; ok {
+		return r
+	}
+	if len(name) == 1 {
+		return rune(name[0])
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 {
+		if v, err := strconv.ParseUint(name[3:7], 16, 32); err == nil {
+			return rune(v)
+		}
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7 {
+		if v, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return rune(v)
+		}
+	}
+	if len(name) > 1 {
+		if mark, ok := accentMarks[name[1:]]; ok {
+			composed := norm.NFC.String(string([]rune{rune(name[0]), mark}))
+			if r := []rune(composed); len(r) == 1 {
+				return r[0]
+			}
+		}
+	}
+	return 0
+}
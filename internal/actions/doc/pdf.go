@@ -0,0 +1,519 @@
+package doc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Minimal PDF object model: enough to walk the page tree, decode content
+// streams and read the Info dictionary. Objects are located by scanning for
+// "N G obj" rather than trusting the xref table, which keeps damaged and
+// incrementally updated files readable.
+
+type (
+	pdfName string
+	pdfStr  []byte
+	pdfDict map[string]any
+	pdfRef  struct{ num, gen int }
+	pdfKw   string
+)
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+type pdfFile struct {
+	version string
+	objs    map[int]any
+	trailer pdfDict
+	fonts   map[pdfRef]*pdfFont
+}
+
+var (
+	objHeaderRe = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfHeaderRe = regexp.MustCompile(`%PDF-(\d\.\d)`)
+)
+
+func openPDF(data []byte) (*pdfFile, error) {
+	head := data[:min(len(data), 1024)]
+	m := pdfHeaderRe.FindSubmatch(head)
+	if m == nil {
+		return nil, errors.New("not a PDF file (missing %PDF header)")
+	}
+	f := &pdfFile{version: string(m[1]), objs: map[int]any{}, fonts: map[pdfRef]*pdfFont{}}
+
+	// Later definitions win; pos records where each one was found so objects
+	// unpacked from object streams are ordered against direct ones.
+	pos := map[int]int{}
+	var objStreams []int
+	var trailers []pdfDict
+
+	for i := 0; i < len(data); {
+		loc := objHeaderRe.FindSubmatchIndex(data[i:])
+		if loc == nil {
+			break
+		}
+		start := i + loc[0]
+		num, _ := strconv.Atoi(string(data[i+loc[2] : i+loc[3]]))
+		lx := &lexer{data: data, pos: i + loc[1]}
+		obj, err := lx.object()
+		if err != nil {
+			i = i + loc[1]
+			continue
+		}
+		f.objs[num] = obj
+		pos[num] = start
+		if s, ok := obj.(*pdfStream); ok {
+			switch s.dict["Type"] {
+			case pdfName("ObjStm"):
+				objStreams = append(objStreams, num)
+			case pdfName("XRef"):
+				trailers = append(trailers, s.dict)
+			}
+		}
+		i = max(lx.pos, i+loc[1])
+	}
+	if len(f.objs) == 0 {
+		return nil, errors.New("no PDF objects found")
+	}
+
+	for _, num := range objStreams {
+		s, _ := f.objs[num].(*pdfStream)
+		if s == nil {
+			continue
+		}
+		for n, obj := range f.unpackObjStm(s) {
+			if p, seen := pos[n]; seen && p > pos[num] {
+				continue
+			}
+			f.objs[n] = obj
+			pos[n] = pos[num]
+		}
+	}
+
+	for i := 0; ; {
+		k := bytes.Index(data[i:], []byte("trailer"))
+		if k < 0 {
+			break
+		}
+		lx := &lexer{data: data, pos: i + k + len("trailer")}
+		if d, err := lx.object(); err == nil {
+			if dict, ok := d.(pdfDict); ok {
+				trailers = append(trailers, dict)
+			}
+		}
+		i += k + len("trailer")
+	}
+	for _, t := range trailers {
+		if _, ok := t["Root"]; ok {
+			f.trailer = t
+		}
+	}
+	if f.trailer == nil {
+		// No usable trailer: fall back to the first catalog we can find
+		nums := make([]int, 0, len(f.objs))
+		for n := range f.objs {
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+		for _, n := range nums {
+			if d, ok := f.objs[n].(pdfDict); ok && d["Type"] == pdfName("Catalog") {
+				f.trailer = pdfDict{"Root": pdfRef{num: n}}
+				break
+			}
+		}
+	}
+	if f.trailer == nil {
+		return nil, errors.New("PDF has no document catalog")
+	}
+	if _, ok := f.trailer["Encrypt"]; ok {
+		return nil, errors.New("encrypted PDFs are not supported")
+	}
+	return f, nil
+}
+
+func (f *pdfFile) unpackObjStm(s *pdfStream) map[int]any {
+	data, err := f.decodeStream(s)
+	if err != nil {
+		return nil
+	}
+	n, _ := f.resolve(s.dict["N"]).(int)
+	first, _ := f.resolve(s.dict["First"]).(int)
+	if first <= 0 || first > len(data) {
+		return nil
+	}
+	lx := &lexer{data: data[:first]}
+	type entry struct{ num, off int }
+	entries := make([]entry, 0, n)
+	for range n {
+		a, err1 := lx.object()
+		b, err2 := lx.object()
+		an, ok1 := a.(int)
+		bn, ok2 := b.(int)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			break
+		}
+		entries = append(entries, entry{an, bn})
+	}
+	out := make(map[int]any, len(entries))
+	for _, e := range entries {
+		if first+e.off >= len(data) {
+			continue
+		}
+		lx := &lexer{data: data, pos: first + e.off}
+		if obj, err := lx.object(); err == nil {
+			out[e.num] = obj
+		}
+	}
+	return out
+}
+
+// Follows indirect references (with a hop limit against cycles).
+func (f *pdfFile) resolve(v any) any {
+	for range 32 {
+		r, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = f.objs[r.num]
+	}
+	return nil
+}
+
+func (f *pdfFile) dict(v any) pdfDict {
+	switch t := f.resolve(v).(type) {
+	case pdfDict:
+		return t
+	case *pdfStream:
+		return t.dict
+	}
+	return nil
+}
+
+func (f *pdfFile) array(v any) []any {
+	a, _ := f.resolve(v).([]any)
+	return a
+}
+
+func (f *pdfFile) number(v any) float64 {
+	switch t := f.resolve(v).(type) {
+	case int:
+		return float64(t)
+	case float64:
+		return t
+	}
+	return 0
+}
+
+// ---- lexer ----
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+var errEOF = errors.New("unexpected end of data")
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isSpace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// Reads one object. Operators and keywords come back as pdfKw; the closing
+// delimiters "]" and ">>" as pdfKw too, so callers can detect them.
+func (l *lexer) object() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errEOF
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		return l.name(), nil
+	case c == '(':
+		return l.literalString(), nil
+	case c == '<' && l.peek(1) == '<':
+		l.pos += 2
+		d, err := l.dictBody()
+		if err != nil {
+			return nil, err
+		}
+		return l.maybeStream(d), nil
+	case c == '<':
+		return l.hexString(), nil
+	case c == '>' && l.peek(1) == '>':
+		l.pos += 2
+		return pdfKw(">>"), nil
+	case c == '[':
+		l.pos++
+		var arr []any
+		for {
+			v, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			if v == pdfKw("]") {
+				return arr, nil
+			}
+			arr = append(arr, v)
+		}
+	case c == ']':
+		l.pos++
+		return pdfKw("]"), nil
+	case c == '{' || c == '}' || c == ')' || c == '>':
+		l.pos++
+		return pdfKw(string(c)), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.number(), nil
+	}
+	start := l.pos
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	switch kw := string(l.data[start:l.pos]); kw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		return pdfKw(kw), nil
+	}
+}
+
+func (l *lexer) peek(n int) byte {
+	if l.pos+n < len(l.data) {
+		return l.data[l.pos+n]
+	}
+	return 0
+}
+
+func (l *lexer) name() pdfName {
+	l.pos++
+	var b []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isSpace(c) || isDelim(c) {
+			break
+		}
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return pdfName(b)
+}
+
+func (l *lexer) number() any {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if (c < '0' || c > '9') && c != '.' {
+			break
+		}
+		l.pos++
+	}
+	tok := string(l.data[start:l.pos])
+	n, err := strconv.Atoi(tok)
+	if err != nil {
+		x, _ := strconv.ParseFloat(tok, 64)
+		return x
+	}
+	// "num gen R" is an indirect reference
+	save := l.pos
+	if n >= 0 {
+		l.skipSpace()
+		gs := l.pos
+		for l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '9' {
+			l.pos++
+		}
+		if l.pos > gs {
+			gen, _ := strconv.Atoi(string(l.data[gs:l.pos]))
+			l.skipSpace()
+			if l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+				(l.pos+1 == len(l.data) || isSpace(l.data[l.pos+1]) || isDelim(l.data[l.pos+1])) {
+				l.pos++
+				return pdfRef{num: n, gen: gen}
+			}
+		}
+	}
+	l.pos = save
+	return n
+}
+
+func (l *lexer) literalString() pdfStr {
+	l.pos++
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for k := 0; k < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; k++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+func (l *lexer) hexString() pdfStr {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i+1 < len(digits); i += 2 {
+		v, _ := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		out = append(out, byte(v))
+	}
+	return out
+}
+
+func (l *lexer) dictBody() (pdfDict, error) {
+	d := pdfDict{}
+	for {
+		k, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		if k == pdfKw(">>") {
+			return d, nil
+		}
+		key, ok := k.(pdfName)
+		if !ok {
+			return nil, fmt.Errorf("dictionary key is %T, not a name", k)
+		}
+		v, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		if v == pdfKw(">>") {
+			return d, nil
+		}
+		d[string(key)] = v
+	}
+}
+
+// A dictionary followed by "stream" owns the bytes up to "endstream". /Length
+// is trusted only when it is direct and lands on "endstream".
+func (l *lexer) maybeStream(d pdfDict) any {
+	save := l.pos
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		l.pos = save
+		return d
+	}
+	l.pos += len("stream")
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+	if n, ok := d["Length"].(int); ok && n >= 0 && start+n <= len(l.data) {
+		rest := bytes.TrimLeft(l.data[start+n:min(start+n+64, len(l.data))], " \r\n\t\f\x00")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = start + n
+			l.skipSpace()
+			l.pos += len("endstream")
+			return &pdfStream{dict: d, raw: l.data[start : start+n]}
+		}
+	}
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		l.pos = len(l.data)
+		return &pdfStream{dict: d, raw: l.data[start:]}
+	}
+	raw := l.data[start : start+end]
+	raw = bytes.TrimSuffix(raw, []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	l.pos = start + end + len("endstream")
+	return &pdfStream{dict: d, raw: raw}
+}
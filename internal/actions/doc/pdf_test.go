@@ -0,0 +1,112 @@
+package doc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func pdfText(t *testing.T, payload map[string]any) map[string]any {
+	t.Helper()
+	out, err := HandleDocAction(context.Background(), "pdf_text", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestPDFTextPlain(t *testing.T) {
+	out := pdfText(t, map[string]any{"path": filepath.Join("testdata", "plain.pdf")})
+	if out["page_count"] != 1 {
+		t.Fatalf("page_count = %v", out["page_count"])
+	}
+	text := out["text"].(string)
+	if !strings.Contains(text, "Hello plain PDF") || !strings.Contains(text, "Second line") {
+		t.Fatalf("text = %q", text)
+	}
+	if strings.Contains(text, "--- page") {
+		t.Fatalf("single page got a page marker: %q", text)
+	}
+
+	var meta map[string]any
+	if err := json.Unmarshal([]byte(out["metadata_json"].(string)), &meta); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"title":       "Quarterly report",
+		"author":      "Ada Lovelace",
+		"created":     "2024-01-02T03:04:05Z",
+		"pdf_version": "1.4",
+	}
+	for k, v := range want {
+		if meta[k] != v {
+			t.Errorf("metadata %s = %v, want %v", k, meta[k], v)
+		}
+	}
+}
+
+func TestPDFTextCompressed(t *testing.T) {
+	out := pdfText(t, map[string]any{"path": filepath.Join("testdata", "compressed.pdf")})
+	if out["page_count"] != 2 {
+		t.Fatalf("page_count = %v", out["page_count"])
+	}
+	var pages []docPage
+	if err := json.Unmarshal([]byte(out["pages_json"].(string)), &pages); err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || pages[0].Text != "Compressed page one" {
+		t.Fatalf("pages = %+v", pages)
+	}
+	// A large negative TJ offset is a word gap
+	if pages[1].Text != "Kerned text" {
+		t.Fatalf("page 2 = %q", pages[1].Text)
+	}
+	if !strings.Contains(out["text"].(string), "--- page 2 ---") {
+		t.Fatalf("missing page marker: %q", out["text"])
+	}
+
+	out = pdfText(t, map[string]any{"path": filepath.Join("testdata", "compressed.pdf"), "max_pages": 1})
+	if out["page_count"] != 2 || strings.Contains(out["text"].(string), "Kerned") {
+		t.Fatalf("max_pages=1: %v", out)
+	}
+}
+
+func TestPDFTextDamaged(t *testing.T) {
+	// Without xref and trailer the catalog is still found by scanning objects
+	data, err := os.ReadFile(filepath.Join("testdata", "plain.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cut := data[:bytes.Index(data, []byte("xref"))]
+	out := pdfText(t, map[string]any{"content": string(cut)})
+	if !strings.Contains(out["text"].(string), "Hello plain PDF") {
+		t.Fatalf("text = %q", out["text"])
+	}
+}
+
+func TestPDFTextErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload map[string]any
+		wantErr string
+	}{
+		{"malformed", map[string]any{"path": filepath.Join("testdata", "malformed.pdf")}, "no PDF objects"},
+		{"not a pdf", map[string]any{"content": "hello"}, "missing %PDF header"},
+		{"missing file", map[string]any{"path": filepath.Join("testdata", "nope.pdf")}, "could not read file"},
+		{"bad base64", map[string]any{"content_base64": "%%%"}, "not valid base64"},
+		{"encrypted", map[string]any{"content": "%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\ntrailer\n<< /Root 1 0 R /Encrypt 2 0 R >>\n"}, "encrypted"},
+		{"no pages", map[string]any{"content": "%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n2 0 obj\n<< /Type /Pages /Kids [] /Count 0 >>\nendobj\n"}, "no pages"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := HandleDocAction(context.Background(), "pdf_text", tc.payload)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("error = %v, want one containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
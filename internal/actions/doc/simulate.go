@@ -0,0 +1,23 @@
+package doc
+
+import (
+	"context"
+	"fmt"
+
+	"a-a/internal/utils"
+)
+
+// Documents are read offline; only a url source is fetched.
+func SimulateDocAction(ctx context.Context, operation string, payload map[string]any) ([]utils.Effect, error) {
+	if operation != "pdf_text" && operation != "docx_text" {
+		return nil, fmt.Errorf("unknown doc operation: %s", operation)
+	}
+	if payload["path"] != nil || payload["content_base64"] != nil || payload["content"] != nil {
+		return nil, nil
+	}
+	url, err := utils.GetStringPayload(payload, "url")
+	if err != nil {
+		return nil, fmt.Errorf("payload needs one of path, content_base64, content or url")
+	}
+	return []utils.Effect{utils.NetworkEffect(url, "GET "+url)}, nil
+}
@@ -0,0 +1,539 @@
+package feed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html/charset"
+
+	"a-a/internal/actions/web"
+	"a-a/internal/utils"
+)
+
+const (
+	maxSitemaps    = 50
+	maxSummaryLen  = 1000
+	defaultURLsCap = 5000
+)
+
+type item struct {
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	Published string `json:"published,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+	Author    string `json:"author,omitempty"`
+}
+
+// Either "content" (e.g. @results.<id>.content) or "url" to fetch.
+func loadSource(ctx context.Context, payload map[string]any) (string, string, error) {
+	base, _ := payload["url"].(string)
+	if c, ok := payload["content"].(string); ok && strings.TrimSpace(c) != "" {
+		return c, base, nil
+	}
+	if strings.TrimSpace(base) == "" {
+		return "", "", fmt.Errorf("payload needs either 'content' or 'url'")
+	}
+	content, status, err := web.Get(ctx, base)
+	if err != nil {
+		return "", "", err
+	}
+	if status >= 400 {
+		return "", "", fmt.Errorf("fetch %s: status %d", base, status)
+	}
+	return content, base, nil
+}
+
+func newXMLDecoder(data []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = charset.NewReaderLabel
+	d.Strict = false
+	return d
+}
+
+// Transparently gunzip "sitemap.xml.gz"-style bodies.
+func maybeGunzip(s string) []byte {
+	b := []byte(s)
+	if len(b) > 2 && b[0] == 0x1f && b[1] == 0x8b {
+		if zr, err := gzip.NewReader(bytes.NewReader(b)); err == nil {
+			if out, err := io.ReadAll(io.LimitReader(zr, 50<<20)); err == nil {
+				return out
+			}
+		}
+	}
+	return b
+}
+
+// ---- feed.parse ----
+
+type rssDoc struct {
+	XMLName xml.Name
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items []rssItem `xml:"item"` // RSS 1.0 (RDF) keeps items beside the channel
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	Description string `xml:"description"`
+	Encoded     string `xml:"encoded"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"date"`
+	Author      string `xml:"author"`
+	Creator     string `xml:"creator"`
+}
+
+type atomDoc struct {
+	Title   string      `xml:"title"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	ID        string `xml:"id"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+	Summary   string `xml:"summary"`
+	Content   string `xml:"content"`
+	Authors   []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+}
+
+type jsonFeed struct {
+	Version string `json:"version"`
+	Title   string `json:"title"`
+	Items   []struct {
+		ID            string `json:"id"`
+		URL           string `json:"url"`
+		ExternalURL   string `json:"external_url"`
+		Title         string `json:"title"`
+		Summary       string `json:"summary"`
+		ContentText   string `json:"content_text"`
+		ContentHTML   string `json:"content_html"`
+		DatePublished string `json:"date_published"`
+		Author        *struct {
+			Name string `json:"name"`
+		} `json:"author"`
+		Authors []struct {
+			Name string `json:"name"`
+		} `json:"authors"`
+	} `json:"items"`
+}
+
+// Reads RSS 2.0 / RSS 1.0, Atom or JSON Feed into normalized items.
+// Optional payload: limit (max items), since (drop items published earlier).
+func handleParse(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	content, base, err := loadSource(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	data := maybeGunzip(content)
+
+	var title string
+	var items []item
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		title, items, err = parseJSONFeed(trimmed, base)
+	default:
+		title, items, err = parseXMLFeed(data, base)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s, _ := payload["since"].(string); strings.TrimSpace(s) != "" {
+		since, ok := parseDate(s)
+		if !ok {
+			return nil, fmt.Errorf("since: unrecognized date %q", s)
+		}
+		kept := items[:0]
+		for _, it := range items {
+			if t, ok := parseDate(it.Published); !ok || !t.Before(since) {
+				kept = append(kept, it)
+			}
+		}
+		items = kept
+	}
+	if v, ok := payload["limit"]; ok {
+		if n, err := utils.GetIntPayload(map[string]any{"v": v}, "v"); err == nil && n > 0 && n < len(items) {
+			items = items[:n]
+		}
+	}
+
+	b, _ := json.Marshal(items)
+	return map[string]any{"title": title, "items_json": string(b)}, nil
+}
+
+func parseXMLFeed(data []byte, base string) (string, []item, error) {
+	root, err := rootElement(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("feed.parse: not XML or JSON Feed: %w", err)
+	}
+	switch strings.ToLower(root) {
+	case "feed":
+		var doc atomDoc
+		if err := newXMLDecoder(data).Decode(&doc); err != nil {
+			return "", nil, fmt.Errorf("feed.parse: atom: %w", err)
+		}
+		items := make([]item, 0, len(doc.Entries))
+		for _, e := range doc.Entries {
+			link := ""
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			if link == "" && len(e.Links) > 0 {
+				link = e.Links[0].Href
+			}
+			if link == "" {
+				link = e.ID
+			}
+			summary := e.Summary
+			if strings.TrimSpace(summary) == "" {
+				summary = e.Content
+			}
+			published := e.Published
+			if published == "" {
+				published = e.Updated
+			}
+			var authors []string
+			for _, a := range e.Authors {
+				if n := strings.TrimSpace(a.Name); n != "" {
+					authors = append(authors, n)
+				}
+			}
+			items = append(items, item{
+				Title:     cleanText(e.Title),
+				URL:       utils.Absolute(base, strings.TrimSpace(link)),
+				Published: normalizeDate(published),
+				Summary:   cleanText(summary),
+				Author:    strings.Join(authors, ", "),
+			})
+		}
+		return cleanText(doc.Title), items, nil
+
+	case "rss", "rdf":
+		var doc rssDoc
+		if err := newXMLDecoder(data).Decode(&doc); err != nil {
+			return "", nil, fmt.Errorf("feed.parse: rss: %w", err)
+		}
+		raw := append(doc.Channel.Items, doc.Items...)
+		items := make([]item, 0, len(raw))
+		for _, it := range raw {
+			link := strings.TrimSpace(it.Link)
+			if link == "" && strings.HasPrefix(strings.TrimSpace(it.GUID), "http") {
+				link = strings.TrimSpace(it.GUID)
+			}
+			summary := it.Description
+			if strings.TrimSpace(summary) == "" {
+				summary = it.Encoded
+			}
+			published := it.PubDate
+			if published == "" {
+				published = it.Date
+			}
+			author := it.Creator
+			if author == "" {
+				author = it.Author
+			}
+			items = append(items, item{
+				Title:     cleanText(it.Title),
+				URL:       utils.Absolute(base, link),
+				Published: normalizeDate(published),
+				Summary:   cleanText(summary),
+				Author:    strings.TrimSpace(author),
+			})
+		}
+		return cleanText(doc.Channel.Title), items, nil
+
+	default:
+		return "", nil, fmt.Errorf("feed.parse: unsupported root element <%s>", root)
+	}
+}
+
+func parseJSONFeed(data []byte, base string) (string, []item, error) {
+	var f jsonFeed
+	if err := json.Unmarshal(data, &f); err != nil {
+		return "", nil, fmt.Errorf("feed.parse: json feed: %w", err)
+	}
+	if !strings.Contains(f.Version, "jsonfeed.org") {
+		return "", nil, fmt.Errorf("feed.parse: JSON document is not a JSON Feed")
+	}
+	items := make([]item, 0, len(f.Items))
+	for _, it := range f.Items {
+		link := it.URL
+		if link == "" {
+			link = it.ExternalURL
+		}
+		summary := it.Summary
+		if summary == "" {
+			summary = it.ContentText
+		}
+		if summary == "" {
+			summary = it.ContentHTML
+		}
+		var authors []string
+		if it.Author != nil && it.Author.Name != "" {
+			authors = append(authors, it.Author.Name)
+		}
+		for _, a := range it.Authors {
+			if a.Name != "" {
+				authors = append(authors, a.Name)
+			}
+		}
+		items = append(items, item{
+			Title:     cleanText(it.Title),
+			URL:       utils.Absolute(base, link),
+			Published: normalizeDate(it.DatePublished),
+			Summary:   cleanText(summary),
+			Author:    strings.Join(authors, ", "),
+		})
+	}
+	return f.Title, items, nil
+}
+
+func rootElement(data []byte) (string, error) {
+	d := newXMLDecoder(data)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", err
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			return se.Name.Local, nil
+		}
+	}
+}
+
+// Strips markup from (possibly HTML) text and collapses whitespace.
+func cleanText(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "<") {
+		if doc, err := goquery.NewDocumentFromReader(strings.NewReader(s)); err == nil {
+			s = doc.Text()
+		}
+	}
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > maxSummaryLen {
+		cut := maxSummaryLen
+		for cut > 0 && !utf8Start(s[cut]) {
+			cut--
+		}
+		s = s[:cut] + "..."
+	}
+	return s
+}
+
+func utf8Start(b byte) bool { return b&0xC0 != 0x80 }
+
+var dateLayouts = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, l := range dateLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// RFC3339 when parseable, else the original string.
+func normalizeDate(s string) string {
+	if t, ok := parseDate(s); ok {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return strings.TrimSpace(s)
+}
+
+// ---- feed.sitemap ----
+
+type sitemapDoc struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `json:"loc"`
+	LastMod string `json:"lastmod,omitempty"`
+}
+
+// Expands a sitemap (or sitemap index, recursively) into page URLs.
+// Optional payload:
+//
+//	lastmod_after: keep entries modified at/after this date (entries without lastmod are kept)
+//	include:       substring an entry URL must contain
+//	limit:         max URLs returned (default 5000)
+//	max_sitemaps:  max sitemap documents fetched (default 50)
+func handleSitemap(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	content, base, err := loadSource(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var after time.Time
+	hasAfter := false
+	if s, _ := payload["lastmod_after"].(string); strings.TrimSpace(s) != "" {
+		t, ok := parseDate(s)
+		if !ok {
+			return nil, fmt.Errorf("lastmod_after: unrecognized date %q", s)
+		}
+		after, hasAfter = t, true
+	}
+	include, _ := payload["include"].(string)
+	limit := defaultURLsCap
+	if v, ok := payload["limit"]; ok {
+		if n, err := utils.GetIntPayload(map[string]any{"v": v}, "v"); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	budget := maxSitemaps
+	if v, ok := payload["max_sitemaps"]; ok {
+		if n, err := utils.GetIntPayload(map[string]any{"v": v}, "v"); err == nil && n > 0 {
+			budget = n
+		}
+	}
+
+	fresh := func(lastmod string) bool {
+		if !hasAfter || strings.TrimSpace(lastmod) == "" {
+			return true
+		}
+		t, ok := parseDate(lastmod)
+		return !ok || !t.Before(after)
+	}
+
+	var out []sitemapEntry
+	seen := map[string]struct{}{}
+	skipped := []string{}
+
+	queue := []struct{ url, content string }{{base, content}}
+	visited := map[string]struct{}{}
+	for len(queue) > 0 && len(out) < limit {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		cur := queue[0]
+		queue = queue[1:]
+
+		body := cur.content
+		if body == "" {
+			if budget <= 0 {
+				skipped = append(skipped, cur.url)
+				continue
+			}
+			budget--
+			c, status, err := web.Get(ctx, cur.url)
+			if err != nil || status >= 400 {
+				skipped = append(skipped, cur.url)
+				continue
+			}
+			body = c
+		}
+
+		var doc sitemapDoc
+		if err := newXMLDecoder(maybeGunzip(body)).Decode(&doc); err != nil {
+			if cur.content != "" {
+				return nil, fmt.Errorf("feed.sitemap: parse: %w", err)
+			}
+			skipped = append(skipped, cur.url)
+			continue
+		}
+
+		for _, sm := range doc.Sitemaps {
+			loc := utils.Absolute(cur.url, strings.TrimSpace(sm.Loc))
+			if _, ok := visited[loc]; ok || loc == "" || !fresh(sm.LastMod) {
+				continue
+			}
+			visited[loc] = struct{}{}
+			queue = append(queue, struct{ url, content string }{loc, ""})
+		}
+		for _, u := range doc.URLs {
+			loc := utils.Absolute(cur.url, strings.TrimSpace(u.Loc))
+			if loc == "" || !fresh(u.LastMod) {
+				continue
+			}
+			if include != "" && !strings.Contains(loc, include) {
+				continue
+			}
+			if _, ok := seen[loc]; ok {
+				continue
+			}
+			seen[loc] = struct{}{}
+			out = append(out, sitemapEntry{Loc: loc, LastMod: normalizeDate(u.LastMod)})
+			if len(out) >= limit {
+				break
+			}
+		}
+	}
+
+	urls := make([]string, 0, len(out))
+	for _, e := range out {
+		urls = append(urls, e.Loc)
+	}
+	be, _ := json.Marshal(out)
+	bu, _ := json.Marshal(urls)
+	bs, _ := json.Marshal(append(skipped, queueURLs(queue)...))
+	return map[string]any{
+		"entries_json": string(be),
+		"urls_json":    string(bu),
+		"skipped_json": string(bs),
+	}, nil
+}
+
+func queueURLs(q []struct{ url, content string }) []string {
+	out := make([]string, 0, len(q))
+	for _, e := range q {
+		out = append(out, e.url)
+	}
+	return out
+}
+
+func HandleFeedAction(ctx context.Context, operation string, payload map[string]any) (map[string]any, error) {
+	switch operation {
+	case "parse":
+		return handleParse(ctx, payload)
+	case "sitemap":
+		return handleSitemap(ctx, payload)
+	default:
+		return nil, fmt.Errorf("unknown feed operation: %s", operation)
+	}
+}
@@ -0,0 +1,29 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"a-a/internal/utils"
+)
+
+// Reports the host a feed or sitemap is fetched from (nothing for content
+// passed in the payload).
+func SimulateFeedAction(ctx context.Context, operation string, payload map[string]any) ([]utils.Effect, error) {
+	if operation != "parse" && operation != "sitemap" {
+		return nil, fmt.Errorf("unknown feed operation: %s", operation)
+	}
+	if c, ok := payload["content"].(string); ok && strings.TrimSpace(c) != "" {
+		return nil, nil
+	}
+	url, _ := payload["url"].(string)
+	if strings.TrimSpace(url) == "" {
+		return nil, fmt.Errorf("payload needs either 'content' or 'url'")
+	}
+	e := utils.NetworkEffect(url, "GET "+url)
+	if operation == "sitemap" {
+		e.Detail += " and nested sitemaps"
+	}
+	return []utils.Effect{e}, nil
+}
@@ -6,99 +6,143 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"a-a/internal/actions/archive"
+	"a-a/internal/actions/ask"
+	"a-a/internal/actions/doc"
+	"a-a/internal/actions/feed"
+	"a-a/internal/actions/format"
 	"a-a/internal/actions/html"
+	jsonact "a-a/internal/actions/json"
 	"a-a/internal/actions/list"
 	"a-a/internal/actions/llm"
 	"a-a/internal/actions/system"
 	"a-a/internal/actions/test"
+	"a-a/internal/actions/text"
 	"a-a/internal/actions/url"
 	"a-a/internal/actions/web"
+	"a-a/internal/metrics"
 	"a-a/internal/parser"
+	"a-a/internal/utils"
 
 	"golang.org/x/sync/errgroup"
 )
 
 const (
-	foreachConcurrency = 8
-	defaultInnerMs     = 30000
+	foreachConcurrency    = 8
+	foreachMaxConcurrency = 64
+	foreachMaxRetries     = 5
+	defaultInnerMs        = 30000
 )
 
 func HandleFlowAction(ctx context.Context, operation string, payload map[string]any) (map[string]any, error) {
 	switch operation {
 	case "foreach":
 		return foreach(ctx, payload)
+	case "if":
+		return ifElse(ctx, payload)
+	case "while":
+		return whileLoop(ctx, payload)
+	case "paginate":
+		return paginate(ctx, payload)
+	case "mission":
+		return subMission(ctx, payload)
 	default:
 		return nil, fmt.Errorf("unknown flow operation: %s", operation)
 	}
 }
 
-// Applies a single-item action template to each element of items_json.
+// Applies a template to each element of items_json.
 // Required payload:
 //
 //	items_json: JSON array string or slice
-//	template:   { action: "<category.op>", payload: { ... }, id_prefix: "task_" }
+//	template:   a single action { action: "<category.op>", payload: { ... }, id_prefix: "task_" }
+//	            or a mini-plan run per item:
+//	            { plan: [ {stage, actions: [...]}, ... ], output: "<action id>" }
+//	            { actions: [ ... ] }  (shorthand: one action per stage)
 //
-// Currently hardcoded settings:
-//   - concurrency: 8
-//   - on_error:    "continue" (collect failures; do NOT fail-fast)
+// {{item}} and {{item.field}} are replaced in every string of the template
+// (payloads and "when" guards, which may also use item.<field> directly).
+// Inside a mini-plan, @results.<id> resolves to the item's own actions first
+// and to the mission's results otherwise; nothing is published to the
+// mission. Flow actions may be nested up to 3 levels.
+//
+// Optional payload:
+//
+//	concurrency:    items in flight (default 8, max 64)
+//	on_error:       "continue" (default; failures go to errors_json), "fail_fast"
+//	                (the action fails on the first failed item) or a percentage
+//	                such as "20%" (fails once more than that share of items failed;
+//	                "0%" is the same as "fail_fast")
+//	retries:        extra attempts per failed item (default 0, max 5)
+//	backoff_ms:     wait before the first retry, doubled each time (default 500)
+//	preserve_order: results_json[i] belongs to items[i], null when it failed (default false)
+//	include_item:   wrap each result as {index, id, item, result} (default false)
+//	id_prefix:      item ID prefix used in errors and metrics (default template.id_prefix or "task_")
 //
 // Output:
 //
-//	{ "results_json": "<JSON array of inner outputs>", "errors_json": "<JSON array of {item,error}>" }
+//	{
+//	  "results_json": "<JSON array of inner outputs; for mini-plans {id: output} per item, or the output of template.output>",
+//	  "errors_json":  "<JSON array of {index,id,item,error,attempts}>",
+//	  "metrics_json": "<JSON array of {id,index,duration_ms,attempts,success,err}>",
+//	  "succeeded":    int,
+//	  "failed":       int
+//	}
 func foreach(parentCtx context.Context, payload map[string]any) (map[string]any, error) {
 	items, err := coerceToSlice(payload["items_json"])
 	if err != nil {
 		return nil, fmt.Errorf("flow.foreach: invalid items_json: %w", err)
 	}
-	if len(items) == 0 {
-		return map[string]any{"results_json": "[]", "errors_json": "[]"}, nil
-	}
 
 	tplRaw, ok := payload["template"].(map[string]any)
 	if !ok {
 		return nil, errors.New("flow.foreach: payload.template must be an object")
 	}
-	tplAction, _ := tplRaw["action"].(string)
-	if strings.TrimSpace(tplAction) == "" {
-		return nil, errors.New("flow.foreach: template.action is required")
-	}
-	tplPayload, ok := tplRaw["payload"].(map[string]any)
-	if !ok {
-		return nil, errors.New("flow.foreach: template.payload must be an object")
-	}
-	idPrefix, _ := tplRaw["id_prefix"].(string)
-	if idPrefix == "" {
-		idPrefix = "task_"
+	opts, err := foreachOptionsOf(payload, tplRaw)
+	if err != nil {
+		return nil, fmt.Errorf("flow.foreach: %w", err)
 	}
-
-	// Derive per-item timeout from registry default of the template action
-	perItemTimeout := time.Duration(defaultInnerMs) * time.Millisecond
-	if def, ok := parser.GetActionDefinition(tplAction); ok && def.DefaultTimeoutMs > 0 {
-		perItemTimeout = time.Duration(def.DefaultTimeoutMs) * time.Millisecond
+	run, err := itemRunner(parentCtx, tplRaw)
+	if err != nil {
+		return nil, fmt.Errorf("flow.foreach: %w", err)
 	}
 
 	// Parent context for the batch
 	baseCtx, cancel := context.WithCancel(parentCtx)
 	defer cancel()
 
-	type okOut map[string]any
 	type errOut struct {
-		Item  any    `json:"item"`
-		Error string `json:"error"`
+		Index    int    `json:"index"`
+		ID       string `json:"id"`
+		Item     any    `json:"item"`
+		Error    string `json:"error"`
+		Attempts int    `json:"attempts"`
 	}
 
-	okResults := make([]okOut, len(items))
+	okResults := make([]any, len(items))
+	succeeded := make([]bool, len(items))
 	errResults := make([]errOut, 0, 4)
+	itemMetrics := make([]metrics.ItemMetrics, 0, len(items))
+	var abortErr error
 	var mu sync.Mutex
 
+	// Items are reported to the executor's recorder, present only when this
+	// foreach is the executor's own action (dispatch hides it from inner ones)
+	rec := metrics.ItemRecorderFromContext(parentCtx)
+	if rec != nil {
+		rec.SetTotal(len(items))
+	}
+	itemsCtx := metrics.WithItemRecorder(baseCtx, nil)
+
 	// Bounded concurrency with errgroup
-	g, gctx := errgroup.WithContext(baseCtx)
-	g.SetLimit(foreachConcurrency)
+	g, gctx := errgroup.WithContext(itemsCtx)
+	g.SetLimit(opts.concurrency)
 
 	for i := range items {
 		idx := i
@@ -110,59 +154,358 @@ func foreach(parentCtx context.Context, payload map[string]any) (map[string]any,
 			}
 
 			item := items[idx]
-			itemID := fmt.Sprintf("%s%04d", idPrefix, idx+1)
-
-			// Build per-item payload (deep copy + placeholder substitution)
-			itemPayload := deepCopyJSON(tplPayload).(map[string]any)
-			if v := substituteItemPlaceholders(itemPayload, item); v != nil {
-				mp, ok := v.(map[string]any)
-				if !ok {
-					mu.Lock()
-					errResults = append(errResults, errOut{Item: item, Error: "template.payload not object after substitution"})
-					mu.Unlock()
-					return nil // swallow error to continue batch
-				}
-				itemPayload = mp
-			}
-
-			// Execute inner action with per-item timeout
-			itemCtx, itemCancel := context.WithTimeout(gctx, perItemTimeout)
-			defer itemCancel()
-
-			out, err := dispatch(itemCtx, tplAction, itemPayload)
+			itemID := fmt.Sprintf("%s%04d", opts.idPrefix, idx+1)
+			start := time.Now()
+			out, attempts, err := runWithRetries(gctx, run, item, opts)
+			im := metrics.ItemMetrics{ID: itemID, Index: idx, DurationMs: time.Since(start).Milliseconds(), Attempts: attempts, Success: err == nil}
 
 			mu.Lock()
+			defer mu.Unlock()
 			if err != nil {
-				errResults = append(errResults, errOut{Item: item, Error: err.Error()})
-				mu.Unlock()
-				return nil // Keep iterating other items
+				if gctx.Err() != nil && abortErr != nil {
+					return nil // cancelled by another item's failure
+				}
+				im.Err = err.Error()
+				itemMetrics = append(itemMetrics, im)
+				if rec != nil {
+					rec.Record(im)
+				}
+				errResults = append(errResults, errOut{Index: idx, ID: itemID, Item: item, Error: err.Error(), Attempts: attempts})
+				if abortErr == nil {
+					abortErr = opts.abort(len(errResults), len(items), itemID, err)
+				}
+				if abortErr != nil {
+					cancel()
+				}
+				return nil // Keep iterating other items unless the policy says otherwise
+			}
+			itemMetrics = append(itemMetrics, im)
+			if rec != nil {
+				rec.Record(im)
+			}
+			succeeded[idx] = true
+			if opts.includeItem {
+				okResults[idx] = map[string]any{"index": idx, "id": itemID, "item": item, "result": out}
+			} else {
+				okResults[idx] = out
 			}
-			okResults[idx] = out
-			mu.Unlock()
-
-			_ = itemID
 			return nil
 		})
 	}
 
-	_ = g.Wait() // Item errors are recorded, never abort the batch
+	_ = g.Wait() // Item errors are recorded; the policy decides below
+	if abortErr != nil {
+		return nil, fmt.Errorf("flow.foreach: %w", abortErr)
+	}
+	if err := parentCtx.Err(); err != nil {
+		return nil, err
+	}
 
-	compact := make([]okOut, 0, len(okResults))
-	for _, r := range okResults {
-		if r != nil {
-			compact = append(compact, r)
+	results := make([]any, 0, len(okResults))
+	for i, r := range okResults {
+		if succeeded[i] || opts.preserveOrder {
+			results = append(results, r)
 		}
 	}
-	bOK, _ := json.Marshal(compact)
+	sort.Slice(errResults, func(i, j int) bool { return errResults[i].Index < errResults[j].Index })
+	sort.Slice(itemMetrics, func(i, j int) bool { return itemMetrics[i].Index < itemMetrics[j].Index })
+	bOK, _ := json.Marshal(results)
 	bErr, _ := json.Marshal(errResults)
+	bMet, _ := json.Marshal(itemMetrics)
 
 	return map[string]any{
 		"results_json": string(bOK),
 		"errors_json":  string(bErr),
+		"metrics_json": string(bMet),
+		"succeeded":    len(items) - len(errResults),
+		"failed":       len(errResults),
+	}, nil
+}
+
+type foreachOptions struct {
+	concurrency   int
+	failFast      bool
+	thresholdPct  float64 // > 0: fail once failures exceed this share
+	retries       int
+	backoff       time.Duration
+	preserveOrder bool
+	includeItem   bool
+	idPrefix      string
+}
+
+func foreachOptionsOf(payload, tpl map[string]any) (foreachOptions, error) {
+	o := foreachOptions{concurrency: foreachConcurrency, backoff: 500 * time.Millisecond, idPrefix: "task_"}
+	if p, _ := tpl["id_prefix"].(string); p != "" {
+		o.idPrefix = p
+	}
+	if p, _ := payload["id_prefix"].(string); p != "" {
+		o.idPrefix = p
+	}
+	intOpt := func(key string, lo, hi int, dst *int) error {
+		v, ok := payload[key]
+		if !ok {
+			return nil
+		}
+		n, err := utils.GetIntPayload(map[string]any{"v": v}, "v")
+		if err != nil || n < lo {
+			return fmt.Errorf("%s must be an integer >= %d", key, lo)
+		}
+		*dst = min(n, hi)
+		return nil
+	}
+	if err := intOpt("concurrency", 1, foreachMaxConcurrency, &o.concurrency); err != nil {
+		return o, err
+	}
+	if err := intOpt("retries", 0, foreachMaxRetries, &o.retries); err != nil {
+		return o, err
+	}
+	backoffMs := int(o.backoff / time.Millisecond)
+	if err := intOpt("backoff_ms", 0, 30000, &backoffMs); err != nil {
+		return o, err
+	}
+	o.backoff = time.Duration(backoffMs) * time.Millisecond
+	o.preserveOrder, _ = payload["preserve_order"].(bool)
+	o.includeItem, _ = payload["include_item"].(bool)
+
+	hasThreshold := true
+	switch v := payload["on_error"].(type) {
+	case nil:
+		hasThreshold = false
+	case float64:
+		o.thresholdPct = v
+	case int:
+		o.thresholdPct = float64(v)
+	case string:
+		s := strings.ToLower(strings.TrimSpace(v))
+		switch s {
+		case "", "continue":
+			hasThreshold = false
+		case "fail_fast":
+			hasThreshold = false
+			o.failFast = true
+		default:
+			pct, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+			if err != nil {
+				return o, fmt.Errorf(`on_error must be "continue", "fail_fast" or a percentage like "20%%", got %q`, v)
+			}
+			o.thresholdPct = pct
+		}
+	default:
+		return o, fmt.Errorf("on_error must be a string, got %T", v)
+	}
+	if o.thresholdPct < 0 || o.thresholdPct > 100 {
+		return o, fmt.Errorf("on_error threshold must be between 0%% and 100%%")
+	}
+	if hasThreshold && o.thresholdPct == 0 {
+		o.failFast = true // more than 0% failed = any failure
+	}
+	return o, nil
+}
+
+// Reports why the batch must stop after failed failures out of total, or nil.
+func (o foreachOptions) abort(failed, total int, itemID string, err error) error {
+	switch {
+	case o.failFast:
+		return fmt.Errorf("item %s failed: %w", itemID, err)
+	case o.thresholdPct > 0 && float64(failed)*100 > o.thresholdPct*float64(total):
+		return fmt.Errorf("%d of %d items failed, more than the %g%% on_error threshold (last: %s: %v)", failed, total, o.thresholdPct, itemID, err)
+	}
+	return nil
+}
+
+// Runs one item, retrying failures with exponential backoff.
+func runWithRetries(ctx context.Context, run func(context.Context, any) (map[string]any, error), item any, o foreachOptions) (map[string]any, int, error) {
+	wait := o.backoff
+	for attempt := 1; ; attempt++ {
+		out, err := run(ctx, item)
+		if err == nil || attempt > o.retries || ctx.Err() != nil {
+			return out, attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, attempt, err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// Builds the per-item function for a foreach template.
+func itemRunner(ctx context.Context, tpl map[string]any) (func(context.Context, any) (map[string]any, error), error) {
+	stages, isPlan, err := parser.TemplatePlan(tpl)
+	if err != nil {
+		return nil, err
+	}
+	if isPlan {
+		output, _ := tpl["output"].(string)
+		mission := utils.ResultsFromContext(ctx)
+		return func(ctx context.Context, item any) (map[string]any, error) {
+			return runItemPlan(ctx, stages, output, mission, item)
+		}, nil
+	}
+
+	tplAction, _ := tpl["action"].(string)
+	if strings.TrimSpace(tplAction) == "" {
+		return nil, errors.New("template.action is required")
+	}
+	tplPayload, ok := tpl["payload"].(map[string]any)
+	if !ok {
+		return nil, errors.New("template.payload must be an object")
+	}
+
+	// Derive per-item timeout from registry default of the template action
+	perItemTimeout := time.Duration(defaultInnerMs) * time.Millisecond
+	if def, ok := parser.GetActionDefinition(tplAction); ok && def.DefaultTimeoutMs > 0 {
+		perItemTimeout = time.Duration(def.DefaultTimeoutMs) * time.Millisecond
+	}
+
+	return func(ctx context.Context, item any) (map[string]any, error) {
+		// Build per-item payload (deep copy + placeholder substitution)
+		itemPayload := itemPayloadFor(tplAction, tplPayload, item)
+		itemCtx, cancel := context.WithTimeout(ctx, perItemTimeout)
+		defer cancel()
+		return dispatch(itemCtx, tplAction, itemPayload)
 	}, nil
 }
 
+// Copies payload with {{item}} placeholders filled in, leaving the template
+// of a nested flow.foreach for its own items.
+func itemPayloadFor(action string, payload map[string]any, item any) map[string]any {
+	out, _ := deepCopyJSON(payload).(map[string]any)
+	if out == nil {
+		out = map[string]any{}
+	}
+	for k, v := range out {
+		if action == "flow.foreach" && k == "template" {
+			continue
+		}
+		out[k] = substituteItemPlaceholders(v, item)
+	}
+	return out
+}
+
+// Runs a template mini-plan for one item with its own @results scope on top
+// of a snapshot of the mission's results.
+func runItemPlan(ctx context.Context, stages []parser.ExecutionStage, output string, mission *utils.Results, item any) (map[string]any, error) {
+	scope := map[string]map[string]any{}
+	if mission != nil {
+		scope = mission.Snapshot()
+	}
+	scope = parser.WithScope(scope, map[string]any{"item": item})
+	local := make([]parser.ExecutionStage, len(stages))
+	for i, st := range stages {
+		local[i] = parser.ExecutionStage{Stage: st.Stage, Actions: make([]parser.Action, len(st.Actions))}
+		for j, a := range st.Actions {
+			a.Payload = itemPayloadFor(a.Action, a.Payload, item)
+			a.When = replaceItemPlaceholdersInString(a.When, item)
+			local[i].Actions[j] = a
+		}
+	}
+
+	outputs, _, err := runPlan(ctx, local, utils.NewResults(scope, &sync.Mutex{}))
+	if err != nil {
+		return nil, err
+	}
+	if output != "" {
+		out, ok := outputs[output]
+		if !ok {
+			return nil, fmt.Errorf("template.output '%s' produced no output (skipped?)", output)
+		}
+		return out, nil
+	}
+	combined := make(map[string]any, len(outputs))
+	for id, out := range outputs {
+		combined[id] = out
+	}
+	return combined, nil
+}
+
+type skippedOut struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// Runs one of two action lists depending on a condition.
+// Required payload:
+//
+//	condition: expression over @results, e.g. "@results.fetch.status_code == 200"
+//	           or "len(@results.links.links_json) > 0" (same syntax as "when")
+//	then:      array of actions ({id, action, payload, when?}) run when it holds
+//
+// Optional payload:
+//
+//	else: array of actions run otherwise
+//
+// Branch actions run in order, may reference each other's @results and honour
+// their own "when". Their outputs are published under their IDs for later
+// stages; actions of the branch not taken are recorded as skipped.
+//
+// Output:
+//
+//	{
+//	  "branch":       "then" | "else",
+//	  "condition":    bool,
+//	  "results_json": "<{id: output}>",
+//	  "skipped_json": "<[{id, reason}]>"
+//	}
+func ifElse(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	src, err := utils.GetStringPayload(payload, "condition")
+	if err != nil {
+		return nil, err
+	}
+	cond, err := parser.ParseCondition(src)
+	if err != nil {
+		return nil, fmt.Errorf("flow.if: %w", err)
+	}
+	thenActs, err := parser.BranchActions(payload["then"])
+	if err != nil {
+		return nil, fmt.Errorf("flow.if: then: %w", err)
+	}
+	elseActs, err := parser.BranchActions(payload["else"])
+	if err != nil {
+		return nil, fmt.Errorf("flow.if: else: %w", err)
+	}
+
+	results := utils.ResultsFromContext(ctx)
+	if results == nil {
+		results = utils.NewResults(map[string]map[string]any{}, &sync.Mutex{})
+	}
+	holds, err := cond.Eval(results.Snapshot())
+	if err != nil {
+		return nil, fmt.Errorf("flow.if: %w", err)
+	}
+	branch, run, other := "then", thenActs, elseActs
+	if !holds {
+		branch, run, other = "else", elseActs, thenActs
+	}
+
+	skipped := []skippedOut{}
+	for _, a := range other {
+		reason := "flow.if took the " + branch + " branch"
+		results.Skip(a.ID, reason)
+		skipped = append(skipped, skippedOut{ID: a.ID, Reason: reason})
+	}
+	outputs, ranSkipped, err := runPlan(ctx, sequential(run), results)
+	if err != nil {
+		return nil, fmt.Errorf("flow.if: %s: %w", branch, err)
+	}
+	skipped = append(skipped, ranSkipped...)
+
+	bRes, _ := json.Marshal(outputs)
+	bSkip, _ := json.Marshal(skipped)
+	return map[string]any{
+		"branch":       branch,
+		"condition":    holds,
+		"results_json": string(bRes),
+		"skipped_json": string(bSkip),
+	}, nil
+}
+
+// Runs an inner action. The executor's item recorder belongs to its own
+// top-level action, so a nested flow.foreach (in a branch, loop or template)
+// does not report into it.
 func dispatch(ctx context.Context, fullAction string, payload map[string]any) (map[string]any, error) {
+	ctx = metrics.WithItemRecorder(ctx, nil)
 	parts := strings.Split(fullAction, ".")
 	if len(parts) != 2 {
 		return nil, fmt.Errorf("invalid action name %q; expected category.operation", fullAction)
@@ -183,8 +526,26 @@ func dispatch(ctx context.Context, fullAction string, payload map[string]any) (m
 		return url.HandleURLAction(ctx, op, payload)
 	case "list":
 		return list.HandleListAction(ctx, op, payload)
+	case "feed":
+		return feed.HandleFeedAction(ctx, op, payload)
+	case "json":
+		return jsonact.HandleJSONAction(ctx, op, payload)
+	case "text":
+		return text.HandleTextAction(ctx, op, payload)
+	case "format":
+		return format.HandleFormatAction(ctx, op, payload)
+	case "archive":
+		return archive.HandleArchiveAction(ctx, op, payload)
+	case "doc":
+		return doc.HandleDocAction(ctx, op, payload)
+	case "ask":
+		return ask.HandleAskAction(ctx, op, payload)
 	case "flow":
-		return nil, errors.New("flow.foreach does not support nesting flow actions")
+		depth := flowDepth(ctx) + 1
+		if depth > maxFlowDepth {
+			return nil, fmt.Errorf("flow actions nested more than %d levels deep", maxFlowDepth)
+		}
+		return HandleFlowAction(context.WithValue(ctx, flowDepthKey{}, depth), op, payload)
 	default:
 		return nil, fmt.Errorf("unknown action category: %s", category)
 	}
@@ -256,16 +617,26 @@ func replaceItemPlaceholdersInString(s string, item any) string {
 		}
 		path := strings.TrimSpace(sub[1])
 		if path == "" {
-			return fmt.Sprintf("%v", item)
+			return placeholderText(item)
 		}
 		val, ok := getByPath(item, path)
 		if !ok {
 			return ""
 		}
-		return fmt.Sprintf("%v", val)
+		return placeholderText(val)
 	})
 }
 
+// Objects and arrays are inserted as JSON, everything else with %v.
+func placeholderText(v any) string {
+	switch v.(type) {
+	case map[string]any, []any:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
 // Support simple dotted paths for map[string]any / nested objects / arrays by numeric index.
 func getByPath(root any, path string) (any, bool) {
 	cur := root
@@ -0,0 +1,389 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"a-a/internal/actions/web"
+	"a-a/internal/parser"
+	"a-a/internal/utils"
+)
+
+const (
+	loopDefaultIterations = 10
+	loopMaxIterations     = 200
+)
+
+// A loop repeatedly runs one action, feeding each output into the next
+// iteration as {{prev.<key>}}.
+type loop struct {
+	action  string
+	payload map[string]any
+	initial map[string]any
+	while   *parser.Condition // checked before each iteration
+	until   *parser.Condition // checked after each iteration
+	max     int
+	after   func(out map[string]any)        // enriches an iteration's output
+	stop    func(out map[string]any) string // non-empty reason ends the loop
+}
+
+type loopResult struct {
+	outputs    []map[string]any
+	stopReason string
+	err        error // failure that ended the loop after at least one iteration
+}
+
+func (l *loop) run(ctx context.Context) (*loopResult, error) {
+	results := utils.ResultsFromContext(ctx)
+	if results == nil {
+		results = utils.NewResults(map[string]map[string]any{}, &sync.Mutex{})
+	}
+	timeout := time.Duration(defaultInnerMs) * time.Millisecond
+	if def, ok := parser.GetActionDefinition(l.action); ok && def.DefaultTimeoutMs > 0 {
+		timeout = time.Duration(def.DefaultTimeoutMs) * time.Millisecond
+	}
+
+	res := &loopResult{outputs: []map[string]any{}}
+	prev := l.initial
+	for i := 0; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if i >= l.max {
+			res.stopReason = "max_iterations"
+			return res, nil
+		}
+		snap := results.Snapshot()
+		if l.while != nil {
+			ok, err := l.while.Eval(parser.WithScope(snap, map[string]any{"prev": prev, "iteration": i}))
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				res.stopReason = "while"
+				return res, nil
+			}
+		}
+
+		payload := substitutePrevPlaceholders(deepCopyJSON(l.payload), prev, i+1).(map[string]any)
+		payload = parser.ResolvePayload(payload, snap, parser.RawPayloadKeys(l.action)...)
+		itCtx, cancel := context.WithTimeout(ctx, timeout)
+		out, err := dispatch(itCtx, l.action, payload)
+		cancel()
+		if err != nil {
+			if i == 0 || ctx.Err() != nil {
+				return nil, fmt.Errorf("iteration %d: %w", i+1, err)
+			}
+			res.stopReason, res.err = "error", fmt.Errorf("iteration %d: %w", i+1, err)
+			return res, nil
+		}
+		if out == nil {
+			out = map[string]any{}
+		}
+		if l.after != nil {
+			l.after(out)
+		}
+		res.outputs = append(res.outputs, out)
+		prev = out
+
+		if l.until != nil {
+			ok, err := l.until.Eval(parser.WithScope(results.Snapshot(), map[string]any{"prev": prev, "iteration": i + 1}))
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				res.stopReason = "until"
+				return res, nil
+			}
+		}
+		if l.stop != nil {
+			if reason := l.stop(out); reason != "" {
+				res.stopReason = reason
+				return res, nil
+			}
+		}
+	}
+}
+
+// Repeats a template action, passing each output to the next iteration.
+// Required payload:
+//
+//	template: { action: "<category.op>", payload: { ... } }; string leaves may use
+//	          {{prev.<key>}} (previous output, or initial_json on the first pass)
+//	          and {{iteration}} (1-based)
+//
+// Optional payload:
+//
+//	until:          condition checked after each iteration; the loop stops once it holds
+//	                (e.g. "empty(prev.next_url)" or "@results.x.y == prev.id")
+//	while:          condition checked before each iteration; the loop stops once it fails
+//	max_iterations: default 10, max 200
+//	initial_json:   object used as prev for the first iteration
+//
+// A failing first iteration fails the action; a later failure ends the loop
+// and is reported in "error".
+//
+// Output:
+//
+//	{
+//	  "iterations_json": "<[output]>",
+//	  "count":           int,
+//	  "last_json":       "<last output>",
+//	  "stop_reason":     "until" | "while" | "max_iterations" | "error",
+//	  "error":           string
+//	}
+func whileLoop(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	tpl, ok := payload["template"].(map[string]any)
+	if !ok {
+		return nil, errors.New("flow.while: payload.template must be an object")
+	}
+	action, _ := tpl["action"].(string)
+	if strings.TrimSpace(action) == "" {
+		return nil, errors.New("flow.while: template.action is required")
+	}
+	tplPayload, ok := tpl["payload"].(map[string]any)
+	if !ok {
+		return nil, errors.New("flow.while: template.payload must be an object")
+	}
+	l := &loop{action: action, payload: tplPayload}
+	if err := l.configure(payload, "max_iterations"); err != nil {
+		return nil, fmt.Errorf("flow.while: %w", err)
+	}
+	if raw, ok := payload["initial_json"]; ok {
+		init, err := objectOf(raw)
+		if err != nil {
+			return nil, fmt.Errorf("flow.while: initial_json: %w", err)
+		}
+		l.initial = init
+	}
+
+	res, err := l.run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("flow.while: %w", err)
+	}
+	last := map[string]any{}
+	if n := len(res.outputs); n > 0 {
+		last = res.outputs[n-1]
+	}
+	bIt, _ := json.Marshal(res.outputs)
+	bLast, _ := json.Marshal(last)
+	out := map[string]any{
+		"iterations_json": string(bIt),
+		"count":           len(res.outputs),
+		"last_json":       string(bLast),
+		"stop_reason":     res.stopReason,
+		"error":           "",
+	}
+	if res.err != nil {
+		out["error"] = res.err.Error()
+	}
+	return out, nil
+}
+
+type page struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Content    string `json:"content,omitempty"`
+	NextURL    string `json:"next_url"`
+}
+
+// Fetches a page and keeps following its "next page" link.
+// Required payload:
+//
+//	url: first page
+//
+// Optional payload:
+//
+//	next_selector:   CSS selector of the next link (default: rel=next / "Next" style links)
+//	max_pages:       default 10, max 200
+//	until:           condition checked after each page, e.g. "contains(prev.content, \"2019\")"
+//	request:         extra web.request payload (session, headers, cache, ...)
+//	include_content: keep page HTML in pages_json (default true)
+//
+// Stops when a page has no next link, links back to a page already fetched,
+// answers with an HTTP error status or a limit is hit.
+//
+// Output:
+//
+//	{
+//	  "pages_json":  "<[{url, status_code, content, next_url}]>",
+//	  "urls_json":   "<[url]>",
+//	  "count":       int,
+//	  "stop_reason": "no_next_link" | "repeated_url" | "http_error" | "until" | "max_iterations" | "error",
+//	  "error":       string
+//	}
+func paginate(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	start, err := utils.GetStringPayload(payload, "url")
+	if err != nil {
+		return nil, err
+	}
+	selector, _ := payload["next_selector"].(string)
+	includeContent := true
+	if v, ok := payload["include_content"].(bool); ok {
+		includeContent = v
+	}
+	reqPayload := map[string]any{}
+	if raw, ok := payload["request"]; ok {
+		if reqPayload, err = objectOf(raw); err != nil {
+			return nil, fmt.Errorf("flow.paginate: request: %w", err)
+		}
+	}
+	reqPayload["url"] = "{{prev.next_url}}"
+
+	seen := map[string]struct{}{start: {}}
+	l := &loop{
+		action:  "web.request",
+		payload: reqPayload,
+		initial: map[string]any{"next_url": start},
+		after: func(out map[string]any) {
+			base, _ := out["final_url"].(string)
+			if base == "" {
+				base, _ = out["url"].(string)
+			}
+			content, _ := out["content"].(string)
+			out["next_url"] = web.NextPageURL(content, base, selector)
+		},
+		stop: func(out map[string]any) string {
+			if code, _ := out["status_code"].(int); code >= 400 {
+				return "http_error"
+			}
+			next, _ := out["next_url"].(string)
+			if next == "" {
+				return "no_next_link"
+			}
+			if _, dup := seen[next]; dup {
+				return "repeated_url"
+			}
+			seen[next] = struct{}{}
+			return ""
+		},
+	}
+	if err := l.configure(payload, "max_pages"); err != nil {
+		return nil, fmt.Errorf("flow.paginate: %w", err)
+	}
+
+	res, err := l.run(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("flow.paginate: %w", err)
+	}
+	pages := make([]page, 0, len(res.outputs))
+	urls := make([]string, 0, len(res.outputs))
+	for _, out := range res.outputs {
+		p := page{}
+		p.URL, _ = out["url"].(string)
+		p.StatusCode, _ = out["status_code"].(int)
+		p.NextURL, _ = out["next_url"].(string)
+		if includeContent {
+			p.Content, _ = out["content"].(string)
+		}
+		pages = append(pages, p)
+		urls = append(urls, p.URL)
+	}
+	bp, _ := json.Marshal(pages)
+	bu, _ := json.Marshal(urls)
+	out := map[string]any{
+		"pages_json":  string(bp),
+		"urls_json":   string(bu),
+		"count":       len(pages),
+		"stop_reason": res.stopReason,
+		"error":       "",
+	}
+	if res.err != nil {
+		out["error"] = res.err.Error()
+	}
+	return out, nil
+}
+
+// Reads until/while and the iteration cap (under maxKey) shared by loops.
+func (l *loop) configure(payload map[string]any, maxKey string) error {
+	for key, dst := range map[string]**parser.Condition{"until": &l.until, "while": &l.while} {
+		src, ok := payload[key].(string)
+		if !ok || strings.TrimSpace(src) == "" {
+			continue
+		}
+		c, err := parser.ParseCondition(src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		*dst = c
+	}
+	l.max = loopDefaultIterations
+	if v, ok := payload[maxKey]; ok {
+		n, err := utils.GetIntPayload(map[string]any{"v": v}, "v")
+		if err != nil || n < 1 {
+			return fmt.Errorf("%s must be a positive integer", maxKey)
+		}
+		l.max = min(n, loopMaxIterations)
+	}
+	return nil
+}
+
+// Accepts an object or a JSON object string.
+func objectOf(v any) (map[string]any, error) {
+	switch t := v.(type) {
+	case map[string]any:
+		return deepCopyJSON(t).(map[string]any), nil
+	case string:
+		if strings.TrimSpace(t) == "" {
+			return map[string]any{}, nil
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(t), &m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("expected an object, got %T", v)
+}
+
+var prevRe = regexp.MustCompile(`\{\{\s*(prev(?:\.[a-zA-Z0-9_\.\-]+)?|iteration)\s*\}\}`)
+
+// Recursively replace "{{prev.key}}", "{{prev.key.path}}" and "{{iteration}}"
+// in all string leaves; *_json outputs are decoded when a path reaches into them.
+func substitutePrevPlaceholders(v any, prev map[string]any, iteration int) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			t[k] = substitutePrevPlaceholders(val, prev, iteration)
+		}
+		return t
+	case []any:
+		for i, val := range t {
+			t[i] = substitutePrevPlaceholders(val, prev, iteration)
+		}
+		return t
+	case string:
+		return prevRe.ReplaceAllStringFunc(t, func(match string) string {
+			name := prevRe.FindStringSubmatch(match)[1]
+			if name == "iteration" {
+				return fmt.Sprint(iteration)
+			}
+			if name == "prev" {
+				b, _ := json.Marshal(prev)
+				return string(b)
+			}
+			var cur any = prev
+			for _, seg := range strings.Split(strings.TrimPrefix(name, "prev."), ".") {
+				if s, ok := cur.(string); ok {
+					var decoded any
+					if json.Unmarshal([]byte(s), &decoded) == nil {
+						cur = decoded
+					}
+				}
+				var ok bool
+				if cur, ok = getByPath(cur, seg); !ok {
+					return ""
+				}
+			}
+			return placeholderText(cur)
+		})
+	default:
+		return v
+	}
+}
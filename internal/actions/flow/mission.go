@@ -0,0 +1,97 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"a-a/internal/utils"
+)
+
+// Delegates a goal to a child mission with its own plan/re-plan loop and
+// scratch dir, and waits for it. Cancelling this action (or the mission)
+// cancels the child; the child's file changes are rolled back with the
+// parent's if the parent fails later.
+// Required payload:
+//
+//	goal: goal of the child mission (may embed @results.<id>.<key>)
+//
+// Optional payload:
+//
+//	outputs_json: names the child must declare in its plan's meta.outputs,
+//	              e.g. ["summary", "price"]; a missing one fails the action
+//
+// Output:
+//
+//	{
+//	  "mission_id":   string (child mission ID),
+//	  "outputs_json": "<{name: value} of the child's declared outputs>",
+//	  "<name>":       value of each declared output
+//	}
+func subMission(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	goal, err := utils.GetStringPayload(payload, "goal")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(goal) == "" {
+		return nil, errors.New("flow.mission: goal is empty")
+	}
+	names, err := outputNames(payload["outputs_json"])
+	if err != nil {
+		return nil, fmt.Errorf("flow.mission: %w", err)
+	}
+
+	spawn := utils.SpawnerFromContext(ctx)
+	if spawn == nil {
+		return nil, errors.New("flow.mission: sub-missions can only be started from a running mission")
+	}
+	res, err := spawn(ctx, utils.SubMission{Goal: strings.TrimSpace(goal), Outputs: names})
+	if err != nil {
+		return nil, fmt.Errorf("flow.mission: %w", err)
+	}
+
+	var missing []string
+	for _, n := range names {
+		if _, ok := res.Outputs[n]; !ok {
+			missing = append(missing, n)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("flow.mission: sub-mission %s did not produce outputs: %s", res.MissionID, strings.Join(missing, ", "))
+	}
+
+	outputs := res.Outputs
+	if outputs == nil {
+		outputs = map[string]any{}
+	}
+	b, _ := json.Marshal(outputs)
+	out := map[string]any{}
+	for k, v := range outputs {
+		out[k] = v
+	}
+	out["mission_id"] = res.MissionID
+	out["outputs_json"] = string(b)
+	return out, nil
+}
+
+func outputNames(v any) ([]string, error) {
+	items, err := coerceToSlice(v)
+	if err != nil {
+		return nil, fmt.Errorf("outputs_json: %w", err)
+	}
+	var names []string
+	for _, it := range items {
+		n, ok := it.(string)
+		n = strings.TrimSpace(n)
+		if !ok || n == "" {
+			return nil, fmt.Errorf("outputs_json must be an array of names, got %v", it)
+		}
+		if n == "mission_id" || n == "outputs_json" {
+			return nil, fmt.Errorf("outputs_json: %q is reserved", n)
+		}
+		names = append(names, n)
+	}
+	return names, nil
+}
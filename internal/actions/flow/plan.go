@@ -0,0 +1,111 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"a-a/internal/parser"
+	"a-a/internal/utils"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Flow actions may contain flow actions (a foreach inside a foreach, an if
+// inside a foreach template, ...) up to this depth.
+const maxFlowDepth = 3
+
+type flowDepthKey struct{}
+
+func flowDepth(ctx context.Context) int {
+	d, _ := ctx.Value(flowDepthKey{}).(int)
+	return d
+}
+
+// Runs stages like the executor does, against results: stages in order,
+// actions of a stage in parallel, with guards, @results substitution,
+// each action's timeout/retry/continue_on_error settings and compensations.
+// Outputs are written to results and returned by action ID.
+func runPlan(ctx context.Context, stages []parser.ExecutionStage, results *utils.Results) (map[string]map[string]any, []skippedOut, error) {
+	ctx = utils.WithResults(ctx, results)
+	outputs := map[string]map[string]any{}
+	skipped := []skippedOut{}
+	var mu sync.Mutex
+
+	for _, stage := range stages {
+		g, gctx := errgroup.WithContext(ctx)
+		g.SetLimit(foreachConcurrency)
+		for i := range stage.Actions {
+			act := stage.Actions[i]
+			g.Go(func() (rerr error) {
+				defer func() {
+					if rec := recover(); rec != nil {
+						rerr = fmt.Errorf("panic in action %s: %v", act.Action, rec)
+					}
+				}()
+				snap := results.Snapshot()
+				reason, err := parser.SkipReason(&act, snap, results.SkippedAmong)
+				if err != nil {
+					return fmt.Errorf("action '%s': %w", act.ID, err)
+				}
+				if reason != "" {
+					results.Skip(act.ID, reason)
+					mu.Lock()
+					skipped = append(skipped, skippedOut{ID: act.ID, Reason: reason})
+					mu.Unlock()
+					return nil
+				}
+				payload := parser.ResolvePayload(act.Payload, snap, parser.RawPayloadKeys(act.Action)...)
+
+				out, _, err := utils.RunAction(gctx, &act, defaultInnerMs*time.Millisecond, func(c context.Context) (map[string]any, error) {
+					return dispatch(c, act.Action, payload)
+				})
+				if err == nil {
+					if out == nil {
+						out = map[string]any{}
+					}
+					results.Set(act.ID, out)
+				}
+				if u, ok := utils.Compensation(&act, err != nil, results.Snapshot(), dispatchAction); ok {
+					utils.JournalFromContext(ctx).Add(u)
+				}
+				if err != nil && act.ContinueOnError && gctx.Err() == nil {
+					reason := "failed: " + err.Error()
+					results.Skip(act.ID, reason)
+					mu.Lock()
+					skipped = append(skipped, skippedOut{ID: act.ID, Reason: reason})
+					mu.Unlock()
+					return nil
+				}
+				if err != nil {
+					return fmt.Errorf("action '%s' (%s) failed: %w", act.ID, act.Action, err)
+				}
+				mu.Lock()
+				outputs[act.ID] = out
+				mu.Unlock()
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return outputs, skipped, err
+		}
+		if err := ctx.Err(); err != nil {
+			return outputs, skipped, err
+		}
+	}
+	return outputs, skipped, nil
+}
+
+// Each action of a flow.if branch runs after the previous one.
+func sequential(acts []parser.Action) []parser.ExecutionStage {
+	stages := make([]parser.ExecutionStage, len(acts))
+	for i, a := range acts {
+		stages[i] = parser.ExecutionStage{Stage: i + 1, Actions: []parser.Action{a}}
+	}
+	return stages
+}
+
+func dispatchAction(ctx context.Context, a *parser.Action) (map[string]any, error) {
+	return dispatch(ctx, a.Action, a.Payload)
+}
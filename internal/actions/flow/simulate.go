@@ -0,0 +1,199 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"a-a/internal/actions/archive"
+	"a-a/internal/actions/doc"
+	"a-a/internal/actions/feed"
+	"a-a/internal/actions/llm"
+	"a-a/internal/actions/system"
+	"a-a/internal/actions/web"
+	"a-a/internal/parser"
+	"a-a/internal/utils"
+)
+
+// Simulates each inner action of a flow action once; effects are marked
+// with how often they may repeat and the condition they depend on.
+func SimulateFlowAction(ctx context.Context, operation string, payload map[string]any) ([]utils.Effect, error) {
+	snap := map[string]map[string]any{}
+	results := utils.ResultsFromContext(ctx)
+	if results != nil {
+		snap = results.Snapshot()
+	}
+
+	switch operation {
+	case "foreach":
+		tpl, ok := payload["template"].(map[string]any)
+		if !ok {
+			return nil, errors.New("flow.foreach: payload.template must be an object")
+		}
+		repeated := "per item"
+		if items, err := coerceToSlice(payload["items_json"]); err == nil && len(items) > 0 {
+			repeated = fmt.Sprintf("per item (%d items)", len(items))
+		}
+		stages, isPlan, err := parser.TemplatePlan(tpl)
+		if err != nil {
+			return nil, fmt.Errorf("flow.foreach: %w", err)
+		}
+		if !isPlan {
+			action, _ := tpl["action"].(string)
+			tplPayload, _ := tpl["payload"].(map[string]any)
+			stages = []parser.ExecutionStage{{Actions: []parser.Action{{Action: action, Payload: tplPayload}}}}
+		}
+		// Template actions see each other's outputs, but not the mission
+		local := make(map[string]map[string]any, len(snap))
+		for id, out := range snap {
+			local[id] = out
+		}
+		var effects []utils.Effect
+		for _, st := range stages {
+			for i := range st.Actions {
+				sub, err := simulateInner(ctx, &st.Actions[i], local, repeated, "")
+				if err != nil {
+					return nil, fmt.Errorf("flow.foreach: %w", err)
+				}
+				effects = append(effects, sub...)
+			}
+			for i := range st.Actions {
+				if id := st.Actions[i].ID; id != "" {
+					local[id] = parser.PlaceholderOutput(&st.Actions[i])
+				}
+			}
+		}
+		return effects, nil
+
+	case "if":
+		cond, _ := payload["condition"].(string)
+		var effects []utils.Effect
+		for _, branch := range []struct{ key, when string }{{"then", cond}, {"else", "!(" + cond + ")"}} {
+			acts, err := parser.BranchActions(payload[branch.key])
+			if err != nil {
+				return nil, fmt.Errorf("flow.if: %s: %w", branch.key, err)
+			}
+			for i := range acts {
+				sub, err := simulateInner(ctx, &acts[i], snap, "", branch.when)
+				if err != nil {
+					return nil, fmt.Errorf("flow.if: %s: %w", branch.key, err)
+				}
+				effects = append(effects, sub...)
+				// Branch outputs are published to the mission
+				if results != nil {
+					results.Set(acts[i].ID, parser.PlaceholderOutput(&acts[i]))
+					snap = results.Snapshot()
+				}
+			}
+		}
+		return effects, nil
+
+	case "while":
+		tpl, ok := payload["template"].(map[string]any)
+		if !ok {
+			return nil, errors.New("flow.while: payload.template must be an object")
+		}
+		l := &loop{}
+		if err := l.configure(payload, "max_iterations"); err != nil {
+			return nil, fmt.Errorf("flow.while: %w", err)
+		}
+		action, _ := tpl["action"].(string)
+		tplPayload, _ := tpl["payload"].(map[string]any)
+		return simulateInner(ctx, &parser.Action{Action: action, Payload: tplPayload}, snap,
+			fmt.Sprintf("per iteration (max %d)", l.max), "")
+
+	case "paginate":
+		start, err := utils.GetStringPayload(payload, "url")
+		if err != nil {
+			return nil, err
+		}
+		l := &loop{}
+		if err := l.configure(payload, "max_pages"); err != nil {
+			return nil, fmt.Errorf("flow.paginate: %w", err)
+		}
+		e := utils.NetworkEffect(start, "GET "+start+" and its next-page links")
+		e.Repeated = fmt.Sprintf("per page (max %d)", l.max)
+		return []utils.Effect{e}, nil
+
+	case "mission":
+		// The child's plan does not exist before it runs; only its planning is known
+		goal, err := utils.GetStringPayload(payload, "goal")
+		if err != nil {
+			return nil, err
+		}
+		return []utils.Effect{{
+			Kind:   utils.EffectLLM,
+			Target: "planner",
+			Tokens: (len(goal) + 3) / 4,
+			Detail: "sub-mission \"" + goal + "\"; its own effects are shown when its plan needs confirmation",
+		}}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown flow operation: %s", operation)
+	}
+}
+
+// Simulates one inner action and labels its effects.
+func simulateInner(ctx context.Context, a *parser.Action, snap map[string]map[string]any, repeated, when string) ([]utils.Effect, error) {
+	payload := parser.ResolvePayload(a.Payload, snap, parser.RawPayloadKeys(a.Action)...)
+	effects, err := simulate(ctx, a.Action, payload)
+	if err != nil {
+		return nil, err
+	}
+	for i := range effects {
+		e := &effects[i]
+		if e.ActionID == "" {
+			e.ActionID = a.ID
+		}
+		if e.Action == "" {
+			e.Action = a.Action
+		}
+		e.When = joinNonEmpty(" && ", when, a.When, e.When)
+		e.Repeated = joinNonEmpty(", ", repeated, e.Repeated)
+	}
+	return effects, nil
+}
+
+// Mirrors dispatch; categories without side effects report nothing.
+func simulate(ctx context.Context, fullAction string, payload map[string]any) ([]utils.Effect, error) {
+	parts := strings.Split(fullAction, ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid action name %q; expected category.operation", fullAction)
+	}
+	category, op := parts[0], parts[1]
+	switch category {
+	case "system":
+		return system.SimulateSystemAction(ctx, op, payload)
+	case "web":
+		return web.SimulateWebAction(ctx, op, payload)
+	case "llm":
+		return llm.SimulateLlmAction(ctx, op, payload)
+	case "feed":
+		return feed.SimulateFeedAction(ctx, op, payload)
+	case "archive":
+		return archive.SimulateArchiveAction(ctx, op, payload)
+	case "doc":
+		return doc.SimulateDocAction(ctx, op, payload)
+	case "html", "test", "url", "list", "json", "text", "format", "ask":
+		return nil, nil
+	case "flow":
+		depth := flowDepth(ctx) + 1
+		if depth > maxFlowDepth {
+			return nil, fmt.Errorf("flow actions nested more than %d levels deep", maxFlowDepth)
+		}
+		return SimulateFlowAction(context.WithValue(ctx, flowDepthKey{}, depth), op, payload)
+	default:
+		return nil, fmt.Errorf("unknown action category: %s", category)
+	}
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, sep)
+}
@@ -0,0 +1,554 @@
+package format
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"a-a/internal/utils"
+)
+
+var numericRe = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+
+// Options shared by the tabular writers.
+type tableOptions struct {
+	columns  []string // explicit order; nil = first-seen order
+	arraySep string   // separator for arrays of scalars
+	flatten  bool     // nested objects -> "parent.child" columns
+}
+
+// Converts an array of objects (or of arrays) to CSV.
+// Required payload:
+//
+//	list_json: array of objects; nested objects become "parent.child" columns
+//
+// Optional payload:
+//
+//	columns_json:    column order / subset (default: keys in first-seen order)
+//	delimiter:       default ","; "\t" for TSV
+//	header:          write a header row (default true)
+//	array_separator: joins arrays of scalars in one cell (default "; ")
+//	flatten:         flatten nested objects (default true; false = JSON in the cell)
+//	bom:             prefix a UTF-8 BOM so Excel detects the encoding (default false)
+//
+// Output:
+//
+//	{ "csv": string, "rows": int, "columns_json": "<[column]>" }
+func handleToCSV(_ context.Context, payload map[string]any) (map[string]any, error) {
+	opts, err := readTableOptions(payload)
+	if err != nil {
+		return nil, err
+	}
+	columns, rows, err := tabulate(payload, opts)
+	if err != nil {
+		return nil, err
+	}
+	delim, err := delimiterOf(payload, ',')
+	if err != nil {
+		return nil, err
+	}
+	header := true
+	if v, ok := payload["header"].(bool); ok {
+		header = v
+	}
+
+	var buf bytes.Buffer
+	if bom, _ := payload["bom"].(bool); bom {
+		buf.WriteString("\ufeff")
+	}
+	w := csv.NewWriter(&buf)
+	w.Comma = delim
+	if header {
+		_ = w.Write(columns)
+	}
+	for _, r := range rows {
+		_ = w.Write(r)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("write csv: %w", err)
+	}
+	bc, _ := json.Marshal(columns)
+	return map[string]any{"csv": buf.String(), "rows": len(rows), "columns_json": string(bc)}, nil
+}
+
+// Parses CSV into an array of objects.
+// Required payload:
+//
+//	csv: text
+//
+// Optional payload:
+//
+//	delimiter:   default: detected from the first line among , ; tab |
+//	header:      true, false or "auto" (default: first row is a header unless it
+//	             looks like data: empty, duplicate or numeric cells)
+//	infer_types: numbers and true/false become JSON numbers/booleans (default false)
+//	unflatten:   "parent.child" columns become nested objects (default false)
+//
+// Output:
+//
+//	{ "list_json": "<[{column: value}]>", "columns_json": "<[column]>", "rows": int }
+func handleFromCSV(_ context.Context, payload map[string]any) (map[string]any, error) {
+	text, err := utils.GetStringPayload(payload, "csv")
+	if err != nil {
+		return nil, err
+	}
+	text = strings.TrimPrefix(text, "\ufeff")
+	delim, err := delimiterOf(payload, 0)
+	if err != nil {
+		return nil, err
+	}
+	if delim == 0 {
+		delim = sniffDelimiter(text)
+	}
+
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = delim
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parse csv: %w", err)
+	}
+
+	columns := []string{}
+	body := records
+	if len(records) > 0 && hasHeader(payload["header"], records) {
+		columns = uniqueNames(records[0])
+		body = records[1:]
+	}
+	width := len(columns)
+	for _, rec := range body {
+		width = max(width, len(rec))
+	}
+	for i := len(columns); i < width; i++ {
+		columns = append(columns, fmt.Sprintf("col_%d", i+1))
+	}
+
+	inferTypes, _ := payload["infer_types"].(bool)
+	unflatten, _ := payload["unflatten"].(bool)
+	out := make([]*omap, 0, len(body))
+	for _, rec := range body {
+		if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+		row := newOmap()
+		for i, col := range columns {
+			var v any = ""
+			if i < len(rec) {
+				v = rec[i]
+				if inferTypes {
+					v = inferValue(rec[i])
+				}
+			}
+			if unflatten && strings.Contains(col, ".") {
+				setNested(row, strings.Split(col, "."), v)
+			} else {
+				row.set(col, v)
+			}
+		}
+		out = append(out, row)
+	}
+
+	bl, _ := json.Marshal(out)
+	bc, _ := json.Marshal(columns)
+	return map[string]any{"list_json": string(bl), "columns_json": string(bc), "rows": len(out)}, nil
+}
+
+// Renders an array of objects as a GitHub-flavoured Markdown table.
+// Required payload:
+//
+//	list_json: array of objects
+//
+// Optional payload:
+//
+//	columns_json, array_separator, flatten: as for format.to_csv
+//
+// Output:
+//
+//	{ "markdown": string, "rows": int }
+func handleToMarkdownTable(_ context.Context, payload map[string]any) (map[string]any, error) {
+	opts, err := readTableOptions(payload)
+	if err != nil {
+		return nil, err
+	}
+	columns, rows, err := tabulate(payload, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return map[string]any{"markdown": "", "rows": 0}, nil
+	}
+	cell := func(s string) string {
+		s = strings.ReplaceAll(s, "|", `\|`)
+		s = strings.ReplaceAll(s, "\r\n", "\n")
+		return strings.ReplaceAll(strings.TrimSpace(s), "\n", "<br>")
+	}
+	var sb strings.Builder
+	line := func(cells []string) {
+		sb.WriteString("|")
+		for _, c := range cells {
+			sb.WriteString(" " + cell(c) + " |")
+		}
+		sb.WriteString("\n")
+	}
+	line(columns)
+	sb.WriteString("|" + strings.Repeat(" --- |", len(columns)) + "\n")
+	for _, r := range rows {
+		line(r)
+	}
+	return map[string]any{"markdown": strings.TrimSuffix(sb.String(), "\n"), "rows": len(rows)}, nil
+}
+
+// Encodes an array as JSON Lines (one compact value per line), keeping key order.
+// Required payload:
+//
+//	list_json: array
+//
+// Output:
+//
+//	{ "jsonl": string, "lines": int }
+func handleToJSONL(_ context.Context, payload map[string]any) (map[string]any, error) {
+	listJSON, err := utils.GetStringPayload(payload, "list_json")
+	if err != nil {
+		return nil, err
+	}
+	var arr []json.RawMessage
+	if err := json.Unmarshal([]byte(listJSON), &arr); err != nil {
+		return nil, fmt.Errorf("list_json must be a JSON array: %w", err)
+	}
+	var sb strings.Builder
+	for _, raw := range arr {
+		var line bytes.Buffer
+		if err := json.Compact(&line, raw); err != nil {
+			return nil, err
+		}
+		sb.Write(line.Bytes())
+		sb.WriteByte('\n')
+	}
+	return map[string]any{"jsonl": sb.String(), "lines": len(arr)}, nil
+}
+
+// Parses JSON Lines into an array.
+// Required payload:
+//
+//	jsonl: text with one JSON value per line (blank lines ignored)
+//
+// Optional payload:
+//
+//	skip_invalid: skip lines that are not valid JSON instead of failing (default false)
+//
+// Output:
+//
+//	{ "list_json": "<[...]>", "count": int, "skipped": int }
+func handleFromJSONL(_ context.Context, payload map[string]any) (map[string]any, error) {
+	text, err := utils.GetStringPayload(payload, "jsonl")
+	if err != nil {
+		return nil, err
+	}
+	skipInvalid, _ := payload["skip_invalid"].(bool)
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	count, skipped := 0, 0
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var compact bytes.Buffer
+		if !json.Valid([]byte(line)) || json.Compact(&compact, []byte(line)) != nil {
+			if skipInvalid {
+				skipped++
+				continue
+			}
+			return nil, fmt.Errorf("jsonl line %d is not valid JSON", i+1)
+		}
+		if count > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(compact.Bytes())
+		count++
+	}
+	buf.WriteByte(']')
+	return map[string]any{"list_json": buf.String(), "count": count, "skipped": skipped}, nil
+}
+
+func readTableOptions(payload map[string]any) (tableOptions, error) {
+	opts := tableOptions{arraySep: "; ", flatten: true}
+	if s, ok := payload["array_separator"].(string); ok {
+		opts.arraySep = s
+	}
+	if v, ok := payload["flatten"].(bool); ok {
+		opts.flatten = v
+	}
+	if raw, ok := payload["columns_json"]; ok && raw != nil {
+		switch t := raw.(type) {
+		case string:
+			if strings.TrimSpace(t) != "" {
+				if err := json.Unmarshal([]byte(t), &opts.columns); err != nil {
+					return opts, fmt.Errorf("columns_json must be an array of strings: %w", err)
+				}
+			}
+		case []any:
+			for _, c := range t {
+				opts.columns = append(opts.columns, fmt.Sprint(c))
+			}
+		}
+	}
+	return opts, nil
+}
+
+// Turns list_json into a header and string rows.
+func tabulate(payload map[string]any, opts tableOptions) ([]string, [][]string, error) {
+	listJSON, err := utils.GetStringPayload(payload, "list_json")
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := decodeOrdered(listJSON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list_json must be a JSON array: %w", err)
+	}
+	arr, ok := doc.([]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("list_json must be a JSON array")
+	}
+
+	flat := make([]*omap, len(arr))
+	seen := map[string]struct{}{}
+	inferred := []string{}
+	for i, el := range arr {
+		row := newOmap()
+		switch t := el.(type) {
+		case *omap:
+			flattenInto(row, "", t, opts)
+		case []any:
+			// Arrays of arrays: positional columns
+			for j, v := range t {
+				row.set(fmt.Sprintf("col_%d", j+1), cellText(v, opts))
+			}
+		default:
+			row.set("value", cellText(t, opts))
+		}
+		for _, k := range row.keys {
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				inferred = append(inferred, k)
+			}
+		}
+		flat[i] = row
+	}
+
+	columns := opts.columns
+	if len(columns) == 0 {
+		columns = inferred
+	}
+	rows := make([][]string, len(flat))
+	for i, row := range flat {
+		r := make([]string, len(columns))
+		for j, c := range columns {
+			if v, ok := row.vals[c]; ok {
+				r[j], _ = v.(string)
+			} else if sub := subtree(row, c); sub != "" {
+				// A column naming a parent object of flattened fields
+				r[j] = sub
+			}
+		}
+		rows[i] = r
+	}
+	return columns, rows, nil
+}
+
+func flattenInto(row *omap, prefix string, m *omap, opts tableOptions) {
+	for _, k := range m.keys {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if sub, ok := m.vals[k].(*omap); ok && opts.flatten && len(sub.keys) > 0 {
+			flattenInto(row, key, sub, opts)
+			continue
+		}
+		row.set(key, cellText(m.vals[k], opts))
+	}
+}
+
+// Reassembles "col.x", "col.y" cells as a JSON object for a column named "col".
+func subtree(row *omap, col string) string {
+	obj := newOmap()
+	for _, k := range row.keys {
+		if strings.HasPrefix(k, col+".") {
+			obj.set(strings.TrimPrefix(k, col+"."), row.vals[k])
+		}
+	}
+	if len(obj.keys) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(obj)
+	return string(b)
+}
+
+func cellText(v any, opts tableOptions) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	case []any:
+		parts := make([]string, 0, len(t))
+		for _, x := range t {
+			switch x.(type) {
+			case *omap, []any:
+				b, _ := json.Marshal(t)
+				return string(b)
+			}
+			parts = append(parts, cellText(x, opts))
+		}
+		return strings.Join(parts, opts.arraySep)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func delimiterOf(payload map[string]any, def rune) (rune, error) {
+	s, ok := payload["delimiter"].(string)
+	if !ok || s == "" {
+		return def, nil
+	}
+	switch strings.ToLower(s) {
+	case `\t`, "tab", "tsv":
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size != len(s) || r == '"' || r == '\n' || r == '\r' {
+		return 0, fmt.Errorf("invalid delimiter %q", s)
+	}
+	return r, nil
+}
+
+// Picks the candidate delimiter that occurs most in the first line (outside quotes).
+func sniffDelimiter(text string) rune {
+	first := text
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		first = text[:i]
+	}
+	counts := map[rune]int{}
+	inQuotes := false
+	for _, r := range first {
+		if r == '"' {
+			inQuotes = !inQuotes
+			continue
+		}
+		if !inQuotes {
+			switch r {
+			case ',', ';', '\t', '|':
+				counts[r]++
+			}
+		}
+	}
+	best, n := ',', 0
+	for _, r := range []rune{',', ';', '\t', '|'} {
+		if counts[r] > n {
+			best, n = r, counts[r]
+		}
+	}
+	return best
+}
+
+func hasHeader(v any, records [][]string) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		if b, err := strconv.ParseBool(t); err == nil {
+			return b
+		}
+	}
+	// "auto": a header row has distinct, non-empty, non-numeric cells
+	seen := map[string]struct{}{}
+	for _, c := range records[0] {
+		c = strings.TrimSpace(c)
+		if c == "" || numericRe.MatchString(c) {
+			return false
+		}
+		if _, dup := seen[c]; dup {
+			return false
+		}
+		seen[c] = struct{}{}
+	}
+	return true
+}
+
+func uniqueNames(header []string) []string {
+	out := make([]string, len(header))
+	used := map[string]int{}
+	for i, h := range header {
+		name := strings.TrimSpace(h)
+		if name == "" {
+			name = fmt.Sprintf("col_%d", i+1)
+		}
+		used[name]++
+		if used[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, used[name])
+		}
+		out[i] = name
+	}
+	return out
+}
+
+func inferValue(s string) any {
+	t := strings.TrimSpace(s)
+	switch strings.ToLower(t) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	// Keep leading-zero values (postcodes, phone numbers) as text
+	digits := strings.TrimPrefix(t, "-")
+	if numericRe.MatchString(t) && !(len(digits) > 1 && digits[0] == '0' && digits[1] != '.') {
+		return json.Number(t)
+	}
+	return s
+}
+
+func setNested(row *omap, path []string, v any) {
+	cur := row
+	for _, p := range path[:len(path)-1] {
+		next, ok := cur.vals[p].(*omap)
+		if !ok {
+			next = newOmap()
+			cur.set(p, next)
+		}
+		cur = next
+	}
+	cur.set(path[len(path)-1], v)
+}
+
+func HandleFormatAction(ctx context.Context, operation string, payload map[string]any) (map[string]any, error) {
+	switch operation {
+	case "to_csv":
+		return handleToCSV(ctx, payload)
+	case "from_csv":
+		return handleFromCSV(ctx, payload)
+	case "to_markdown_table":
+		return handleToMarkdownTable(ctx, payload)
+	case "to_jsonl":
+		return handleToJSONL(ctx, payload)
+	case "from_jsonl":
+		return handleFromJSONL(ctx, payload)
+	default:
+		return nil, fmt.Errorf("unknown format operation: %s", operation)
+	}
+}
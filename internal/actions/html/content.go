@@ -0,0 +1,291 @@
+package html
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	htmldom "golang.org/x/net/html"
+
+	"a-a/internal/utils"
+)
+
+var (
+	unlikelyRe = regexp.MustCompile(`(?i)comment|footer|\bnav|sidebar|menu|share|social|sponsor|advert|\bad-|\bads\b|promo|related|breadcrumb|cookie|popup|modal|subscribe|newsletter|banner|widget|pager|pagination`)
+	maybeRe    = regexp.MustCompile(`(?i)article|body|content|entry|main|post|story|text|blog`)
+	positiveRe = regexp.MustCompile(`(?i)article|body|content|entry|hentry|main|page|post|text|blog|story`)
+	negativeRe = regexp.MustCompile(`(?i)comment|footer|masthead|meta|outbrain|promo|related|scroll|shoutbox|sidebar|sponsor|shopping|tags|tool|widget|hidden`)
+)
+
+const minContentChars = 140
+
+// Readability-style extraction of the main article.
+// Required payload:
+//
+//	html: full page
+//
+// Optional payload:
+//
+//	base_url: resolve links in the markdown output
+//
+// Output:
+//
+//	{ "title", "byline", "published", "text", "markdown", "html", "length" }
+func handleMainContent(_ context.Context, payload map[string]any) (map[string]any, error) {
+	htmlStr, err := utils.GetStringPayload(payload, "html")
+	if err != nil {
+		return nil, err
+	}
+	baseURL, _ := payload["base_url"].(string)
+
+	doc, err := parseDoc(htmlStr)
+	if err != nil {
+		return nil, fmt.Errorf("parse html: %w", err)
+	}
+
+	// Metadata first: some of it lives in elements removed below
+	title := pageTitle(doc)
+	byline := firstNonEmpty(
+		metaContent(doc, `meta[name="author"]`, `meta[property="article:author"]`),
+		selText(doc, `[itemprop="author"]`, `[rel="author"]`, `.byline`, `.author`),
+	)
+	published := firstNonEmpty(
+		metaContent(doc, `meta[property="article:published_time"]`, `meta[name="date"]`, `meta[itemprop="datePublished"]`),
+		selAttr(doc, "datetime", `article time[datetime]`, `time[datetime]`),
+		selText(doc, `[itemprop="datePublished"]`),
+	)
+
+	doc.Find("script,style,noscript,iframe,svg,form,button,nav,aside,footer").Remove()
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		switch goquery.NodeName(s) {
+		case "html", "body", "article", "main":
+			return
+		}
+		id, _ := s.Attr("id")
+		cls, _ := s.Attr("class")
+		role, _ := s.Attr("role")
+		key := id + " " + cls
+		if role == "navigation" || role == "complementary" || role == "banner" ||
+			(unlikelyRe.MatchString(key) && !maybeRe.MatchString(key)) {
+			s.Remove()
+		}
+	})
+
+	best := pickCandidate(doc)
+	if best == nil || best.Length() == 0 {
+		best = doc.Find("body")
+	}
+
+	// Drop a leading headline that repeats the page title
+	best.Find("h1").Each(func(_ int, s *goquery.Selection) {
+		if strings.EqualFold(inline(s.Text()), title) {
+			s.Remove()
+		}
+	})
+
+	text := blockText(best)
+	return map[string]any{
+		"title":     title,
+		"byline":    inline(byline),
+		"published": strings.TrimSpace(published),
+		"text":      text,
+		"markdown":  toMarkdown(best, baseURL),
+		"html":      outerHTML(best),
+		"length":    len(text),
+	}, nil
+}
+
+// Scores paragraph containers (parent + half to grandparent) and returns
+// the best one, penalised by link density.
+func pickCandidate(doc *goquery.Document) *goquery.Selection {
+	scores := map[*htmldom.Node]float64{}
+	sels := map[*htmldom.Node]*goquery.Selection{}
+
+	add := func(s *goquery.Selection, v float64) {
+		if s.Length() == 0 {
+			return
+		}
+		n := s.Nodes[0]
+		if _, ok := scores[n]; !ok {
+			scores[n] = classWeight(s)
+			switch goquery.NodeName(s) {
+			case "article", "main":
+				scores[n] += 10
+			case "div":
+				scores[n] += 5
+			case "td", "blockquote", "pre":
+				scores[n] += 3
+			}
+			sels[n] = s
+		}
+		scores[n] += v
+	}
+
+	doc.Find("p,pre,td,li").Each(func(_ int, p *goquery.Selection) {
+		t := inline(p.Text())
+		if len(t) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(t, ",")+strings.Count(t, "，"))
+		if l := float64(len(t)) / 100; l < 3 {
+			score += l
+		} else {
+			score += 3
+		}
+		parent := p.Parent()
+		add(parent, score)
+		add(parent.Parent(), score/2)
+	})
+
+	var best *goquery.Selection
+	bestScore := 0.0
+	for n, sc := range scores {
+		s := sels[n]
+		sc *= 1 - linkDensity(s)
+		if sc > bestScore {
+			best, bestScore = s, sc
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	// A container that is too thin usually means the article is split over siblings
+	if len(inline(best.Text())) < minContentChars && best.Parent().Length() > 0 {
+		return best.Parent()
+	}
+	return best
+}
+
+func classWeight(s *goquery.Selection) float64 {
+	id, _ := s.Attr("id")
+	cls, _ := s.Attr("class")
+	w := 0.0
+	for _, v := range []string{id, cls} {
+		if v == "" {
+			continue
+		}
+		if negativeRe.MatchString(v) {
+			w -= 25
+		}
+		if positiveRe.MatchString(v) {
+			w += 25
+		}
+	}
+	return w
+}
+
+func linkDensity(s *goquery.Selection) float64 {
+	total := len(inline(s.Text()))
+	if total == 0 {
+		return 1
+	}
+	linked := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		linked += len(inline(a.Text()))
+	})
+	return float64(linked) / float64(total)
+}
+
+// Paragraph-preserving plain text of a selection.
+func blockText(s *goquery.Selection) string {
+	var parts []string
+	s.Find("h1,h2,h3,h4,h5,h6,p,li,pre,blockquote,tr,dt,dd,figcaption").Each(func(_ int, b *goquery.Selection) {
+		// Skip blocks nested in another collected block
+		if b.ParentsFiltered("p,li,pre,blockquote,tr,dd").Length() > 0 {
+			return
+		}
+		var t string
+		if goquery.NodeName(b) == "tr" {
+			var cells []string
+			b.ChildrenFiltered("th,td").Each(func(_ int, c *goquery.Selection) {
+				cells = append(cells, inline(spacedText(c.Nodes[0])))
+			})
+			t = strings.Join(cells, " | ")
+		} else {
+			t = inline(spacedText(b.Nodes[0]))
+		}
+		if strings.Trim(t, " |") != "" {
+			parts = append(parts, t)
+		}
+	})
+	if len(parts) == 0 {
+		return inline(s.Text())
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Like Text(), but block boundaries become spaces ("two<ul><li>nested" -> "two nested").
+func spacedText(n *htmldom.Node) string {
+	var sb strings.Builder
+	var walk func(*htmldom.Node)
+	walk = func(x *htmldom.Node) {
+		switch x.Type {
+		case htmldom.TextNode:
+			sb.WriteString(x.Data)
+			return
+		case htmldom.ElementNode:
+			if _, ok := mdSkip[x.Data]; ok {
+				return
+			}
+		}
+		_, block := mdBlocks[x.Data]
+		block = block || x.Data == "li" || x.Data == "br" || x.Data == "ul" || x.Data == "ol" || x.Data == "td" || x.Data == "th"
+		if block {
+			sb.WriteString(" ")
+		}
+		for ch := x.FirstChild; ch != nil; ch = ch.NextSibling {
+			walk(ch)
+		}
+		if block {
+			sb.WriteString(" ")
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func pageTitle(doc *goquery.Document) string {
+	return inline(firstNonEmpty(
+		metaContent(doc, `meta[property="og:title"]`, `meta[name="twitter:title"]`),
+		selText(doc, "article h1", "h1"),
+		selText(doc, "title"),
+	))
+}
+
+func metaContent(doc *goquery.Document, selectors ...string) string {
+	for _, sel := range selectors {
+		if v, ok := doc.Find(sel).First().Attr("content"); ok && strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func selText(doc *goquery.Document, selectors ...string) string {
+	for _, sel := range selectors {
+		if t := inline(doc.Find(sel).First().Text()); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+func selAttr(doc *goquery.Document, name string, selectors ...string) string {
+	for _, sel := range selectors {
+		if v, ok := doc.Find(sel).First().Attr(name); ok && strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
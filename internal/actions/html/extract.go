@@ -0,0 +1,173 @@
+package html
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"a-a/internal/utils"
+)
+
+// Attributes whose values are URLs and get resolved against base_url.
+var urlAttrs = map[string]struct{}{
+	"href": {}, "src": {}, "action": {}, "data-src": {}, "data-href": {}, "poster": {}, "cite": {},
+}
+
+type fieldSpec struct {
+	name     string
+	selector string // "" -> the row element itself
+	attr     string // "text", "html" or an attribute name
+	all      bool   // "[]" suffix: collect every match
+}
+
+// Deterministic record extraction with a row selector and a field map.
+// Required payload:
+//
+//	html:     page or fragment
+//	selector: CSS selector of each record
+//	fields:   { "<name>": "<css>@<attr>" } as object or JSON string, where
+//	          attr is "text" (default), "html" or any attribute; an empty css
+//	          targets the record itself; a "[]" suffix collects all matches
+//
+// Optional payload:
+//
+//	base_url:   resolve URL attributes (href, src, ...)
+//	keep_empty: keep records whose fields are all empty (default false)
+//
+// Output:
+//
+//	{ "items_json": "<[{name: value}]>", "count": int }
+func handleExtract(_ context.Context, payload map[string]any) (map[string]any, error) {
+	htmlStr, err := utils.GetStringPayload(payload, "html")
+	if err != nil {
+		return nil, err
+	}
+	selector, err := utils.GetStringPayload(payload, "selector")
+	if err != nil {
+		return nil, err
+	}
+	specs, err := parseFieldSpecs(payload["fields"])
+	if err != nil {
+		return nil, err
+	}
+	baseURL, _ := payload["base_url"].(string)
+	keepEmpty, _ := payload["keep_empty"].(bool)
+
+	doc, err := parseDoc(htmlStr)
+	if err != nil {
+		return nil, fmt.Errorf("parse html: %w", err)
+	}
+
+	items := make([]map[string]any, 0, 32)
+	doc.Find(selector).Each(func(_ int, row *goquery.Selection) {
+		obj := make(map[string]any, len(specs))
+		empty := true
+		for _, f := range specs {
+			target := row
+			if f.selector != "" {
+				target = row.Find(f.selector)
+			}
+			if f.all {
+				vals := []string{}
+				target.Each(func(_ int, s *goquery.Selection) {
+					if v := fieldValue(s, f.attr, baseURL); v != "" {
+						vals = append(vals, v)
+					}
+				})
+				if len(vals) > 0 {
+					empty = false
+				}
+				obj[f.name] = vals
+				continue
+			}
+			v := ""
+			if target.Length() > 0 {
+				v = fieldValue(target.First(), f.attr, baseURL)
+			}
+			if v != "" {
+				empty = false
+			}
+			obj[f.name] = v
+		}
+		if !empty || keepEmpty {
+			items = append(items, obj)
+		}
+	})
+
+	b, _ := json.Marshal(items)
+	return map[string]any{"items_json": string(b), "count": len(items)}, nil
+}
+
+func parseFieldSpecs(v any) ([]fieldSpec, error) {
+	var raw map[string]any
+	switch t := v.(type) {
+	case map[string]any:
+		raw = t
+	case string:
+		if err := json.Unmarshal([]byte(t), &raw); err != nil {
+			return nil, fmt.Errorf("fields must be an object of name -> \"css@attr\": %w", err)
+		}
+	case nil:
+		return nil, fmt.Errorf("payload is missing required key: 'fields'")
+	default:
+		return nil, fmt.Errorf("fields must be an object, got %T", v)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("fields must not be empty")
+	}
+
+	names := make([]string, 0, len(raw))
+	for k := range raw {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	specs := make([]fieldSpec, 0, len(raw))
+	for _, name := range names {
+		s, ok := raw[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("field %q: spec must be a string like \"h3 a@href\"", name)
+		}
+		f := fieldSpec{name: name, attr: "text"}
+		s = strings.TrimSpace(s)
+		if strings.HasSuffix(s, "[]") {
+			f.all = true
+			s = strings.TrimSpace(strings.TrimSuffix(s, "[]"))
+		}
+		if i := strings.LastIndex(s, "@"); i >= 0 {
+			f.selector, f.attr = strings.TrimSpace(s[:i]), strings.ToLower(strings.TrimSpace(s[i+1:]))
+			if f.attr == "" {
+				f.attr = "text"
+			}
+		} else {
+			f.selector = s
+		}
+		specs = append(specs, f)
+	}
+	return specs, nil
+}
+
+func fieldValue(s *goquery.Selection, attr, baseURL string) string {
+	switch attr {
+	case "text":
+		return inline(spacedText(s.Nodes[0]))
+	case "html":
+		h, _ := s.Html()
+		return strings.TrimSpace(h)
+	case "outer_html":
+		return outerHTML(s)
+	}
+	v, ok := s.Attr(attr)
+	if !ok {
+		return ""
+	}
+	v = inline(v)
+	if _, isURL := urlAttrs[attr]; isURL && v != "" {
+		return utils.Absolute(baseURL, v)
+	}
+	return v
+}
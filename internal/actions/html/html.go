@@ -170,6 +170,14 @@ func HandleHtmlAction(ctx context.Context, operation string, payload map[string]
 		return handleInnerText(ctx, payload)
 	case "select_attr":
 		return handleSelectAttr(ctx, payload)
+	case "table":
+		return handleTable(ctx, payload)
+	case "main_content":
+		return handleMainContent(ctx, payload)
+	case "to_markdown":
+		return handleToMarkdown(ctx, payload)
+	case "extract":
+		return handleExtract(ctx, payload)
 	default:
 		return nil, fmt.Errorf("unknown html operation: %s", operation)
 	}
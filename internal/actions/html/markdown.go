@@ -0,0 +1,297 @@
+package html
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	htmldom "golang.org/x/net/html"
+
+	"a-a/internal/utils"
+)
+
+var (
+	mdSpaceRe    = regexp.MustCompile(`\s+`)
+	mdBlankRe    = regexp.MustCompile(`\n{3,}`)
+	mdTrailingRe = regexp.MustCompile(`[ \t]+\n`)
+)
+
+// Elements that never carry readable content.
+var mdSkip = map[string]struct{}{
+	"script": {}, "style": {}, "noscript": {}, "head": {}, "template": {}, "svg": {},
+	"iframe": {}, "button": {}, "input": {}, "select": {}, "textarea": {}, "canvas": {},
+}
+
+var mdBlocks = map[string]struct{}{
+	"p": {}, "div": {}, "section": {}, "article": {}, "main": {}, "header": {}, "footer": {},
+	"aside": {}, "nav": {}, "figure": {}, "figcaption": {}, "dl": {}, "dt": {}, "dd": {},
+	"address": {}, "form": {}, "fieldset": {}, "details": {}, "summary": {}, "body": {}, "html": {},
+}
+
+// Converts HTML to Markdown, keeping headings, lists, links, emphasis,
+// code, quotes, images and tables.
+// Required payload:
+//
+//	html: page or fragment
+//
+// Optional payload:
+//
+//	selector: convert only the first match (e.g. "article")
+//	base_url: resolve relative links and images
+//
+// Output:
+//
+//	{ "markdown": string }
+func handleToMarkdown(_ context.Context, payload map[string]any) (map[string]any, error) {
+	htmlStr, err := utils.GetStringPayload(payload, "html")
+	if err != nil {
+		return nil, err
+	}
+	baseURL, _ := payload["base_url"].(string)
+	selector, _ := payload["selector"].(string)
+
+	doc, err := parseDoc(htmlStr)
+	if err != nil {
+		return nil, fmt.Errorf("parse html: %w", err)
+	}
+	root := doc.Selection
+	if strings.TrimSpace(selector) != "" {
+		root = doc.Find(selector).First()
+		if root.Length() == 0 {
+			return nil, fmt.Errorf("html.to_markdown: selector %q matched nothing", selector)
+		}
+	}
+	return map[string]any{"markdown": toMarkdown(root, baseURL)}, nil
+}
+
+func toMarkdown(sel *goquery.Selection, baseURL string) string {
+	c := &mdConv{base: baseURL}
+	var sb strings.Builder
+	for _, n := range sel.Nodes {
+		sb.WriteString(c.node(n))
+	}
+	out := mdTrailingRe.ReplaceAllString(sb.String(), "\n")
+	out = mdBlankRe.ReplaceAllString(out, "\n\n")
+	return strings.TrimSpace(out)
+}
+
+type mdConv struct {
+	base string
+}
+
+func (c *mdConv) children(n *htmldom.Node) string {
+	var sb strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		sb.WriteString(c.node(ch))
+	}
+	return sb.String()
+}
+
+func (c *mdConv) node(n *htmldom.Node) string {
+	switch n.Type {
+	case htmldom.DocumentNode:
+		return c.children(n)
+	case htmldom.TextNode:
+		t := mdSpaceRe.ReplaceAllString(n.Data, " ")
+		if p := n.PrevSibling; p == nil || (p.Type == htmldom.ElementNode && p.Data == "br") {
+			t = strings.TrimLeft(t, " ")
+		}
+		return t
+	case htmldom.ElementNode:
+	default:
+		return ""
+	}
+
+	tag := n.Data
+	if _, ok := mdSkip[tag]; ok {
+		return ""
+	}
+	switch tag {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(tag[1:])
+		t := inline(c.children(n))
+		if t == "" {
+			return ""
+		}
+		return "\n\n" + strings.Repeat("#", level) + " " + t + "\n\n"
+	case "br":
+		return "\n"
+	case "hr":
+		return "\n\n---\n\n"
+	case "a":
+		t := inline(c.children(n))
+		href := strings.TrimSpace(attr(n, "href"))
+		if t == "" {
+			return ""
+		}
+		if href == "" || strings.HasPrefix(strings.ToLower(href), "javascript:") || strings.HasPrefix(href, "#") {
+			return t
+		}
+		return "[" + t + "](" + utils.Absolute(c.base, href) + ")"
+	case "img":
+		src := strings.TrimSpace(attr(n, "src"))
+		if src == "" || strings.HasPrefix(src, "data:") {
+			return ""
+		}
+		return "![" + inline(attr(n, "alt")) + "](" + utils.Absolute(c.base, src) + ")"
+	case "strong", "b":
+		return wrapInline(c.children(n), "**")
+	case "em", "i":
+		return wrapInline(c.children(n), "_")
+	case "del", "s", "strike":
+		return wrapInline(c.children(n), "~~")
+	case "code", "kbd", "samp":
+		if t := inline(textOf(n)); t != "" {
+			return "`" + t + "`"
+		}
+		return ""
+	case "pre":
+		return "\n\n```\n" + strings.Trim(textOf(n), "\n") + "\n```\n\n"
+	case "blockquote":
+		inner := strings.TrimSpace(mdBlankRe.ReplaceAllString(c.children(n), "\n\n"))
+		if inner == "" {
+			return ""
+		}
+		lines := strings.Split(inner, "\n")
+		for i, l := range lines {
+			lines[i] = strings.TrimRight("> "+l, " ")
+		}
+		return "\n\n" + strings.Join(lines, "\n") + "\n\n"
+	case "ul", "ol":
+		return "\n\n" + c.list(n) + "\n\n"
+	case "li":
+		// Stray <li> outside a list
+		return "\n- " + strings.TrimSpace(c.children(n)) + "\n"
+	case "table":
+		return "\n\n" + c.table(n) + "\n\n"
+	}
+	if _, ok := mdBlocks[tag]; ok {
+		inner := strings.TrimSpace(c.children(n))
+		if inner == "" {
+			return ""
+		}
+		return "\n\n" + inner + "\n\n"
+	}
+	return c.children(n)
+}
+
+func (c *mdConv) list(n *htmldom.Node) string {
+	ordered := n.Data == "ol"
+	num := 1
+	if s, err := strconv.Atoi(attr(n, "start")); err == nil {
+		num = s
+	}
+	var items []string
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if ch.Type != htmldom.ElementNode || ch.Data != "li" {
+			continue
+		}
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(num) + ". "
+			num++
+		}
+		body := strings.TrimSpace(mdBlankRe.ReplaceAllString(c.children(ch), "\n\n"))
+		body = strings.ReplaceAll(body, "\n\n", "\n")
+		// Indent continuation lines (nested lists, <br>) under the marker
+		pad := strings.Repeat(" ", len(marker))
+		lines := strings.Split(body, "\n")
+		for i := 1; i < len(lines); i++ {
+			if lines[i] != "" {
+				lines[i] = pad + lines[i]
+			}
+		}
+		items = append(items, marker+strings.Join(lines, "\n"))
+	}
+	return strings.Join(items, "\n")
+}
+
+func (c *mdConv) table(n *htmldom.Node) string {
+	sel := goquery.NewDocumentFromNode(n).Selection
+	grid, headerRows := tableGrid(sel, c.base)
+	if len(grid) == 0 {
+		return ""
+	}
+	width := 0
+	for _, r := range grid {
+		if len(r) > width {
+			width = len(r)
+		}
+	}
+	cellText := func(cell tableCell) string {
+		t := strings.ReplaceAll(cell.text, "|", "\\|")
+		if len(cell.links) == 1 && t != "" {
+			t = "[" + t + "](" + cell.links[0] + ")"
+		}
+		return t
+	}
+	row := func(r []tableCell) string {
+		cells := make([]string, width)
+		for i := 0; i < width; i++ {
+			if i < len(r) {
+				cells[i] = cellText(r[i])
+			}
+		}
+		return "| " + strings.Join(cells, " | ") + " |"
+	}
+
+	if headerRows == 0 {
+		headerRows = 1
+	}
+	// Stacked header rows collapse into the last one
+	head := grid[headerRows-1]
+	var sb strings.Builder
+	sb.WriteString(row(head))
+	sb.WriteString("\n|" + strings.Repeat(" --- |", width))
+	for _, r := range grid[headerRows:] {
+		sb.WriteString("\n" + row(r))
+	}
+	return sb.String()
+}
+
+func wrapInline(s, mark string) string {
+	t := inline(s)
+	if t == "" {
+		return ""
+	}
+	// Keep surrounding spaces outside the markers
+	lead, trail := "", ""
+	if strings.HasPrefix(s, " ") {
+		lead = " "
+	}
+	if strings.HasSuffix(s, " ") {
+		trail = " "
+	}
+	return lead + mark + t + mark + trail
+}
+
+func inline(s string) string {
+	return strings.TrimSpace(mdSpaceRe.ReplaceAllString(s, " "))
+}
+
+func textOf(n *htmldom.Node) string {
+	var sb strings.Builder
+	var walk func(*htmldom.Node)
+	walk = func(x *htmldom.Node) {
+		if x.Type == htmldom.TextNode {
+			sb.WriteString(x.Data)
+		}
+		for ch := x.FirstChild; ch != nil; ch = ch.NextSibling {
+			walk(ch)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func attr(n *htmldom.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,258 @@
+package html
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"a-a/internal/utils"
+)
+
+const maxSpan = 1000
+
+type tableCell struct {
+	text  string
+	links []string
+	th    bool
+}
+
+// Converts an HTML table into row objects keyed by header text.
+// Required payload:
+//
+//	html: page or fragment
+//
+// Optional payload:
+//
+//	selector: CSS selector for the table(s) (default "table")
+//	index:    which matched table to convert (default 0)
+//	base_url: resolve links inside cells
+//
+// Cells with links also get "<header>_url" (first link) and, when there are
+// several, "<header>_urls".
+//
+// Output:
+//
+//	{ "rows_json": "<[{header: value}]>", "headers_json": "<[header]>", "tables_count": int }
+func handleTable(_ context.Context, payload map[string]any) (map[string]any, error) {
+	htmlStr, err := utils.GetStringPayload(payload, "html")
+	if err != nil {
+		return nil, err
+	}
+	selector, _ := payload["selector"].(string)
+	if strings.TrimSpace(selector) == "" {
+		selector = "table"
+	}
+	baseURL, _ := payload["base_url"].(string)
+	index := 0
+	if v, ok := payload["index"]; ok {
+		if i, err := utils.GetIntPayload(map[string]any{"v": v}, "v"); err == nil && i >= 0 {
+			index = i
+		}
+	}
+
+	doc, err := parseDoc(htmlStr)
+	if err != nil {
+		return nil, fmt.Errorf("parse html: %w", err)
+	}
+	tables := doc.Find(selector).FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return goquery.NodeName(s) == "table"
+	})
+	if tables.Length() == 0 {
+		// Allow selectors that point at a wrapper around the table
+		tables = doc.Find(selector).Find("table")
+	}
+	if tables.Length() == 0 {
+		return nil, fmt.Errorf("html.table: no <table> matches selector %q", selector)
+	}
+	if index >= tables.Length() {
+		return nil, fmt.Errorf("html.table: index %d out of range (%d tables)", index, tables.Length())
+	}
+
+	grid, headerRows := tableGrid(tables.Eq(index), baseURL)
+	headers, rows := tableRows(grid, headerRows)
+
+	br, _ := json.Marshal(rows)
+	bh, _ := json.Marshal(headers)
+	return map[string]any{
+		"rows_json":    string(br),
+		"headers_json": string(bh),
+		"tables_count": tables.Length(),
+	}, nil
+}
+
+// Expands colspan/rowspan into a rectangular grid and reports how many
+// leading rows are header rows.
+func tableGrid(table *goquery.Selection, baseURL string) ([][]tableCell, int) {
+	// Rows of this table only (not of nested tables)
+	trs := table.Find("tr").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return s.Closest("table").IsSelection(table)
+	})
+
+	var grid [][]tableCell
+	pending := map[int]struct {
+		cell tableCell
+		left int
+	}{} // column -> rowspan still to fill
+	headerRows := 0
+	countingHeader := true
+
+	trs.Each(func(_ int, tr *goquery.Selection) {
+		var row []tableCell
+		col := 0
+		fill := func() {
+			for {
+				p, ok := pending[col]
+				if !ok {
+					return
+				}
+				row = append(row, p.cell)
+				if p.left <= 1 {
+					delete(pending, col)
+				} else {
+					p.left--
+					pending[col] = p
+				}
+				col++
+			}
+		}
+
+		allTh := true
+		inHead := tr.ParentsFiltered("thead").Length() > 0
+		tr.ChildrenFiltered("th,td").Each(func(_ int, td *goquery.Selection) {
+			fill()
+			cell := tableCell{
+				text: strings.Join(strings.Fields(td.Text()), " "),
+				th:   goquery.NodeName(td) == "th",
+			}
+			if !cell.th {
+				allTh = false
+			}
+			td.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+				href, _ := a.Attr("href")
+				cell.links = append(cell.links, utils.Absolute(baseURL, href))
+			})
+			colspan := spanAttr(td, "colspan")
+			rowspan := spanAttr(td, "rowspan")
+			for c := 0; c < colspan; c++ {
+				row = append(row, cell)
+				if rowspan > 1 {
+					pending[col] = struct {
+						cell tableCell
+						left int
+					}{cell, rowspan - 1}
+				}
+				col++
+			}
+		})
+		fill()
+		if len(row) == 0 {
+			return
+		}
+		grid = append(grid, row)
+
+		if countingHeader && (inHead || allTh) {
+			headerRows++
+		} else {
+			countingHeader = false
+		}
+	})
+
+	// A table made only of <th> rows has no header/body split
+	if headerRows == len(grid) && len(grid) > 0 {
+		headerRows = 1
+	}
+	return grid, headerRows
+}
+
+func spanAttr(s *goquery.Selection, name string) int {
+	v, ok := s.Attr(name)
+	if !ok {
+		return 1
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 1 {
+		return 1
+	}
+	if n > maxSpan {
+		return maxSpan
+	}
+	return n
+}
+
+func tableRows(grid [][]tableCell, headerRows int) ([]string, []map[string]any) {
+	width := 0
+	for _, r := range grid {
+		if len(r) > width {
+			width = len(r)
+		}
+	}
+
+	// Combine stacked header rows: "Contact / Email"
+	headers := make([]string, width)
+	used := map[string]int{}
+	for c := 0; c < width; c++ {
+		var parts []string
+		for r := 0; r < headerRows; r++ {
+			if c >= len(grid[r]) {
+				continue
+			}
+			t := grid[r][c].text
+			if t != "" && (len(parts) == 0 || parts[len(parts)-1] != t) {
+				parts = append(parts, t)
+			}
+		}
+		name := strings.Join(parts, " / ")
+		if name == "" {
+			if c == 0 && hasRowLabels(grid[headerRows:]) {
+				name = "label"
+			} else {
+				name = fmt.Sprintf("col_%d", c+1)
+			}
+		}
+		used[name]++
+		if used[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, used[name])
+		}
+		headers[c] = name
+	}
+
+	rows := make([]map[string]any, 0, len(grid)-headerRows)
+	for _, r := range grid[headerRows:] {
+		obj := make(map[string]any, width)
+		empty := true
+		for c := 0; c < width; c++ {
+			var cell tableCell
+			if c < len(r) {
+				cell = r[c]
+			}
+			obj[headers[c]] = cell.text
+			if cell.text != "" {
+				empty = false
+			}
+			if len(cell.links) > 0 {
+				obj[headers[c]+"_url"] = cell.links[0]
+				if len(cell.links) > 1 {
+					obj[headers[c]+"_urls"] = cell.links
+				}
+			}
+		}
+		if !empty {
+			rows = append(rows, obj)
+		}
+	}
+	return headers, rows
+}
+
+// True when body rows start with a <th> cell (row labels).
+func hasRowLabels(body [][]tableCell) bool {
+	for _, r := range body {
+		if len(r) > 0 && r[0].th {
+			return true
+		}
+	}
+	return false
+}
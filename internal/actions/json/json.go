@@ -0,0 +1,451 @@
+package json
+
+import (
+	"bytes"
+	"context"
+	stdjson "encoding/json"
+	"fmt"
+	"strings"
+
+	"a-a/internal/utils"
+)
+
+// How json.merge combines two arrays found at the same place.
+type arrayMode int
+
+const (
+	arraysReplace arrayMode = iota
+	arraysConcat
+	arraysUnique
+)
+
+// Runs a jq-style filter or a JSONPath expression over a JSON document.
+// Required payload:
+//
+//	json:  document (JSON string)
+//	query: jq-style (".items[] | select(.price > 10) | {name, url}") or
+//	       JSONPath ("$.items[?(@.price > 10)].name")
+//
+// Output:
+//
+//	{
+//	  "result_json":  the single output, or an array when there are several,
+//	  "results_json": every output as an array,
+//	  "result":       result_json as plain text (strings unquoted),
+//	  "count":        number of outputs
+//	}
+func handleQuery(_ context.Context, payload map[string]any) (map[string]any, error) {
+	doc, err := docPayload(payload, "json")
+	if err != nil {
+		return nil, err
+	}
+	query, err := utils.GetStringPayload(payload, "query")
+	if err != nil {
+		return nil, err
+	}
+	f, err := compileQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	results, err := f(doc)
+	if err != nil {
+		return nil, fmt.Errorf("json.query: %w", err)
+	}
+	if results == nil {
+		results = []any{}
+	}
+
+	var result any = results
+	if len(results) == 1 {
+		result = results[0]
+	}
+	// JSONPath always yields a node list
+	if strings.HasPrefix(strings.TrimSpace(query), "$") {
+		result = results
+	}
+	br, _ := stdjson.Marshal(result)
+	bs, _ := stdjson.Marshal(results)
+	text := utils.ToText(result)
+	if result == nil {
+		text = "null" // as jq -r prints it
+	}
+	return map[string]any{
+		"result_json":  string(br),
+		"results_json": string(bs),
+		"result":       text,
+		"count":        len(results),
+	}, nil
+}
+
+// Merges JSON documents left to right.
+// Required payload (either):
+//
+//	inputs_json: array of documents, e.g. "[@results.a.items_json, @results.b.items_json]"
+//	a_json, b_json: two documents
+//
+// Optional payload:
+//
+//	deep:   merge nested objects recursively (default true; false = top-level only)
+//	arrays: "replace" (default), "concat" or "unique" (concat without duplicates)
+//
+// Top-level arrays are always concatenated (or de-duplicated with "unique").
+//
+// Output:
+//
+//	{ "json": merged document }
+func handleMerge(_ context.Context, payload map[string]any) (map[string]any, error) {
+	var docs []any
+	if _, ok := payload["inputs_json"]; ok {
+		in, err := docPayload(payload, "inputs_json")
+		if err != nil {
+			return nil, err
+		}
+		arr, ok := in.([]any)
+		if !ok {
+			return nil, fmt.Errorf("inputs_json must be a JSON array of documents")
+		}
+		for _, d := range arr {
+			// Tolerate documents passed as JSON strings
+			if s, ok := d.(string); ok {
+				var v any
+				if err := stdjson.Unmarshal([]byte(s), &v); err == nil {
+					d = v
+				}
+			}
+			docs = append(docs, d)
+		}
+	} else {
+		a, err := docPayload(payload, "a_json")
+		if err != nil {
+			return nil, err
+		}
+		b, err := docPayload(payload, "b_json")
+		if err != nil {
+			return nil, err
+		}
+		docs = []any{a, b}
+	}
+
+	mode := arraysReplace
+	switch s, _ := payload["arrays"].(string); strings.ToLower(s) {
+	case "", "replace":
+	case "concat":
+		mode = arraysConcat
+	case "unique":
+		mode = arraysUnique
+	default:
+		return nil, fmt.Errorf("arrays must be replace, concat or unique, got %q", s)
+	}
+	deep := true
+	if v, ok := payload["deep"].(bool); ok {
+		deep = v
+	}
+
+	var merged any
+	for i, d := range docs {
+		if i == 0 {
+			merged = d
+			continue
+		}
+		switch a := merged.(type) {
+		case []any:
+			b, ok := d.([]any)
+			if !ok {
+				return nil, fmt.Errorf("cannot merge %s into an array (input %d)", typeName(d), i)
+			}
+			m := mode
+			if m == arraysReplace {
+				m = arraysConcat
+			}
+			merged = mergeArrays(a, b, m)
+		case map[string]any:
+			b, ok := d.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("cannot merge %s into an object (input %d)", typeName(d), i)
+			}
+			if deep {
+				merged = deepMerge(a, b, mode)
+			} else {
+				merged, _ = applyOp("+", a, b)
+			}
+		case nil:
+			merged = d
+		default:
+			return nil, fmt.Errorf("can only merge objects or arrays, got %s", typeName(merged))
+		}
+	}
+	if merged == nil {
+		merged = map[string]any{}
+	}
+	b, _ := stdjson.Marshal(merged)
+	return map[string]any{"json": string(b)}, nil
+}
+
+func deepMerge(a, b map[string]any, mode arrayMode) map[string]any {
+	out := make(map[string]any, len(a)+len(b))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, bv := range b {
+		av, ok := out[k]
+		if !ok {
+			out[k] = bv
+			continue
+		}
+		switch x := av.(type) {
+		case map[string]any:
+			if y, ok := bv.(map[string]any); ok {
+				out[k] = deepMerge(x, y, mode)
+				continue
+			}
+		case []any:
+			if y, ok := bv.([]any); ok && mode != arraysReplace {
+				out[k] = mergeArrays(x, y, mode)
+				continue
+			}
+		}
+		out[k] = bv
+	}
+	return out
+}
+
+func mergeArrays(a, b []any, mode arrayMode) []any {
+	out := append(append([]any{}, a...), b...)
+	if mode != arraysUnique {
+		return out
+	}
+	uniq := make([]any, 0, len(out))
+	for _, v := range out {
+		dup := false
+		for _, u := range uniq {
+			if compareValues(u, v) == 0 {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			uniq = append(uniq, v)
+		}
+	}
+	return uniq
+}
+
+// Writes a value at a path, creating intermediate objects/arrays.
+// Required payload:
+//
+//	json:  document
+//	path:  "a.b[0].c" ("$." / "." prefixes and ["key"] accepted; [*] sets in every element)
+//	value: any value, or value_json with a JSON-encoded value
+//
+// Output:
+//
+//	{ "json": updated document }
+func handleSet(_ context.Context, payload map[string]any) (map[string]any, error) {
+	doc, err := docPayload(payload, "json")
+	if err != nil {
+		return nil, err
+	}
+	path, err := utils.GetStringPayload(payload, "path")
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if _, ok := payload["value_json"]; ok {
+		if value, err = docPayload(payload, "value_json"); err != nil {
+			return nil, err
+		}
+	} else if v, ok := payload["value"]; ok {
+		value = v
+	} else {
+		return nil, fmt.Errorf("payload is missing required key: 'value' (or 'value_json')")
+	}
+	segs, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	out, err := setPath(doc, segs, value)
+	if err != nil {
+		return nil, fmt.Errorf("json.set %s: %w", path, err)
+	}
+	b, _ := stdjson.Marshal(out)
+	return map[string]any{"json": string(b)}, nil
+}
+
+// Removes values by path; missing paths are ignored.
+// Required payload:
+//
+//	json: document
+//	path: single path, or paths_json with an array of paths
+//
+// Output:
+//
+//	{ "json": updated document, "deleted": int }
+func handleDelete(_ context.Context, payload map[string]any) (map[string]any, error) {
+	doc, err := docPayload(payload, "json")
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	if p, ok := payload["path"].(string); ok && strings.TrimSpace(p) != "" {
+		paths = append(paths, p)
+	}
+	if _, ok := payload["paths_json"]; ok {
+		v, err := docPayload(payload, "paths_json")
+		if err != nil {
+			return nil, err
+		}
+		arr, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("paths_json must be an array of strings")
+		}
+		for _, p := range arr {
+			s, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("paths_json must be an array of strings")
+			}
+			paths = append(paths, s)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("payload is missing required key: 'path' (or 'paths_json')")
+	}
+
+	deleted := 0
+	for _, p := range paths {
+		segs, err := parsePath(p)
+		if err != nil {
+			return nil, err
+		}
+		var n int
+		doc, n = deletePath(doc, segs)
+		deleted += n
+	}
+	b, _ := stdjson.Marshal(doc)
+	return map[string]any{"json": string(b), "deleted": deleted}, nil
+}
+
+// Validates a document against a JSON Schema.
+// Required payload:
+//
+//	json:   document
+//	schema: JSON Schema (object or JSON string)
+//
+// Optional payload:
+//
+//	fail_on_invalid: return an error instead of valid=false (default false)
+//
+// Output:
+//
+//	{ "valid": bool, "errors_json": "<[{path, message}]>" }
+func handleValidate(_ context.Context, payload map[string]any) (map[string]any, error) {
+	doc, err := docPayload(payload, "json")
+	if err != nil {
+		return nil, err
+	}
+	schema, err := docPayload(payload, "schema")
+	if err != nil {
+		return nil, err
+	}
+	errs := validateSchema(schema, doc)
+	if errs == nil {
+		errs = []schemaError{}
+	}
+	if failOnInvalid, _ := payload["fail_on_invalid"].(bool); failOnInvalid && len(errs) > 0 {
+		return nil, fmt.Errorf("json.validate: %s: %s (%d error(s))", errs[0].Path, errs[0].Message, len(errs))
+	}
+	b, _ := stdjson.Marshal(errs)
+	return map[string]any{"valid": len(errs) == 0, "errors_json": string(b)}, nil
+}
+
+// Re-indents or compacts a document, keeping key order.
+// Required payload:
+//
+//	json: document
+//
+// Optional payload:
+//
+//	style:  "pretty" (default) or "compact"
+//	indent: spaces per level for pretty output (default 2)
+//
+// Output:
+//
+//	{ "json": formatted document }
+func handleFormat(_ context.Context, payload map[string]any) (map[string]any, error) {
+	raw, err := rawPayload(payload, "json")
+	if err != nil {
+		return nil, err
+	}
+	style, _ := payload["style"].(string)
+	indent := 2
+	if v, ok := payload["indent"]; ok {
+		if n, err := utils.GetIntPayload(map[string]any{"v": v}, "v"); err == nil && n >= 0 && n <= 8 {
+			indent = n
+		}
+	}
+
+	var buf bytes.Buffer
+	switch strings.ToLower(style) {
+	case "compact":
+		err = stdjson.Compact(&buf, raw)
+	case "", "pretty":
+		err = stdjson.Indent(&buf, raw, "", strings.Repeat(" ", indent))
+	default:
+		return nil, fmt.Errorf("style must be pretty or compact, got %q", style)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return map[string]any{"json": buf.String()}, nil
+}
+
+// Raw JSON bytes of a payload value: a JSON string, or an already-decoded value.
+func rawPayload(payload map[string]any, key string) ([]byte, error) {
+	v, ok := payload[key]
+	if !ok {
+		return nil, fmt.Errorf("payload is missing required key: '%s'", key)
+	}
+	if s, ok := v.(string); ok {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, fmt.Errorf("payload key '%s' is empty", key)
+		}
+		return []byte(s), nil
+	}
+	return stdjson.Marshal(v)
+}
+
+func docPayload(payload map[string]any, key string) (any, error) {
+	v, ok := payload[key]
+	if !ok {
+		return nil, fmt.Errorf("payload is missing required key: '%s'", key)
+	}
+	s, ok := v.(string)
+	if !ok {
+		// Plans may inline objects/arrays directly
+		return v, nil
+	}
+	var doc any
+	if err := stdjson.Unmarshal([]byte(s), &doc); err != nil {
+		return nil, fmt.Errorf("%s is not valid JSON: %w", key, err)
+	}
+	return doc, nil
+}
+
+func HandleJSONAction(ctx context.Context, operation string, payload map[string]any) (map[string]any, error) {
+	switch operation {
+	case "query":
+		return handleQuery(ctx, payload)
+	case "merge":
+		return handleMerge(ctx, payload)
+	case "set":
+		return handleSet(ctx, payload)
+	case "delete":
+		return handleDelete(ctx, payload)
+	case "validate":
+		return handleValidate(ctx, payload)
+	case "format":
+		return handleFormat(ctx, payload)
+	default:
+		return nil, fmt.Errorf("unknown json operation: %s", operation)
+	}
+}
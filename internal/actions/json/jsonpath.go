@@ -0,0 +1,219 @@
+package json
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Translates a JSONPath expression into the equivalent jq-style filter.
+// Supported: $, .name, ['name'], [n], [n,m], [a:b], [*], .*, ..name, ..*,
+// and filters [?(@.price < 10 && @.tag == 'x')].
+func jsonPathToJq(p string) (string, error) {
+	if !strings.HasPrefix(p, "$") {
+		return "", fmt.Errorf("jsonpath must start with $")
+	}
+	stages := []string{"."}
+	tolerant := false // after "..", member access must not fail on scalars
+	i := 1
+	for i < len(p) {
+		switch {
+		case strings.HasPrefix(p[i:], ".."):
+			i += 2
+			switch {
+			case i < len(p) && p[i] == '*':
+				stages = append(stages, "..")
+				i++
+			case i < len(p) && p[i] == '[':
+				stages = append(stages, "..")
+				tolerant = true
+			default:
+				name, n := pathName(p[i:])
+				if name == "" {
+					return "", fmt.Errorf("jsonpath: expected a name after '..' at offset %d", i)
+				}
+				stages = append(stages, fmt.Sprintf("..|objects|select(has(%s))|.[%s]", strconv.Quote(name), strconv.Quote(name)))
+				i += n
+			}
+		case p[i] == '.':
+			i++
+			if i < len(p) && p[i] == '*' {
+				stages = append(stages, ".[]?")
+				i++
+				continue
+			}
+			name, n := pathName(p[i:])
+			if name == "" {
+				return "", fmt.Errorf("jsonpath: expected a name at offset %d", i)
+			}
+			stages = append(stages, ".["+strconv.Quote(name)+"]")
+			i += n
+		case p[i] == '[':
+			end := matchingBracket(p, i)
+			if end < 0 {
+				return "", fmt.Errorf("jsonpath: unbalanced '[' at offset %d", i)
+			}
+			stage, err := pathBracket(strings.TrimSpace(p[i+1:end]), tolerant)
+			if err != nil {
+				return "", err
+			}
+			stages = append(stages, stage)
+			tolerant = false
+			i = end + 1
+		case p[i] == ' ':
+			i++
+		default:
+			return "", fmt.Errorf("jsonpath: unexpected %q at offset %d", p[i], i)
+		}
+	}
+	return strings.Join(stages, " | "), nil
+}
+
+func pathName(s string) (string, int) {
+	n := 0
+	for n < len(s) && s[n] != '.' && s[n] != '[' && s[n] != ' ' {
+		n++
+	}
+	return s[:n], n
+}
+
+// Index of the ']' closing the '[' at open, skipping quotes and parens.
+func matchingBracket(s string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"':
+			quote = c
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+			if depth == 0 && c == ']' {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func pathBracket(inner string, tolerant bool) (string, error) {
+	opt := ""
+	if tolerant {
+		opt = "?"
+	}
+	switch {
+	case inner == "*":
+		return ".[]?", nil
+	case strings.HasPrefix(inner, "?"):
+		expr := strings.TrimSpace(inner[1:])
+		if strings.HasPrefix(expr, "(") && strings.HasSuffix(expr, ")") {
+			expr = expr[1 : len(expr)-1]
+		}
+		cond, err := pathFilter(expr)
+		if err != nil {
+			return "", err
+		}
+		return ".[]? | select(" + cond + ")", nil
+	case !strings.ContainsAny(inner, `'"`) && strings.Contains(inner, ":"):
+		parts := strings.Split(inner, ":")
+		if len(parts) > 2 && strings.TrimSpace(parts[2]) != "" {
+			return "", fmt.Errorf("jsonpath: slice steps are not supported")
+		}
+		return ".[" + strings.TrimSpace(parts[0]) + ":" + strings.TrimSpace(parts[1]) + "]" + opt + " | .[]", nil
+	}
+
+	var sels []string
+	for _, part := range splitTopLevel(inner, ',') {
+		part = strings.TrimSpace(part)
+		switch {
+		case len(part) >= 2 && (part[0] == '\'' || part[0] == '"') && part[len(part)-1] == part[0]:
+			sels = append(sels, ".["+strconv.Quote(unquoteLoose(part))+"]"+opt)
+		default:
+			if _, err := strconv.Atoi(part); err != nil {
+				return "", fmt.Errorf("jsonpath: unsupported selector [%s]", inner)
+			}
+			sels = append(sels, ".["+part+"]"+opt)
+		}
+	}
+	if len(sels) == 1 {
+		return sels[0], nil
+	}
+	return "(" + strings.Join(sels, ", ") + ")", nil
+}
+
+// Rewrites a JSONPath filter expression into jq syntax.
+func pathFilter(expr string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case c == '\'' || c == '"':
+			j := i + 1
+			for j < len(expr) && expr[j] != c {
+				if expr[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(expr) {
+				return "", fmt.Errorf("jsonpath: unterminated string in filter")
+			}
+			sb.WriteString(strconv.Quote(unquoteLoose(expr[i : j+1])))
+			i = j
+		case c == '@':
+			if i+1 >= len(expr) || expr[i+1] != '.' {
+				sb.WriteByte('.')
+			}
+		case strings.HasPrefix(expr[i:], "&&"):
+			sb.WriteString(" and ")
+			i++
+		case strings.HasPrefix(expr[i:], "||"):
+			sb.WriteString(" or ")
+			i++
+		case strings.HasPrefix(expr[i:], "=~"):
+			return "", fmt.Errorf("jsonpath: regex filters are not supported; use a jq query with test()")
+		case c == '!' && !strings.HasPrefix(expr[i:], "!="):
+			return "", fmt.Errorf("jsonpath: '!' is not supported; compare with == false instead")
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), nil
+}
+
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	var quote byte
+	last := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if c == '\'' || c == '"' {
+			quote = c
+		} else if c == sep {
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+func unquoteLoose(q string) string {
+	inner := q[1 : len(q)-1]
+	return strings.NewReplacer(`\'`, `'`, `\"`, `"`, `\\`, `\`).Replace(inner)
+}
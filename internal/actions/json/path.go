@@ -0,0 +1,205 @@
+package json
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// One step of a set/delete path: an object key, an array index or a wildcard.
+type pathSeg struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// Parses "a.b[0].c", ".a.b", "$.a['b c'][*]" or `items[-1]["x.y"]`.
+func parsePath(p string) ([]pathSeg, error) {
+	s := strings.TrimSpace(p)
+	s = strings.TrimPrefix(s, "$")
+	var segs []pathSeg
+	i := 0
+	for i < len(s) {
+		switch s[i] {
+		case '.':
+			i++
+		case '[':
+			end := matchingBracket(s, i)
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unbalanced '['", p)
+			}
+			inner := strings.TrimSpace(s[i+1 : end])
+			switch {
+			case inner == "" || inner == "*":
+				segs = append(segs, pathSeg{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segs = append(segs, pathSeg{key: unquoteLoose(inner)})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("path %q: bad index [%s]", p, inner)
+				}
+				segs = append(segs, pathSeg{index: n, isIndex: true})
+			}
+			i = end + 1
+		default:
+			j := i
+			for j < len(s) && s[j] != '.' && s[j] != '[' {
+				j++
+			}
+			name := s[i:j]
+			if name == "*" {
+				segs = append(segs, pathSeg{wildcard: true})
+			} else {
+				segs = append(segs, pathSeg{key: name})
+			}
+			i = j
+		}
+	}
+	return segs, nil
+}
+
+// Returns a copy of doc with value written at path, creating missing
+// objects/arrays along the way. A wildcard writes into every element.
+func setPath(doc any, segs []pathSeg, value any) (any, error) {
+	if len(segs) == 0 {
+		return value, nil
+	}
+	seg, rest := segs[0], segs[1:]
+	switch {
+	case seg.wildcard:
+		switch t := doc.(type) {
+		case []any:
+			out := make([]any, len(t))
+			for i, v := range t {
+				nv, err := setPath(v, rest, value)
+				if err != nil {
+					return nil, err
+				}
+				out[i] = nv
+			}
+			return out, nil
+		case map[string]any:
+			out := make(map[string]any, len(t))
+			for k, v := range t {
+				nv, err := setPath(v, rest, value)
+				if err != nil {
+					return nil, err
+				}
+				out[k] = nv
+			}
+			return out, nil
+		}
+		return nil, fmt.Errorf("cannot apply [*] to %s", typeName(doc))
+	case seg.isIndex:
+		var arr []any
+		switch t := doc.(type) {
+		case nil:
+		case []any:
+			arr = append([]any{}, t...)
+		default:
+			return nil, fmt.Errorf("cannot index %s with [%d]", typeName(doc), seg.index)
+		}
+		i := seg.index
+		if i < 0 {
+			i += len(arr)
+			if i < 0 {
+				return nil, fmt.Errorf("index %d out of range", seg.index)
+			}
+		}
+		for len(arr) <= i {
+			arr = append(arr, nil)
+		}
+		nv, err := setPath(arr[i], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = nv
+		return arr, nil
+	default:
+		var obj map[string]any
+		switch t := doc.(type) {
+		case nil:
+			obj = map[string]any{}
+		case map[string]any:
+			obj = make(map[string]any, len(t)+1)
+			for k, v := range t {
+				obj[k] = v
+			}
+		default:
+			return nil, fmt.Errorf("cannot set key %q on %s", seg.key, typeName(doc))
+		}
+		nv, err := setPath(obj[seg.key], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		obj[seg.key] = nv
+		return obj, nil
+	}
+}
+
+// Returns a copy of doc without the value at path and how many values were
+// removed. Missing paths are not an error.
+func deletePath(doc any, segs []pathSeg) (any, int) {
+	if len(segs) == 0 {
+		return doc, 0
+	}
+	seg, rest := segs[0], segs[1:]
+	last := len(rest) == 0
+	switch t := doc.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, v := range t {
+			out[k] = v
+		}
+		n := 0
+		for _, k := range sortedKeys(t) {
+			if !seg.wildcard && (seg.isIndex || k != seg.key) {
+				continue
+			}
+			if last {
+				delete(out, k)
+				n++
+				continue
+			}
+			nv, c := deletePath(t[k], rest)
+			out[k] = nv
+			n += c
+		}
+		return out, n
+	case []any:
+		if seg.wildcard {
+			if last {
+				return []any{}, len(t)
+			}
+			out := make([]any, len(t))
+			n := 0
+			for i, v := range t {
+				nv, c := deletePath(v, rest)
+				out[i] = nv
+				n += c
+			}
+			return out, n
+		}
+		if !seg.isIndex {
+			return doc, 0
+		}
+		i := seg.index
+		if i < 0 {
+			i += len(t)
+		}
+		if i < 0 || i >= len(t) {
+			return doc, 0
+		}
+		if last {
+			out := append(append([]any{}, t[:i]...), t[i+1:]...)
+			return out, 1
+		}
+		out := append([]any{}, t...)
+		nv, c := deletePath(t[i], rest)
+		out[i] = nv
+		return out, c
+	}
+	return doc, 0
+}
@@ -0,0 +1,2076 @@
+package json
+
+import (
+	stdjson "encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"a-a/internal/utils"
+)
+
+// A compiled filter maps one input value to zero or more outputs, jq-style.
+type filter func(in any) ([]any, error)
+
+// Compiles a jq-style filter (".items[] | select(.price > 10) | {name, url}")
+// or a JSONPath expression ("$.items[?(@.price > 10)].name").
+func compileQuery(q string) (filter, error) {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		q = "."
+	}
+	if strings.HasPrefix(q, "$") {
+		conv, err := jsonPathToJq(q)
+		if err != nil {
+			return nil, err
+		}
+		q = conv
+	}
+	toks, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &qparser{toks: toks}
+	f, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if !p.at(tEOF) {
+		return nil, fmt.Errorf("query: unexpected %q at offset %d", p.peek().text, p.peek().pos)
+	}
+	return f, nil
+}
+
+// ---- lexer ----
+
+type tokKind int
+
+const (
+	tEOF tokKind = iota
+	tDot
+	tRecurse
+	tField
+	tIdent
+	tString
+	tNumber
+	tPunct
+)
+
+type token struct {
+	kind tokKind
+	text string
+	num  float64
+	pos  int
+}
+
+var punct2 = []string{"==", "!=", "<=", ">=", "//"}
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '.':
+			if i+1 < len(s) && s[i+1] == '.' {
+				toks = append(toks, token{kind: tRecurse, text: "..", pos: i})
+				i += 2
+			} else if i+1 < len(s) && isIdentStart(rune(s[i+1])) {
+				j := i + 1
+				for j < len(s) && isIdentChar(rune(s[j])) {
+					j++
+				}
+				toks = append(toks, token{kind: tField, text: s[i+1 : j], pos: i})
+				i = j
+			} else if i+1 < len(s) && s[i+1] == '"' {
+				str, n, err := lexString(s[i+1:])
+				if err != nil {
+					return nil, err
+				}
+				toks = append(toks, token{kind: tField, text: str, pos: i})
+				i += 1 + n
+			} else {
+				toks = append(toks, token{kind: tDot, text: ".", pos: i})
+				i++
+			}
+		case c == '"':
+			str, n, err := lexString(s[i:])
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{kind: tString, text: str, pos: i})
+			i += n
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == 'e' || s[j] == 'E' ||
+				((s[j] == '+' || s[j] == '-') && (s[j-1] == 'e' || s[j-1] == 'E'))) {
+				j++
+			}
+			f, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("query: bad number %q", s[i:j])
+			}
+			toks = append(toks, token{kind: tNumber, text: s[i:j], num: f, pos: i})
+			i = j
+		case isIdentStart(rune(c)) || c == '$':
+			j := i + 1
+			for j < len(s) && isIdentChar(rune(s[j])) {
+				j++
+			}
+			toks = append(toks, token{kind: tIdent, text: s[i:j], pos: i})
+			i = j
+		default:
+			matched := false
+			for _, p := range punct2 {
+				if strings.HasPrefix(s[i:], p) {
+					toks = append(toks, token{kind: tPunct, text: p, pos: i})
+					i += len(p)
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+			if strings.ContainsRune("[]{}()|,:;?+-*/%<>", rune(c)) {
+				toks = append(toks, token{kind: tPunct, text: string(c), pos: i})
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("query: unexpected character %q at offset %d", c, i)
+		}
+	}
+	return append(toks, token{kind: tEOF, pos: len(s)}), nil
+}
+
+// Reads a double-quoted string literal; returns its value and length consumed.
+func lexString(s string) (string, int, error) {
+	for j := 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '"':
+			v, err := strconv.Unquote(s[:j+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("query: bad string literal %s", s[:j+1])
+			}
+			return v, j + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("query: unterminated string")
+}
+
+func isIdentStart(r rune) bool { return r == '_' || unicode.IsLetter(r) }
+func isIdentChar(r rune) bool  { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+// ---- parser ----
+
+type qparser struct {
+	toks []token
+	i    int
+}
+
+func (p *qparser) peek() token { return p.toks[p.i] }
+func (p *qparser) next() token { t := p.toks[p.i]; p.i++; return t }
+func (p *qparser) at(k tokKind) bool {
+	return p.toks[p.i].kind == k
+}
+func (p *qparser) isPunct(s string) bool {
+	t := p.toks[p.i]
+	return t.kind == tPunct && t.text == s
+}
+func (p *qparser) isKeyword(s string) bool {
+	t := p.toks[p.i]
+	return t.kind == tIdent && t.text == s
+}
+
+func (p *qparser) expect(s string) error {
+	if !p.isPunct(s) && !p.isKeyword(s) {
+		t := p.peek()
+		if t.kind == tEOF {
+			return fmt.Errorf("query: expected %q, got end of query", s)
+		}
+		return fmt.Errorf("query: expected %q at offset %d, got %q", s, t.pos, t.text)
+	}
+	p.i++
+	return nil
+}
+
+func (p *qparser) parsePipe() (filter, error) {
+	left, err := p.parseComma()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("|") {
+		p.i++
+		right, err := p.parseComma()
+		if err != nil {
+			return nil, err
+		}
+		l, r := left, right
+		left = func(in any) ([]any, error) {
+			mid, err := l(in)
+			if err != nil {
+				return nil, err
+			}
+			var out []any
+			for _, v := range mid {
+				res, err := r(v)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, res...)
+			}
+			return out, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *qparser) parseComma() (filter, error) {
+	left, err := p.parseAlt()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct(",") {
+		p.i++
+		right, err := p.parseAlt()
+		if err != nil {
+			return nil, err
+		}
+		l, r := left, right
+		left = func(in any) ([]any, error) {
+			a, err := l(in)
+			if err != nil {
+				return nil, err
+			}
+			b, err := r(in)
+			if err != nil {
+				return nil, err
+			}
+			return append(a, b...), nil
+		}
+	}
+	return left, nil
+}
+
+func (p *qparser) parseAlt() (filter, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("//") {
+		p.i++
+		right, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		l, r := left, right
+		left = func(in any) ([]any, error) {
+			a, _ := l(in) // errors on the left side fall through to the default
+			var out []any
+			for _, v := range a {
+				if truthy(v) {
+					out = append(out, v)
+				}
+			}
+			if len(out) > 0 {
+				return out, nil
+			}
+			return r(in)
+		}
+	}
+	return left, nil
+}
+
+func (p *qparser) parseOr() (filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.i++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logical(left, right, true)
+	}
+	return left, nil
+}
+
+func (p *qparser) parseAnd() (filter, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.i++
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = logical(left, right, false)
+	}
+	return left, nil
+}
+
+func logical(l, r filter, isOr bool) filter {
+	return func(in any) ([]any, error) {
+		a, err := l(in)
+		if err != nil {
+			return nil, err
+		}
+		var out []any
+		for _, v := range a {
+			if truthy(v) == isOr {
+				out = append(out, isOr)
+				continue
+			}
+			b, err := r(in)
+			if err != nil {
+				return nil, err
+			}
+			for _, w := range b {
+				out = append(out, truthy(w))
+			}
+		}
+		return out, nil
+	}
+}
+
+func (p *qparser) parseCompare() (filter, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.isPunct(op) {
+			p.i++
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return binary(left, right, op), nil
+		}
+	}
+	return left, nil
+}
+
+func (p *qparser) parseAdditive() (filter, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("+") || p.isPunct("-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binary(left, right, op)
+	}
+	return left, nil
+}
+
+func (p *qparser) parseMultiplicative() (filter, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("*") || p.isPunct("/") || p.isPunct("%") {
+		op := p.next().text
+		right, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		left = binary(left, right, op)
+	}
+	return left, nil
+}
+
+func binary(l, r filter, op string) filter {
+	return func(in any) ([]any, error) {
+		rs, err := r(in)
+		if err != nil {
+			return nil, err
+		}
+		ls, err := l(in)
+		if err != nil {
+			return nil, err
+		}
+		var out []any
+		for _, b := range rs {
+			for _, a := range ls {
+				v, err := applyOp(op, a, b)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, v)
+			}
+		}
+		return out, nil
+	}
+}
+
+// A postfix step applied to each value t produced by a term. in is the
+// term's own input: index expressions like .[.n] are evaluated against it.
+type step func(in, t any) ([]any, error)
+
+func (p *qparser) parsePostfix() (filter, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	var steps []step
+	for {
+		switch {
+		case p.at(tField):
+			name := p.next().text
+			steps = append(steps, func(_, t any) ([]any, error) {
+				v, err := indexValue(t, name)
+				if err != nil {
+					return nil, err
+				}
+				return []any{v}, nil
+			})
+		case p.at(tDot) && p.toks[p.i+1].kind == tPunct && p.toks[p.i+1].text == "[":
+			p.i++ // ".[" after a term, as in ".a.[0]"
+		case p.isPunct("["):
+			st, err := p.parseBracket()
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, st)
+		case p.isPunct("?"):
+			// Suppresses errors of the step just before it only
+			p.i++
+			if len(steps) == 0 {
+				g := base
+				base = func(in any) ([]any, error) {
+					out, err := g(in)
+					if err != nil {
+						return nil, nil
+					}
+					return out, nil
+				}
+				continue
+			}
+			last := steps[len(steps)-1]
+			steps[len(steps)-1] = func(in, t any) ([]any, error) {
+				out, err := last(in, t)
+				if err != nil {
+					return nil, nil
+				}
+				return out, nil
+			}
+		default:
+			return applySteps(base, steps), nil
+		}
+	}
+}
+
+func applySteps(base filter, steps []step) filter {
+	if len(steps) == 0 {
+		return base
+	}
+	return func(in any) ([]any, error) {
+		vals, err := base(in)
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range steps {
+			var next []any
+			for _, v := range vals {
+				res, err := st(in, v)
+				if err != nil {
+					return nil, err
+				}
+				next = append(next, res...)
+			}
+			vals = next
+		}
+		return vals, nil
+	}
+}
+
+// Parses a bracket suffix: [] iterates, [e] indexes, [a:b] slices.
+func (p *qparser) parseBracket() (step, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	if p.isPunct("]") {
+		p.i++
+		return func(_, t any) ([]any, error) { return iterate(t) }, nil
+	}
+	var idx, end filter
+	slice := false
+	if !p.isPunct(":") {
+		f, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		idx = f
+	}
+	if p.isPunct(":") {
+		p.i++
+		slice = true
+		if !p.isPunct("]") {
+			f, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			end = f
+		}
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+
+	if !slice {
+		return func(in, t any) ([]any, error) {
+			keys, err := idx(in)
+			if err != nil {
+				return nil, err
+			}
+			out := make([]any, 0, len(keys))
+			for _, k := range keys {
+				v, err := indexValue(t, k)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, v)
+			}
+			return out, nil
+		}, nil
+	}
+	return func(in, t any) ([]any, error) {
+		from, to := []any{nil}, []any{nil}
+		var err error
+		if idx != nil {
+			if from, err = idx(in); err != nil {
+				return nil, err
+			}
+		}
+		if end != nil {
+			if to, err = end(in); err != nil {
+				return nil, err
+			}
+		}
+		var out []any
+		for _, a := range from {
+			for _, z := range to {
+				v, err := sliceValue(t, a, z)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, v)
+			}
+		}
+		return out, nil
+	}, nil
+}
+
+func (p *qparser) parsePrimary() (filter, error) {
+	t := p.peek()
+	switch t.kind {
+	case tEOF:
+		return nil, fmt.Errorf("query: unexpected end of query")
+	case tDot:
+		p.i++
+		return identity, nil
+	case tField:
+		// Handled as a postfix on identity
+		return identity, nil
+	case tRecurse:
+		p.i++
+		return func(in any) ([]any, error) { return recurse(in, nil), nil }, nil
+	case tNumber:
+		p.i++
+		return constant(t.num), nil
+	case tString:
+		p.i++
+		return constant(t.text), nil
+	case tIdent:
+		return p.parseIdent()
+	}
+
+	switch t.text {
+	case "(":
+		p.i++
+		f, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	case "[":
+		p.i++
+		if p.isPunct("]") {
+			p.i++
+			return constant([]any{}), nil
+		}
+		f, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return func(in any) ([]any, error) {
+			vals, err := f(in)
+			if err != nil {
+				return nil, err
+			}
+			if vals == nil {
+				vals = []any{}
+			}
+			return []any{vals}, nil
+		}, nil
+	case "{":
+		return p.parseObject()
+	case "-":
+		p.i++
+		f, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		return binary(constant(0.0), f, "-"), nil
+	}
+	return nil, fmt.Errorf("query: unexpected %q at offset %d", t.text, t.pos)
+}
+
+func (p *qparser) parseObject() (filter, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	type entry struct {
+		key filter
+		val filter
+	}
+	var entries []entry
+	for !p.isPunct("}") {
+		var e entry
+		t := p.peek()
+		var shorthand string
+		switch {
+		case t.kind == tIdent || t.kind == tString:
+			p.i++
+			e.key = constant(t.text)
+			shorthand = t.text
+		case t.kind == tNumber:
+			p.i++
+			e.key = constant(t.text)
+		case p.isPunct("("):
+			p.i++
+			k, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			e.key = k
+		default:
+			return nil, fmt.Errorf("query: bad object key at offset %d", t.pos)
+		}
+		if p.isPunct(":") {
+			p.i++
+			v, err := p.parseAlt()
+			if err != nil {
+				return nil, err
+			}
+			e.val = v
+		} else if shorthand != "" {
+			name := shorthand
+			e.val = func(in any) ([]any, error) {
+				v, err := indexValue(in, name)
+				if err != nil {
+					return nil, err
+				}
+				return []any{v}, nil
+			}
+		} else {
+			return nil, fmt.Errorf("query: object key at offset %d needs a value", t.pos)
+		}
+		entries = append(entries, e)
+		if !p.isPunct(",") {
+			break
+		}
+		p.i++
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return func(in any) ([]any, error) {
+		objs := []map[string]any{{}}
+		for _, e := range entries {
+			keys, err := e.key(in)
+			if err != nil {
+				return nil, err
+			}
+			vals, err := e.val(in)
+			if err != nil {
+				return nil, err
+			}
+			var next []map[string]any
+			for _, o := range objs {
+				for _, k := range keys {
+					ks, ok := k.(string)
+					if !ok {
+						return nil, fmt.Errorf("object keys must be strings, got %s", typeName(k))
+					}
+					for _, v := range vals {
+						c := make(map[string]any, len(o)+1)
+						for kk, vv := range o {
+							c[kk] = vv
+						}
+						c[ks] = v
+						next = append(next, c)
+					}
+				}
+			}
+			objs = next
+		}
+		out := make([]any, len(objs))
+		for i, o := range objs {
+			out[i] = o
+		}
+		return out, nil
+	}, nil
+}
+
+func (p *qparser) parseIdent() (filter, error) {
+	name := p.next().text
+	switch name {
+	case "true":
+		return constant(true), nil
+	case "false":
+		return constant(false), nil
+	case "null":
+		return constant(nil), nil
+	case "if":
+		return p.parseIf()
+	}
+	if strings.HasPrefix(name, "$") {
+		return nil, fmt.Errorf("query: variables (%s) are not supported", name)
+	}
+
+	var args []filter
+	if p.isPunct("(") {
+		p.i++
+		for {
+			a, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, a)
+			if p.isPunct(";") {
+				p.i++
+				continue
+			}
+			break
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	return builtin(name, args)
+}
+
+func (p *qparser) parseIf() (filter, error) {
+	cond, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("then"); err != nil {
+		return nil, err
+	}
+	then, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	otherwise := identity
+	switch {
+	case p.isKeyword("elif"):
+		p.i++
+		otherwise, err = p.parseIf()
+		if err != nil {
+			return nil, err
+		}
+		return ifFilter(cond, then, otherwise), nil
+	case p.isKeyword("else"):
+		p.i++
+		otherwise, err = p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("end"); err != nil {
+		return nil, err
+	}
+	return ifFilter(cond, then, otherwise), nil
+}
+
+func ifFilter(cond, then, otherwise filter) filter {
+	return func(in any) ([]any, error) {
+		cs, err := cond(in)
+		if err != nil {
+			return nil, err
+		}
+		var out []any
+		for _, c := range cs {
+			branch := otherwise
+			if truthy(c) {
+				branch = then
+			}
+			res, err := branch(in)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, res...)
+		}
+		return out, nil
+	}
+}
+
+func identity(in any) ([]any, error) { return []any{in}, nil }
+
+func constant(v any) filter {
+	return func(any) ([]any, error) { return []any{v}, nil }
+}
+
+// ---- builtins ----
+
+func builtin(name string, args []filter) (filter, error) {
+	arity := len(args)
+	one := func(fn func(in any) (any, error)) filter {
+		return func(in any) ([]any, error) {
+			v, err := fn(in)
+			if err != nil {
+				return nil, err
+			}
+			return []any{v}, nil
+		}
+	}
+	// Evaluates a value argument once per output and applies fn to each.
+	withArg := func(a filter, fn func(in, arg any) (any, error)) filter {
+		return func(in any) ([]any, error) {
+			vals, err := a(in)
+			if err != nil {
+				return nil, err
+			}
+			out := make([]any, 0, len(vals))
+			for _, v := range vals {
+				r, err := fn(in, v)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, r)
+			}
+			return out, nil
+		}
+	}
+	typeFilter := func(kinds ...string) filter {
+		return func(in any) ([]any, error) {
+			t := typeName(in)
+			for _, k := range kinds {
+				if t == k {
+					return []any{in}, nil
+				}
+			}
+			return nil, nil
+		}
+	}
+
+	switch fmt.Sprintf("%s/%d", name, arity) {
+	case "empty/0":
+		return func(any) ([]any, error) { return nil, nil }, nil
+	case "not/0":
+		return one(func(in any) (any, error) { return !truthy(in), nil }), nil
+	case "length/0":
+		return one(length), nil
+	case "type/0":
+		return one(func(in any) (any, error) { return typeName(in), nil }), nil
+	case "keys/0", "keys_unsorted/0":
+		return one(func(in any) (any, error) {
+			switch t := in.(type) {
+			case map[string]any:
+				ks := sortedKeys(t)
+				out := make([]any, len(ks))
+				for i, k := range ks {
+					out[i] = k
+				}
+				return out, nil
+			case []any:
+				out := make([]any, len(t))
+				for i := range t {
+					out[i] = float64(i)
+				}
+				return out, nil
+			}
+			return nil, fmt.Errorf("%s has no keys", typeName(in))
+		}), nil
+	case "values/0":
+		return func(in any) ([]any, error) {
+			if in == nil {
+				return nil, nil
+			}
+			return []any{in}, nil
+		}, nil
+	case "arrays/0":
+		return typeFilter("array"), nil
+	case "objects/0":
+		return typeFilter("object"), nil
+	case "strings/0":
+		return typeFilter("string"), nil
+	case "numbers/0":
+		return typeFilter("number"), nil
+	case "booleans/0":
+		return typeFilter("boolean"), nil
+	case "nulls/0":
+		return typeFilter("null"), nil
+	case "iterables/0":
+		return typeFilter("array", "object"), nil
+	case "scalars/0":
+		return typeFilter("null", "boolean", "number", "string"), nil
+	case "recurse/0":
+		return func(in any) ([]any, error) { return recurse(in, nil), nil }, nil
+	case "tostring/0":
+		return one(func(in any) (any, error) {
+			if in == nil {
+				return "null", nil
+			}
+			return utils.ToText(in), nil
+		}), nil
+	case "tojson/0":
+		return one(func(in any) (any, error) {
+			b, err := stdjson.Marshal(in)
+			return string(b), err
+		}), nil
+	case "fromjson/0":
+		return one(func(in any) (any, error) {
+			s, ok := in.(string)
+			if !ok {
+				return nil, fmt.Errorf("fromjson needs a string, got %s", typeName(in))
+			}
+			var v any
+			if err := stdjson.Unmarshal([]byte(s), &v); err != nil {
+				return nil, fmt.Errorf("fromjson: %w", err)
+			}
+			return v, nil
+		}), nil
+	case "tonumber/0":
+		return one(func(in any) (any, error) {
+			switch t := in.(type) {
+			case float64:
+				return t, nil
+			case string:
+				f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse %q as a number", t)
+				}
+				return f, nil
+			}
+			return nil, fmt.Errorf("%s cannot be parsed as a number", typeName(in))
+		}), nil
+	case "ascii_downcase/0", "ascii_upcase/0", "trim/0", "ltrim/0", "rtrim/0":
+		return one(func(in any) (any, error) {
+			s, ok := in.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s needs a string, got %s", name, typeName(in))
+			}
+			switch name {
+			case "ascii_downcase":
+				return strings.ToLower(s), nil
+			case "ascii_upcase":
+				return strings.ToUpper(s), nil
+			case "ltrim":
+				return strings.TrimLeftFunc(s, unicode.IsSpace), nil
+			case "rtrim":
+				return strings.TrimRightFunc(s, unicode.IsSpace), nil
+			}
+			return strings.TrimSpace(s), nil
+		}), nil
+	case "floor/0", "ceil/0", "round/0", "abs/0", "sqrt/0":
+		return one(func(in any) (any, error) {
+			f, ok := in.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s needs a number, got %s", name, typeName(in))
+			}
+			switch name {
+			case "floor":
+				return math.Floor(f), nil
+			case "ceil":
+				return math.Ceil(f), nil
+			case "round":
+				return math.Round(f), nil
+			case "sqrt":
+				return math.Sqrt(f), nil
+			}
+			return math.Abs(f), nil
+		}), nil
+	case "sort/0":
+		return one(func(in any) (any, error) { return sortBy(in, nil) }), nil
+	case "unique/0":
+		return one(func(in any) (any, error) { return uniqueBy(in, nil) }), nil
+	case "reverse/0":
+		return one(func(in any) (any, error) {
+			switch t := in.(type) {
+			case nil:
+				return []any{}, nil
+			case string:
+				r := []rune(t)
+				for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+					r[i], r[j] = r[j], r[i]
+				}
+				return string(r), nil
+			case []any:
+				out := make([]any, len(t))
+				for i, v := range t {
+					out[len(t)-1-i] = v
+				}
+				return out, nil
+			}
+			return nil, fmt.Errorf("cannot reverse %s", typeName(in))
+		}), nil
+	case "min/0", "max/0":
+		return one(func(in any) (any, error) { return extreme(in, nil, name == "max") }), nil
+	case "add/0":
+		return one(func(in any) (any, error) {
+			arr, err := iterate(in)
+			if err != nil {
+				return nil, err
+			}
+			var acc any
+			for _, v := range arr {
+				if acc, err = applyOp("+", acc, v); err != nil {
+					return nil, err
+				}
+			}
+			return acc, nil
+		}), nil
+	case "first/0", "last/0":
+		return one(func(in any) (any, error) {
+			arr, ok := in.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s needs an array, got %s", name, typeName(in))
+			}
+			if len(arr) == 0 {
+				return nil, nil
+			}
+			if name == "first" {
+				return arr[0], nil
+			}
+			return arr[len(arr)-1], nil
+		}), nil
+	case "flatten/0":
+		return one(func(in any) (any, error) { return flatten(in, -1) }), nil
+	case "flatten/1":
+		return withArg(args[0], func(in, d any) (any, error) {
+			depth, ok := d.(float64)
+			if !ok || depth < 0 {
+				return nil, fmt.Errorf("flatten depth must be a non-negative number")
+			}
+			return flatten(in, int(depth))
+		}), nil
+	case "to_entries/0":
+		return one(toEntries), nil
+	case "from_entries/0":
+		return one(fromEntries), nil
+	case "any/0", "all/0":
+		return one(func(in any) (any, error) {
+			arr, err := iterate(in)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range arr {
+				if truthy(v) == (name == "any") {
+					return name == "any", nil
+				}
+			}
+			return name == "all", nil
+		}), nil
+
+	case "select/1":
+		return func(in any) ([]any, error) {
+			cs, err := args[0](in)
+			if err != nil {
+				return nil, err
+			}
+			var out []any
+			for _, c := range cs {
+				if truthy(c) {
+					out = append(out, in)
+				}
+			}
+			return out, nil
+		}, nil
+	case "map/1":
+		return one(func(in any) (any, error) {
+			vals, err := iterate(in)
+			if err != nil {
+				return nil, err
+			}
+			out := []any{}
+			for _, v := range vals {
+				res, err := args[0](v)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, res...)
+			}
+			return out, nil
+		}), nil
+	case "map_values/1":
+		return one(func(in any) (any, error) {
+			switch t := in.(type) {
+			case map[string]any:
+				out := make(map[string]any, len(t))
+				for k, v := range t {
+					res, err := args[0](v)
+					if err != nil {
+						return nil, err
+					}
+					if len(res) > 0 {
+						out[k] = res[0]
+					}
+				}
+				return out, nil
+			case []any:
+				out := make([]any, 0, len(t))
+				for _, v := range t {
+					res, err := args[0](v)
+					if err != nil {
+						return nil, err
+					}
+					if len(res) > 0 {
+						out = append(out, res[0])
+					}
+				}
+				return out, nil
+			}
+			return nil, fmt.Errorf("cannot map_values over %s", typeName(in))
+		}), nil
+	case "with_entries/1":
+		return one(func(in any) (any, error) {
+			ents, err := toEntries(in)
+			if err != nil {
+				return nil, err
+			}
+			mapped := []any{}
+			for _, e := range ents.([]any) {
+				res, err := args[0](e)
+				if err != nil {
+					return nil, err
+				}
+				mapped = append(mapped, res...)
+			}
+			return fromEntries(mapped)
+		}), nil
+	case "recurse/1":
+		return func(in any) ([]any, error) {
+			var out []any
+			var walk func(v any, depth int) error
+			walk = func(v any, depth int) error {
+				if depth > 1000 {
+					return fmt.Errorf("recurse: too deep")
+				}
+				out = append(out, v)
+				kids, err := args[0](v)
+				if err != nil {
+					return nil // like recurse(f?)
+				}
+				for _, k := range kids {
+					if err := walk(k, depth+1); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			return out, walk(in, 0)
+		}, nil
+	case "has/1":
+		return withArg(args[0], func(in, k any) (any, error) {
+			switch t := in.(type) {
+			case map[string]any:
+				ks, ok := k.(string)
+				if !ok {
+					return nil, fmt.Errorf("has: object keys are strings")
+				}
+				_, ok = t[ks]
+				return ok, nil
+			case []any:
+				i, ok := k.(float64)
+				if !ok {
+					return nil, fmt.Errorf("has: array keys are numbers")
+				}
+				return i >= 0 && int(i) < len(t), nil
+			}
+			return nil, fmt.Errorf("cannot check whether %s has a key", typeName(in))
+		}), nil
+	case "contains/1":
+		return withArg(args[0], func(in, b any) (any, error) { return contains(in, b), nil }), nil
+	case "inside/1":
+		return withArg(args[0], func(in, b any) (any, error) { return contains(b, in), nil }), nil
+	case "startswith/1", "endswith/1", "ltrimstr/1", "rtrimstr/1", "split/1", "index/1", "rindex/1":
+		return withArg(args[0], func(in, a any) (any, error) {
+			s, ok1 := in.(string)
+			arg, ok2 := a.(string)
+			if !ok1 || !ok2 {
+				if name == "ltrimstr" || name == "rtrimstr" {
+					return in, nil
+				}
+				return nil, fmt.Errorf("%s needs string input and argument", name)
+			}
+			switch name {
+			case "startswith":
+				return strings.HasPrefix(s, arg), nil
+			case "endswith":
+				return strings.HasSuffix(s, arg), nil
+			case "ltrimstr":
+				return strings.TrimPrefix(s, arg), nil
+			case "rtrimstr":
+				return strings.TrimSuffix(s, arg), nil
+			case "index", "rindex":
+				i := strings.Index(s, arg)
+				if name == "rindex" {
+					i = strings.LastIndex(s, arg)
+				}
+				if i < 0 {
+					return nil, nil
+				}
+				return float64(utf8.RuneCountInString(s[:i])), nil
+			}
+			parts := strings.Split(s, arg)
+			out := make([]any, len(parts))
+			for i, p := range parts {
+				out[i] = p
+			}
+			return out, nil
+		}), nil
+	case "join/1":
+		return withArg(args[0], func(in, sep any) (any, error) {
+			arr, ok := in.([]any)
+			s, ok2 := sep.(string)
+			if !ok || !ok2 {
+				return nil, fmt.Errorf("join needs an array input and a string separator")
+			}
+			parts := make([]string, len(arr))
+			for i, v := range arr {
+				if v != nil {
+					parts[i] = utils.ToText(v)
+				}
+			}
+			return strings.Join(parts, s), nil
+		}), nil
+	case "test/1", "test/2", "match/1", "capture/1", "scan/1", "sub/2", "gsub/2", "sub/3", "gsub/3":
+		return regexBuiltin(name, args)
+	case "sort_by/1":
+		return one(func(in any) (any, error) { return sortBy(in, args[0]) }), nil
+	case "unique_by/1":
+		return one(func(in any) (any, error) { return uniqueBy(in, args[0]) }), nil
+	case "group_by/1":
+		return one(func(in any) (any, error) { return groupBy(in, args[0]) }), nil
+	case "min_by/1", "max_by/1":
+		return one(func(in any) (any, error) { return extreme(in, args[0], name == "max_by") }), nil
+	case "first/1", "last/1":
+		return func(in any) ([]any, error) {
+			vals, err := args[0](in)
+			if err != nil || len(vals) == 0 {
+				return nil, err
+			}
+			if name == "first" {
+				return vals[:1], nil
+			}
+			return vals[len(vals)-1:], nil
+		}, nil
+	case "limit/2":
+		return func(in any) ([]any, error) {
+			ns, err := args[0](in)
+			if err != nil {
+				return nil, err
+			}
+			vals, err := args[1](in)
+			if err != nil {
+				return nil, err
+			}
+			var out []any
+			for _, n := range ns {
+				k, _ := n.(float64)
+				if int(k) < len(vals) {
+					out = append(out, vals[:max(int(k), 0)]...)
+				} else {
+					out = append(out, vals...)
+				}
+			}
+			return out, nil
+		}, nil
+	case "any/1", "all/1":
+		return one(func(in any) (any, error) {
+			vals, err := iterate(in)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range vals {
+				cs, err := args[0](v)
+				if err != nil {
+					return nil, err
+				}
+				for _, c := range cs {
+					if truthy(c) == (name == "any") {
+						return name == "any", nil
+					}
+				}
+			}
+			return name == "all", nil
+		}), nil
+	case "range/1", "range/2":
+		return func(in any) ([]any, error) {
+			from, to := []any{0.0}, []any(nil)
+			var err error
+			if arity == 2 {
+				if from, err = args[0](in); err != nil {
+					return nil, err
+				}
+				to, err = args[1](in)
+			} else {
+				to, err = args[0](in)
+			}
+			if err != nil {
+				return nil, err
+			}
+			var out []any
+			for _, a := range from {
+				for _, b := range to {
+					fa, ok1 := a.(float64)
+					fb, ok2 := b.(float64)
+					if !ok1 || !ok2 {
+						return nil, fmt.Errorf("range needs numbers")
+					}
+					if fb-fa > 100000 {
+						return nil, fmt.Errorf("range too large")
+					}
+					for x := fa; x < fb; x++ {
+						out = append(out, x)
+					}
+				}
+			}
+			return out, nil
+		}, nil
+	case "getpath/1":
+		return withArg(args[0], func(in, path any) (any, error) {
+			segs, ok := path.([]any)
+			if !ok {
+				return nil, fmt.Errorf("getpath needs an array path")
+			}
+			cur := in
+			for _, s := range segs {
+				v, err := indexValue(cur, s)
+				if err != nil {
+					return nil, nil
+				}
+				cur = v
+			}
+			return cur, nil
+		}), nil
+	case "error/1":
+		return withArg(args[0], func(_, msg any) (any, error) {
+			if msg == nil {
+				return nil, fmt.Errorf("null")
+			}
+			return nil, fmt.Errorf("%s", utils.ToText(msg))
+		}), nil
+	}
+	return nil, fmt.Errorf("query: unknown function %s/%d", name, arity)
+}
+
+func regexBuiltin(name string, args []filter) (filter, error) {
+	return func(in any) ([]any, error) {
+		s, ok := in.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a string input, got %s", name, typeName(in))
+		}
+		pats, err := args[0](in)
+		if err != nil {
+			return nil, err
+		}
+		flags := ""
+		flagArg := -1
+		switch name {
+		case "test":
+			flagArg = 1
+		case "sub", "gsub":
+			flagArg = 2
+		}
+		if flagArg > 0 && flagArg < len(args) {
+			fs, err := args[flagArg](in)
+			if err != nil {
+				return nil, err
+			}
+			if len(fs) > 0 {
+				flags, _ = fs[0].(string)
+			}
+		}
+		var out []any
+		for _, p := range pats {
+			ps, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: pattern must be a string", name)
+			}
+			re, err := compileRegex(ps, flags)
+			if err != nil {
+				return nil, err
+			}
+			switch name {
+			case "test":
+				out = append(out, re.MatchString(s))
+			case "match", "capture":
+				m := re.FindStringSubmatchIndex(s)
+				if m == nil {
+					continue
+				}
+				out = append(out, matchObject(re, s, m, name == "capture"))
+			case "scan":
+				for _, m := range re.FindAllStringSubmatch(s, -1) {
+					if len(m) == 1 {
+						out = append(out, m[0])
+						continue
+					}
+					groups := make([]any, len(m)-1)
+					for i, g := range m[1:] {
+						groups[i] = g
+					}
+					out = append(out, groups)
+				}
+			case "sub", "gsub":
+				reps, err := args[1](in)
+				if err != nil {
+					return nil, err
+				}
+				for _, r := range reps {
+					rs, ok := r.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s: replacement must be a string", name)
+					}
+					// Replacements use Go expansion syntax: $1, ${name}
+					if name == "gsub" || strings.Contains(flags, "g") {
+						out = append(out, re.ReplaceAllString(s, rs))
+						continue
+					}
+					loc := re.FindStringSubmatchIndex(s)
+					if loc == nil {
+						out = append(out, s)
+						continue
+					}
+					exp := re.ExpandString(nil, rs, s, loc)
+					out = append(out, s[:loc[0]]+string(exp)+s[loc[1]:])
+				}
+			}
+		}
+		return out, nil
+	}, nil
+}
+
+func compileRegex(p, flags string) (*regexp.Regexp, error) {
+	prefix := ""
+	for _, f := range flags {
+		switch f {
+		case 'i', 's', 'm':
+			prefix += string(f)
+		case 'g', 'n':
+		default:
+			return nil, fmt.Errorf("unsupported regex flag %q", f)
+		}
+	}
+	if prefix != "" {
+		p = "(?" + prefix + ")" + p
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", p, err)
+	}
+	return re, nil
+}
+
+func matchObject(re *regexp.Regexp, s string, m []int, captureOnly bool) any {
+	names := re.SubexpNames()
+	if captureOnly {
+		obj := map[string]any{}
+		for i := 1; i < len(names); i++ {
+			if names[i] == "" {
+				continue
+			}
+			if m[2*i] < 0 {
+				obj[names[i]] = nil
+			} else {
+				obj[names[i]] = s[m[2*i]:m[2*i+1]]
+			}
+		}
+		return obj
+	}
+	caps := []any{}
+	for i := 1; i < len(names); i++ {
+		c := map[string]any{"name": nil, "string": nil, "offset": -1.0}
+		if names[i] != "" {
+			c["name"] = names[i]
+		}
+		if m[2*i] >= 0 {
+			c["string"] = s[m[2*i]:m[2*i+1]]
+			c["offset"] = float64(m[2*i])
+		}
+		caps = append(caps, c)
+	}
+	return map[string]any{
+		"offset":   float64(m[0]),
+		"length":   float64(m[1] - m[0]),
+		"string":   s[m[0]:m[1]],
+		"captures": caps,
+	}
+}
+
+// ---- value helpers ----
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	}
+	return true
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, int, int64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func sortedKeys(m map[string]any) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+func length(in any) (any, error) {
+	switch t := in.(type) {
+	case nil:
+		return 0.0, nil
+	case bool:
+		return nil, fmt.Errorf("boolean has no length")
+	case float64:
+		return math.Abs(t), nil
+	case string:
+		return float64(utf8.RuneCountInString(t)), nil
+	case []any:
+		return float64(len(t)), nil
+	case map[string]any:
+		return float64(len(t)), nil
+	}
+	return nil, fmt.Errorf("%s has no length", typeName(in))
+}
+
+func iterate(v any) ([]any, error) {
+	switch t := v.(type) {
+	case []any:
+		return t, nil
+	case map[string]any:
+		out := make([]any, 0, len(t))
+		for _, k := range sortedKeys(t) {
+			out = append(out, t[k])
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot iterate over %s", typeName(v))
+}
+
+// Pre-order walk over v and all of its descendants.
+func recurse(v any, out []any) []any {
+	out = append(out, v)
+	switch t := v.(type) {
+	case []any:
+		for _, c := range t {
+			out = recurse(c, out)
+		}
+	case map[string]any:
+		for _, k := range sortedKeys(t) {
+			out = recurse(t[k], out)
+		}
+	}
+	return out
+}
+
+func indexValue(v, key any) (any, error) {
+	switch k := key.(type) {
+	case string:
+		switch t := v.(type) {
+		case nil:
+			return nil, nil
+		case map[string]any:
+			return t[k], nil
+		}
+		return nil, fmt.Errorf("cannot index %s with %q", typeName(v), k)
+	case float64:
+		switch t := v.(type) {
+		case nil:
+			return nil, nil
+		case []any:
+			i := int(math.Floor(k))
+			if i < 0 {
+				i += len(t)
+			}
+			if i < 0 || i >= len(t) {
+				return nil, nil
+			}
+			return t[i], nil
+		}
+		return nil, fmt.Errorf("cannot index %s with a number", typeName(v))
+	case nil:
+		if v == nil {
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot index %s with %s", typeName(v), typeName(key))
+}
+
+func sliceValue(v, from, to any) (any, error) {
+	var n int
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		n = len(t)
+	case string:
+		n = utf8.RuneCountInString(t)
+	default:
+		return nil, fmt.Errorf("cannot slice %s", typeName(v))
+	}
+	bound := func(b any, def int) (int, error) {
+		if b == nil {
+			return def, nil
+		}
+		f, ok := b.(float64)
+		if !ok {
+			return 0, fmt.Errorf("slice bounds must be numbers")
+		}
+		i := int(math.Floor(f))
+		if i < 0 {
+			i += n
+		}
+		return min(max(i, 0), n), nil
+	}
+	a, err := bound(from, 0)
+	if err != nil {
+		return nil, err
+	}
+	z, err := bound(to, n)
+	if err != nil {
+		return nil, err
+	}
+	if z < a {
+		z = a
+	}
+	if arr, ok := v.([]any); ok {
+		return append([]any{}, arr[a:z]...), nil
+	}
+	return string([]rune(v.(string))[a:z]), nil
+}
+
+func typeRank(v any) int {
+	switch t := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if t {
+			return 2
+		}
+		return 1
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []any:
+		return 5
+	case map[string]any:
+		return 6
+	}
+	return 7
+}
+
+// Total order over JSON values: null < false < true < numbers < strings < arrays < objects.
+func compareValues(a, b any) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch x := a.(type) {
+	case float64:
+		y := b.(float64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(x, b.(string))
+	case []any:
+		y := b.([]any)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := compareValues(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+		return compareInts(len(x), len(y))
+	case map[string]any:
+		y := b.(map[string]any)
+		kx, ky := sortedKeys(x), sortedKeys(y)
+		for i := 0; i < len(kx) && i < len(ky); i++ {
+			if c := strings.Compare(kx[i], ky[i]); c != 0 {
+				return c
+			}
+		}
+		if c := compareInts(len(kx), len(ky)); c != 0 {
+			return c
+		}
+		for _, k := range kx {
+			if c := compareValues(x[k], y[k]); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func applyOp(op string, a, b any) (any, error) {
+	switch op {
+	case "==":
+		return compareValues(a, b) == 0, nil
+	case "!=":
+		return compareValues(a, b) != 0, nil
+	case "<":
+		return compareValues(a, b) < 0, nil
+	case "<=":
+		return compareValues(a, b) <= 0, nil
+	case ">":
+		return compareValues(a, b) > 0, nil
+	case ">=":
+		return compareValues(a, b) >= 0, nil
+	}
+
+	if op == "+" {
+		if a == nil {
+			return b, nil
+		}
+		if b == nil {
+			return a, nil
+		}
+	}
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch op {
+			case "+":
+				return x + y, nil
+			case "-":
+				return x - y, nil
+			case "*":
+				return x * y, nil
+			case "/":
+				if y == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return x / y, nil
+			case "%":
+				if int(y) == 0 {
+					return nil, fmt.Errorf("modulo by zero")
+				}
+				return float64(int(x) % int(y)), nil
+			}
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			switch op {
+			case "+":
+				return x + y, nil
+			case "/":
+				parts := strings.Split(x, y)
+				out := make([]any, len(parts))
+				for i, p := range parts {
+					out[i] = p
+				}
+				return out, nil
+			}
+		}
+	case []any:
+		if y, ok := b.([]any); ok {
+			switch op {
+			case "+":
+				return append(append([]any{}, x...), y...), nil
+			case "-":
+				out := []any{}
+				for _, v := range x {
+					keep := true
+					for _, w := range y {
+						if compareValues(v, w) == 0 {
+							keep = false
+							break
+						}
+					}
+					if keep {
+						out = append(out, v)
+					}
+				}
+				return out, nil
+			}
+		}
+	case map[string]any:
+		if y, ok := b.(map[string]any); ok {
+			switch op {
+			case "+":
+				out := make(map[string]any, len(x)+len(y))
+				for k, v := range x {
+					out[k] = v
+				}
+				for k, v := range y {
+					out[k] = v
+				}
+				return out, nil
+			case "*":
+				return deepMerge(x, y, arraysReplace), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot apply %s to %s and %s", op, typeName(a), typeName(b))
+}
+
+func contains(a, b any) bool {
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return ok && strings.Contains(x, y)
+	case []any:
+		y, ok := b.([]any)
+		if !ok {
+			return false
+		}
+		for _, want := range y {
+			found := false
+			for _, have := range x {
+				if contains(have, want) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, want := range y {
+			have, ok := x[k]
+			if !ok || !contains(have, want) {
+				return false
+			}
+		}
+		return true
+	}
+	return compareValues(a, b) == 0
+}
+
+func flatten(in any, depth int) (any, error) {
+	arr, ok := in.([]any)
+	if !ok {
+		return nil, fmt.Errorf("cannot flatten %s", typeName(in))
+	}
+	out := []any{}
+	for _, v := range arr {
+		if sub, ok := v.([]any); ok && depth != 0 {
+			f, _ := flatten(sub, depth-1)
+			out = append(out, f.([]any)...)
+			continue
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func toEntries(in any) (any, error) {
+	m, ok := in.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("to_entries needs an object, got %s", typeName(in))
+	}
+	out := make([]any, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		out = append(out, map[string]any{"key": k, "value": m[k]})
+	}
+	return out, nil
+}
+
+func fromEntries(in any) (any, error) {
+	arr, ok := in.([]any)
+	if !ok {
+		return nil, fmt.Errorf("from_entries needs an array, got %s", typeName(in))
+	}
+	out := make(map[string]any, len(arr))
+	for _, e := range arr {
+		m, ok := e.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("from_entries: entries must be objects")
+		}
+		var k any
+		for _, name := range []string{"key", "k", "name", "Key", "Name"} {
+			if v, ok := m[name]; ok && v != nil {
+				k = v
+				break
+			}
+		}
+		v, ok := m["value"]
+		if !ok {
+			v = m["v"]
+		}
+		if k == nil {
+			k = "null"
+		}
+		out[utils.ToText(k)] = v
+	}
+	return out, nil
+}
+
+// Pairs each element with its key under f (or itself when f is nil).
+func keyed(in any, f filter) ([]any, [][]any, error) {
+	arr, ok := in.([]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("needs an array, got %s", typeName(in))
+	}
+	keys := make([][]any, len(arr))
+	for i, v := range arr {
+		if f == nil {
+			keys[i] = []any{v}
+			continue
+		}
+		k, err := f(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys[i] = k
+	}
+	return arr, keys, nil
+}
+
+func sortBy(in any, f filter) (any, error) {
+	arr, keys, err := keyed(in, f)
+	if err != nil {
+		return nil, err
+	}
+	idx := make([]int, len(arr))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return compareValues(keys[idx[i]], keys[idx[j]]) < 0
+	})
+	out := make([]any, len(arr))
+	for i, k := range idx {
+		out[i] = arr[k]
+	}
+	return out, nil
+}
+
+func groupBy(in any, f filter) (any, error) {
+	arr, keys, err := keyed(in, f)
+	if err != nil {
+		return nil, err
+	}
+	idx := make([]int, len(arr))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return compareValues(keys[idx[i]], keys[idx[j]]) < 0
+	})
+	out := []any{}
+	var cur []any
+	for n, i := range idx {
+		if n > 0 && compareValues(keys[i], keys[idx[n-1]]) != 0 {
+			out = append(out, cur)
+			cur = nil
+		}
+		cur = append(cur, arr[i])
+	}
+	if cur != nil {
+		out = append(out, cur)
+	}
+	return out, nil
+}
+
+func uniqueBy(in any, f filter) (any, error) {
+	groups, err := groupBy(in, f)
+	if err != nil {
+		return nil, err
+	}
+	out := []any{}
+	for _, g := range groups.([]any) {
+		out = append(out, g.([]any)[0])
+	}
+	return out, nil
+}
+
+func extreme(in any, f filter, wantMax bool) (any, error) {
+	arr, keys, err := keyed(in, f)
+	if err != nil {
+		return nil, err
+	}
+	if len(arr) == 0 {
+		return nil, nil
+	}
+	best := 0
+	for i := 1; i < len(arr); i++ {
+		c := compareValues(keys[i], keys[best])
+		if (wantMax && c >= 0) || (!wantMax && c < 0) {
+			best = i
+		}
+	}
+	return arr[best], nil
+}
@@ -0,0 +1,259 @@
+package json
+
+import (
+	stdjson "encoding/json"
+	"strings"
+	"testing"
+)
+
+const queryDoc = `{
+  "store": "main",
+  "items": [
+    {"name": "kettle", "price": 25, "tags": ["kitchen", "steel"], "stock": 3},
+    {"name": "mug", "price": 4.5, "tags": ["kitchen"], "stock": 0},
+    {"name": "lamp", "price": 40, "tags": [], "stock": null}
+  ],
+  "meta": {"page": 1, "next": null}
+}`
+
+func TestCompileQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		in    string // defaults to queryDoc
+		want  string // JSON array of all outputs
+	}{
+		// paths and iteration
+		{"identity", ".", `{"a":1}`, `[{"a":1}]`},
+		{"empty query is identity", "", `[1]`, `[[1]]`},
+		{"field", ".store", "", `["main"]`},
+		{"nested field", ".meta.page", "", `[1]`},
+		{"missing field", ".nope", "", `[null]`},
+		{"quoted field", `."store"`, "", `["main"]`},
+		{"bracket field", `.["store"]`, "", `["main"]`},
+		{"index", ".items[0].name", "", `["kettle"]`},
+		{"negative index", ".items[-1].name", "", `["lamp"]`},
+		{"index out of range", ".items[9]", "", `[null]`},
+		{"slice", ".items[1:][].name", "", `["mug","lamp"]`},
+		{"string slice", ".[1:3]", `"abcd"`, `["bc"]`},
+		{"iterate", ".items[].name", "", `["kettle","mug","lamp"]`},
+		{"iterate object in key order", ".meta[]", "", `[null,1]`},
+		{"optional iterate", ".store[]?", "", `[]`},
+		{"recurse", `[.. | numbers]`, `{"a":[1,{"b":2}]}`, `[[1,2]]`},
+		{"comma", ".store, .meta.page", "", `["main",1]`},
+		{"pipe", ".items[0] | .tags[1]", "", `["steel"]`},
+
+		// constructors
+		{"array", "[.items[].price]", "", `[[25,4.5,40]]`},
+		{"object shorthand", ".items[0] | {name, price}", "", `[{"name":"kettle","price":25}]`},
+		{"object computed key", `{(.store): .meta.page}`, "", `[{"main":1}]`},
+		{"object fans out", `{a: (1, 2)}`, `null`, `[{"a":1},{"a":2}]`},
+		{"literals", `[1, "x", true, false, null]`, `null`, `[[1,"x",true,false,null]]`},
+
+		// operators and precedence
+		{"arithmetic precedence", "1 + 2 * 3 - 4 / 2", `null`, `[5]`},
+		{"parentheses", "(1 + 2) * 3", `null`, `[9]`},
+		{"modulo", "7 % 3", `null`, `[1]`},
+		{"string concat", `.store + "!"`, "", `["main!"]`},
+		{"array concat", `[1] + [2]`, `null`, `[[1,2]]`},
+		{"array difference", `[1,2,3,2] - [2]`, `null`, `[[1,3]]`},
+		{"object merge", `{a:1} + {b:2}`, `null`, `[{"a":1,"b":2}]`},
+		{"null addition", `null + 1`, `null`, `[1]`},
+		{"comparison", ".items[] | .price > 10", "", `[true,false,true]`},
+		{"and binds tighter than or", "true or false and false", `null`, `[true]`},
+		{"not", "[true, false] | map(not)", `null`, `[[false,true]]`},
+		{"alternative", ".meta.next // \"none\"", "", `["none"]`},
+		{"alternative keeps false out", "false // 1", `null`, `[1]`},
+		{"if then else", `.items[] | if .price > 30 then "big" elif .price > 10 then "mid" else "small" end`, "", `["mid","small","big"]`},
+		{"if without else", `if . then "yes" end`, `false`, `[false]`},
+		{"optional suppresses", `[.[] | tonumber?]`, `["1","x"]`, `[[1]]`},
+
+		// selection and mapping
+		{"select", `[.items[] | select(.price > 10) | .name]`, "", `[["kettle","lamp"]]`},
+		{"select on null", `[.items[] | select(.stock == null) | .name]`, "", `[["lamp"]]`},
+		{"map", ".items | map(.stock)", "", `[[3,0,null]]`},
+		{"map_values", `map_values(. * 2)`, `{"a":1,"b":2}`, `[{"a":2,"b":4}]`},
+		{"with_entries", `with_entries({key: ("x_" + .key), value})`, `{"a":1}`, `[{"x_a":1}]`},
+		{"to_entries", "to_entries", `{"a":1}`, `[[{"key":"a","value":1}]]`},
+		{"from_entries", "from_entries", `[{"key":"a","value":1},{"name":"b","value":2}]`, `[{"a":1,"b":2}]`},
+		{"recurse with filter", `[recurse(.children[]?) | .id]`, `{"id":1,"children":[{"id":2,"children":[{"id":3}]}]}`, `[[1,2,3]]`},
+
+		// builtins over arrays
+		{"length", "[.items, .store, .meta, null] | map(length)", "", `[[3,4,2,0]]`},
+		{"keys sorted", "keys", `{"b":1,"a":2}`, `[["a","b"]]`},
+		{"keys_unsorted", "keys_unsorted", `{"b":1,"a":2}`, `[["a","b"]]`},
+		{"has", `[has("a"), has("z")]`, `{"a":1}`, `[[true,false]]`},
+		{"contains", `[contains({tags: ["steel"]}), contains("x")]`, `{"tags":["kitchen","steel"]}`, `[[true,false]]`},
+		{"add", ".items | map(.price) | add", "", `[69.5]`},
+		{"add strings", `add`, `["a","b"]`, `["ab"]`},
+		{"add empty", `add`, `[]`, `[null]`},
+		{"min max", "[min, max]", `[3,1,2]`, `[[1,3]]`},
+		{"min_by max_by", "[min_by(.price).name, max_by(.price).name]", `[{"name":"a","price":2},{"name":"b","price":1}]`, `[["b","a"]]`},
+		{"sort mixed types", "sort", `[3,"a",null,true,[1],{"a":1},1]`, `[[null,true,1,3,"a",[1],{"a":1}]]`},
+		{"sort_by", ".items | sort_by(.price) | map(.name)", "", `[["mug","kettle","lamp"]]`},
+		{"sort_by multiple keys", "sort_by(.a, .b) | map(.b)", `[{"a":2,"b":1},{"a":1,"b":3},{"a":1,"b":2}]`, `[[2,3,1]]`},
+		{"group_by", "group_by(.k) | map(length)", `[{"k":"x"},{"k":"y"},{"k":"x"}]`, `[[2,1]]`},
+		{"unique", "unique", `[2,1,2]`, `[[1,2]]`},
+		{"unique_by", "unique_by(length)", `["a","bb","c"]`, `[["a","bb"]]`},
+		{"reverse", "reverse", `[1,2,3]`, `[[3,2,1]]`},
+		{"flatten", "flatten", `[1,[2,[3]]]`, `[[1,2,3]]`},
+		{"flatten depth", "flatten(1)", `[1,[2,[3]]]`, `[[1,2,[3]]]`},
+		{"first last", "[first, last]", `[1,2,3]`, `[[1,3]]`},
+		{"first of generator", "first(range(5; 10))", `null`, `[5]`},
+		{"limit", "[limit(2; .[])]", `[1,2,3]`, `[[1,2]]`},
+		{"range", "[range(3)]", `null`, `[[0,1,2]]`},
+		{"range from to", "[range(2; 5)]", `null`, `[[2,3,4]]`},
+		{"any all", "[any, all]", `[true,false]`, `[[true,false]]`},
+		{"any with condition", "any(. > 2)", `[1,3]`, `[true]`},
+		{"index rindex", `[index("b"), rindex("b")]`, `"abcb"`, `[[1,3]]`},
+		{"type filters", `[.[] | numbers]`, `[1,"a",null,2]`, `[[1,2]]`},
+		{"type", `map(type)`, `[1,"a",null,true,[],{}]`, `[["number","string","null","boolean","array","object"]]`},
+		{"getpath", `getpath(["a","b"])`, `{"a":{"b":7}}`, `[7]`},
+		{"empty", `[1, empty, 2]`, `null`, `[[1,2]]`},
+
+		// strings
+		{"case", `[ascii_upcase, ascii_downcase]`, `"MiX"`, `[["MIX","mix"]]`},
+		{"trim", `[trim, ltrim, rtrim]`, `"  x  "`, `[["x","x  ","  x"]]`},
+		{"split join", `split(",") | join("-")`, `"a,b,c"`, `["a-b-c"]`},
+		{"startswith endswith", `[startswith("ab"), endswith("x")]`, `"abc"`, `[[true,false]]`},
+		{"ltrimstr rtrimstr", `ltrimstr("http://") | rtrimstr("/")`, `"http://a.b/"`, `["a.b"]`},
+		{"tostring tonumber", `[(1 | tostring), ("2.5" | tonumber)]`, `null`, `[["1",2.5]]`},
+		{"tojson fromjson", `tojson | fromjson`, `{"a":[1]}`, `[{"a":[1]}]`},
+		{"test regex", `[.[] | test("^a")]`, `["ab","ba"]`, `[[true,false]]`},
+		{"test flags", `test("AB"; "i")`, `"xab"`, `[true]`},
+		{"capture", `capture("(?<user>[a-z]+)@(?<host>.+)")`, `"bob@x.org"`, `[{"host":"x.org","user":"bob"}]`},
+		{"scan", `[scan("[0-9]+")]`, `"a1b22c333"`, `[["1","22","333"]]`},
+		{"sub", `sub("o"; "0")`, `"foo"`, `["f0o"]`},
+		{"gsub", `gsub("o"; "0")`, `"foo"`, `["f00"]`},
+		{"match offset", `match("b+") | [.offset, .length, .string]`, `"abbc"`, `[[1,2,"bb"]]`},
+
+		// numbers
+		{"rounding", `[floor, ceil, round]`, `2.5`, `[[2,3,3]]`},
+		{"abs sqrt", `[(-4 | abs), (16 | sqrt)]`, `null`, `[[4,4]]`},
+
+		// JSONPath
+		{"jsonpath field", "$.store", "", `["main"]`},
+		{"jsonpath wildcard", "$.items[*].name", "", `["kettle","mug","lamp"]`},
+		{"jsonpath filter", "$.items[?(@.price > 10)].name", "", `["kettle","lamp"]`},
+		{"jsonpath recursive", "$..page", "", `[1]`},
+		{"jsonpath index", "$.items[1].name", "", `["mug"]`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			in := tc.in
+			if in == "" {
+				in = queryDoc
+			}
+			var doc any
+			if err := stdjson.Unmarshal([]byte(in), &doc); err != nil {
+				t.Fatalf("bad input: %v", err)
+			}
+			f, err := compileQuery(tc.query)
+			if err != nil {
+				t.Fatalf("compile %q: %v", tc.query, err)
+			}
+			out, err := f(doc)
+			if err != nil {
+				t.Fatalf("run %q: %v", tc.query, err)
+			}
+			if out == nil {
+				out = []any{}
+			}
+			assertJSON(t, out, tc.want)
+		})
+	}
+}
+
+func TestCompileQueryErrors(t *testing.T) {
+	compileErrors := []struct {
+		query, wantErr string
+	}{
+		{".a |", "unexpected"},
+		{"(.a", ")"},
+		{"[1, 2", "]"},
+		{`"unterminated`, "string"},
+		{"nosuchfn", "nosuchfn"},
+		{"map", "map"},
+		{"$x", "unexpected"},
+		{"if . then 1", "end"},
+	}
+	for _, tc := range compileErrors {
+		t.Run("compile "+tc.query, func(t *testing.T) {
+			_, err := compileQuery(tc.query)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("compileQuery(%q) error = %v, want one containing %q", tc.query, err, tc.wantErr)
+			}
+		})
+	}
+
+	runErrors := []struct {
+		query, in string
+	}{
+		{".a", `[1]`},          // field of an array
+		{".[0]", `{"a":1}`},    // index of an object
+		{".[]", `5`},           // iterate a number
+		{`. + 1`, `"x"`},       // string + number
+		{`{} - 1`, `null`},     // object - number
+		{"keys", `1`},          // keys of a number
+		{"tonumber", `"abc"`},  // not a number
+		{`error("boom")`, `1`}, // explicit error
+		{`test("(")`, `"x"`},   // bad regex
+		{"fromjson", `"{bad"`}, // bad JSON
+		{"1 / 0", `null`},      // division by zero
+		{"sort", `{"a":1}`},    // sort of an object
+		{"length", `true`},     // length of a boolean
+	}
+	for _, tc := range runErrors {
+		t.Run("run "+tc.query, func(t *testing.T) {
+			f, err := compileQuery(tc.query)
+			if err != nil {
+				return // rejected even earlier
+			}
+			var doc any
+			_ = stdjson.Unmarshal([]byte(tc.in), &doc)
+			if out, err := f(doc); err == nil {
+				t.Fatalf("%q on %s = %v, want an error", tc.query, tc.in, out)
+			}
+		})
+	}
+}
+
+func TestHandleQuery(t *testing.T) {
+	out, err := handleQuery(nil, map[string]any{"json": queryDoc, "query": ".items[] | select(.stock > 0) | .name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["result"] != "kettle" || out["count"] != 1 || out["results_json"] != `["kettle"]` {
+		t.Fatalf("single result: %v", out)
+	}
+
+	// JSONPath always yields a node list, even for one match
+	out, err = handleQuery(nil, map[string]any{"json": queryDoc, "query": "$.store"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["result_json"] != `["main"]` {
+		t.Fatalf("jsonpath result_json = %v", out["result_json"])
+	}
+
+	out, err = handleQuery(nil, map[string]any{"json": queryDoc, "query": ".items[] | select(.price > 1000)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out["results_json"] != `[]` || out["count"] != 0 {
+		t.Fatalf("no results: %v", out)
+	}
+}
+
+func assertJSON(t *testing.T, got any, want string) {
+	t.Helper()
+	var w any
+	if err := stdjson.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("bad expectation %s: %v", want, err)
+	}
+	gb, _ := stdjson.Marshal(got)
+	wb, _ := stdjson.Marshal(w)
+	if string(gb) != string(wb) {
+		t.Errorf("got %s, want %s", gb, wb)
+	}
+}
@@ -0,0 +1,456 @@
+package json
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"a-a/internal/utils"
+)
+
+const maxSchemaErrors = 100
+
+type schemaError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Validates documents against a JSON Schema (draft-07 / 2019-09 / 2020-12
+// keywords; local "#/..." $refs only).
+type validator struct {
+	root    any
+	errs    []schemaError
+	depth   int
+	regexes map[string]*regexp.Regexp
+}
+
+func validateSchema(schema, doc any) []schemaError {
+	v := &validator{root: schema, regexes: map[string]*regexp.Regexp{}}
+	v.errs = v.check(schema, doc, "$")
+	if len(v.errs) > maxSchemaErrors {
+		v.errs = v.errs[:maxSchemaErrors]
+	}
+	return v.errs
+}
+
+func (v *validator) check(schema, doc any, path string) []schemaError {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			return []schemaError{{path, "no value is allowed here"}}
+		}
+		return nil
+	case map[string]any:
+		return v.checkObject(s, doc, path)
+	}
+	return nil
+}
+
+func (v *validator) checkObject(s map[string]any, doc any, path string) []schemaError {
+	v.depth++
+	defer func() { v.depth-- }()
+	if v.depth > 200 {
+		return []schemaError{{path, "schema nesting too deep (recursive $ref?)"}}
+	}
+
+	var errs []schemaError
+	fail := func(format string, args ...any) {
+		errs = append(errs, schemaError{path, fmt.Sprintf(format, args...)})
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := v.resolveRef(ref)
+		if err != nil {
+			fail("%v", err)
+		} else {
+			errs = append(errs, v.check(target, doc, path)...)
+		}
+	}
+
+	if t, ok := s["type"]; ok && !matchesType(t, doc) {
+		fail("expected %s, got %s", describeType(t), typeName(doc))
+		return errs // the remaining keywords would only add noise
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if compareValues(e, doc) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value must be one of %s", utils.ToText(enum))
+		}
+	}
+	if c, ok := s["const"]; ok && compareValues(c, doc) != 0 {
+		want := utils.ToText(c)
+		if c == nil {
+			want = "null"
+		}
+		fail("value must be %s", want)
+	}
+
+	switch d := doc.(type) {
+	case string:
+		n := float64(utf8.RuneCountInString(d))
+		if m, ok := number(s["minLength"]); ok && n < m {
+			fail("string shorter than %v", m)
+		}
+		if m, ok := number(s["maxLength"]); ok && n > m {
+			fail("string longer than %v", m)
+		}
+		if p, ok := s["pattern"].(string); ok {
+			if re, err := v.regex(p); err != nil {
+				fail("%v", err)
+			} else if !re.MatchString(d) {
+				fail("string does not match pattern %q", p)
+			}
+		}
+		if f, ok := s["format"].(string); ok && !checkFormat(f, d) {
+			fail("string is not a valid %s", f)
+		}
+	case float64:
+		if m, ok := number(s["minimum"]); ok && d < m {
+			fail("must be >= %v", m)
+		}
+		if m, ok := number(s["maximum"]); ok && d > m {
+			fail("must be <= %v", m)
+		}
+		if m, ok := number(s["exclusiveMinimum"]); ok && d <= m {
+			fail("must be > %v", m)
+		}
+		if m, ok := number(s["exclusiveMaximum"]); ok && d >= m {
+			fail("must be < %v", m)
+		}
+		if m, ok := number(s["multipleOf"]); ok && m > 0 {
+			if q := d / m; math.Abs(q-math.Round(q)) > 1e-9 {
+				fail("must be a multiple of %v", m)
+			}
+		}
+	case []any:
+		errs = append(errs, v.checkArray(s, d, path)...)
+	case map[string]any:
+		errs = append(errs, v.checkProps(s, d, path)...)
+	}
+
+	if all, ok := s["allOf"].([]any); ok {
+		for _, sub := range all {
+			errs = append(errs, v.check(sub, doc, path)...)
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if len(v.check(sub, doc, path)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("value does not match any schema in anyOf")
+		}
+	}
+	if oneOf, ok := s["oneOf"].([]any); ok {
+		n := 0
+		for _, sub := range oneOf {
+			if len(v.check(sub, doc, path)) == 0 {
+				n++
+			}
+		}
+		if n != 1 {
+			fail("value must match exactly one schema in oneOf (matched %d)", n)
+		}
+	}
+	if not, ok := s["not"]; ok && len(v.check(not, doc, path)) == 0 {
+		fail("value must not match the schema in not")
+	}
+	if cond, ok := s["if"]; ok {
+		if len(v.check(cond, doc, path)) == 0 {
+			if then, ok := s["then"]; ok {
+				errs = append(errs, v.check(then, doc, path)...)
+			}
+		} else if els, ok := s["else"]; ok {
+			errs = append(errs, v.check(els, doc, path)...)
+		}
+	}
+	return errs
+}
+
+func (v *validator) checkArray(s map[string]any, d []any, path string) []schemaError {
+	var errs []schemaError
+	fail := func(format string, args ...any) {
+		errs = append(errs, schemaError{path, fmt.Sprintf(format, args...)})
+	}
+	n := float64(len(d))
+	if m, ok := number(s["minItems"]); ok && n < m {
+		fail("array has fewer than %v items", m)
+	}
+	if m, ok := number(s["maxItems"]); ok && n > m {
+		fail("array has more than %v items", m)
+	}
+	if u, _ := s["uniqueItems"].(bool); u {
+	outer:
+		for i := range d {
+			for j := i + 1; j < len(d); j++ {
+				if compareValues(d[i], d[j]) == 0 {
+					fail("items %d and %d are equal", i, j)
+					break outer
+				}
+			}
+		}
+	}
+
+	// Tuple validation: prefixItems (2020-12) or items as an array (draft-07)
+	prefix, _ := s["prefixItems"].([]any)
+	rest, hasRest := s["items"]
+	if arr, ok := rest.([]any); ok {
+		prefix, rest = arr, s["additionalItems"]
+		_, hasRest = s["additionalItems"]
+	}
+	for i, item := range d {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		if i < len(prefix) {
+			errs = append(errs, v.check(prefix[i], item, p)...)
+		} else if hasRest {
+			errs = append(errs, v.check(rest, item, p)...)
+		}
+	}
+
+	if c, ok := s["contains"]; ok {
+		matches := 0
+		for _, item := range d {
+			if len(v.check(c, item, path)) == 0 {
+				matches++
+			}
+		}
+		minC := 1.0
+		if m, ok := number(s["minContains"]); ok {
+			minC = m
+		}
+		if float64(matches) < minC {
+			fail("array must contain at least %v matching item(s)", minC)
+		}
+		if m, ok := number(s["maxContains"]); ok && float64(matches) > m {
+			fail("array must contain at most %v matching item(s)", m)
+		}
+	}
+	return errs
+}
+
+func (v *validator) checkProps(s map[string]any, d map[string]any, path string) []schemaError {
+	var errs []schemaError
+	fail := func(format string, args ...any) {
+		errs = append(errs, schemaError{path, fmt.Sprintf(format, args...)})
+	}
+	n := float64(len(d))
+	if m, ok := number(s["minProperties"]); ok && n < m {
+		fail("object has fewer than %v properties", m)
+	}
+	if m, ok := number(s["maxProperties"]); ok && n > m {
+		fail("object has more than %v properties", m)
+	}
+	if req, ok := s["required"].([]any); ok {
+		for _, r := range req {
+			if k, ok := r.(string); ok {
+				if _, ok := d[k]; !ok {
+					fail("missing required property %q", k)
+				}
+			}
+		}
+	}
+	if deps, ok := s["dependentRequired"].(map[string]any); ok {
+		for k, list := range deps {
+			if _, ok := d[k]; !ok {
+				continue
+			}
+			items, _ := list.([]any)
+			for _, r := range items {
+				if rk, ok := r.(string); ok {
+					if _, ok := d[rk]; !ok {
+						fail("property %q requires %q", k, rk)
+					}
+				}
+			}
+		}
+	}
+
+	props, _ := s["properties"].(map[string]any)
+	patterns, _ := s["patternProperties"].(map[string]any)
+	additional, hasAdditional := s["additionalProperties"]
+	names, hasNames := s["propertyNames"]
+
+	for _, k := range sortedKeys(d) {
+		p := path + "." + k
+		if !isPlainKey(k) {
+			p = path + "[" + strconv.Quote(k) + "]"
+		}
+		if hasNames {
+			for _, e := range v.check(names, k, p) {
+				errs = append(errs, schemaError{p, "property name: " + e.Message})
+			}
+		}
+		matched := false
+		if sub, ok := props[k]; ok {
+			matched = true
+			errs = append(errs, v.check(sub, d[k], p)...)
+		}
+		for pat, sub := range patterns {
+			re, err := v.regex(pat)
+			if err != nil {
+				fail("%v", err)
+				continue
+			}
+			if re.MatchString(k) {
+				matched = true
+				errs = append(errs, v.check(sub, d[k], p)...)
+			}
+		}
+		if !matched && hasAdditional {
+			if b, ok := additional.(bool); ok && !b {
+				errs = append(errs, schemaError{p, "additional property is not allowed"})
+				continue
+			}
+			errs = append(errs, v.check(additional, d[k], p)...)
+		}
+	}
+	return errs
+}
+
+func (v *validator) resolveRef(ref string) (any, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("only local $ref values are supported, got %q", ref)
+	}
+	cur := v.root
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+		if u, err := url.PathUnescape(part); err == nil {
+			part = u
+		}
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("$ref %q does not resolve", ref)
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, fmt.Errorf("$ref %q does not resolve", ref)
+		}
+	}
+	return cur, nil
+}
+
+func (v *validator) regex(p string) (*regexp.Regexp, error) {
+	if re, ok := v.regexes[p]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q in schema: %w", p, err)
+	}
+	v.regexes[p] = re
+	return re, nil
+}
+
+func matchesType(t, doc any) bool {
+	switch tt := t.(type) {
+	case string:
+		return typeMatches(tt, doc)
+	case []any:
+		for _, x := range tt {
+			if s, ok := x.(string); ok && typeMatches(s, doc) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func typeMatches(t string, doc any) bool {
+	switch t {
+	case "integer":
+		f, ok := doc.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := doc.(float64)
+		return ok
+	}
+	return typeName(doc) == t
+}
+
+func describeType(t any) string {
+	if arr, ok := t.([]any); ok {
+		parts := make([]string, len(arr))
+		for i, x := range arr {
+			parts[i] = utils.ToText(x)
+		}
+		return strings.Join(parts, " or ")
+	}
+	return utils.ToText(t)
+}
+
+func number(v any) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+var (
+	dateRe  = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	ipv4Re  = regexp.MustCompile(`^(\d{1,3})\.(\d{1,3})\.(\d{1,3})\.(\d{1,3})$`)
+	uuidRe  = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	hostRe  = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+	plainRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Unknown formats are accepted, as the spec allows.
+func checkFormat(format, s string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	case "date":
+		if !dateRe.MatchString(s) {
+			return false
+		}
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	case "email":
+		a, err := mail.ParseAddress(s)
+		return err == nil && a.Address == s
+	case "uri", "url", "iri":
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != ""
+	case "uri-reference":
+		_, err := url.Parse(s)
+		return err == nil
+	case "ipv4":
+		m := ipv4Re.FindStringSubmatch(s)
+		if m == nil {
+			return false
+		}
+		for _, part := range m[1:] {
+			if n, _ := strconv.Atoi(part); n > 255 {
+				return false
+			}
+		}
+		return true
+	case "uuid":
+		return uuidRe.MatchString(s)
+	case "hostname":
+		return len(s) <= 253 && hostRe.MatchString(s)
+	case "regex":
+		_, err := regexp.Compile(s)
+		return err == nil
+	}
+	return true
+}
+
+func isPlainKey(k string) bool { return plainRe.MatchString(k) }
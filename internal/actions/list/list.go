@@ -31,24 +31,43 @@ func handlePluck(_ context.Context, payload map[string]any) (map[string]any, err
 	return map[string]any{"values_json": string(b)}, nil
 }
 
+// Deduplicates an array, keeping the first occurrence and element types.
+// Required payload:
+//
+//	list_json: array
+//
+// Optional payload:
+//
+//	field: for arrays of objects, deduplicate by this dotted path instead of the whole element
+//
+// Output:
+//
+//	{ "list_json": "<[...]>" }
 func handleUnique(_ context.Context, payload map[string]any) (map[string]any, error) {
-	listJSON, err := utils.GetStringPayload(payload, "list_json")
+	arr, err := arrayPayload(payload, "list_json")
 	if err != nil {
 		return nil, err
 	}
-	var arr []any
-	if err := json.Unmarshal([]byte(listJSON), &arr); err != nil {
-		return nil, fmt.Errorf("list_json must be array: %w", err)
-	}
+	field, _ := payload["field"].(string)
 	seen := map[string]struct{}{}
-	out := make([]string, 0, len(arr))
+	out := make([]any, 0, len(arr))
 	for _, v := range arr {
-		s := fmt.Sprintf("%v", v)
+		key := v
+		if field != "" {
+			k, ok := lookup(v, field)
+			if !ok {
+				// Elements without the key are kept as-is
+				out = append(out, v)
+				continue
+			}
+			key = k
+		}
+		s := canonical(key)
 		if _, ok := seen[s]; ok {
 			continue
 		}
 		seen[s] = struct{}{}
-		out = append(out, s)
+		out = append(out, v)
 	}
 	b, _ := json.Marshal(out)
 	return map[string]any{"list_json": string(b)}, nil
@@ -83,6 +102,20 @@ func HandleListAction(ctx context.Context, operation string, payload map[string]
 		return handleUnique(ctx, payload)
 	case "concat":
 		return handleConcat(ctx, payload)
+	case "filter":
+		return handleFilter(ctx, payload)
+	case "sort":
+		return handleSort(ctx, payload)
+	case "slice":
+		return handleSlice(ctx, payload)
+	case "chunk":
+		return handleChunk(ctx, payload)
+	case "flatten":
+		return handleFlatten(ctx, payload)
+	case "zip":
+		return handleZip(ctx, payload)
+	case "group_by":
+		return handleGroupBy(ctx, payload)
 	default:
 		return nil, fmt.Errorf("unknown list operation: %s", operation)
 	}
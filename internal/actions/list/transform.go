@@ -0,0 +1,643 @@
+package list
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"a-a/internal/utils"
+)
+
+type condition struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value any    `json:"value"`
+}
+
+// Keeps the elements matching field predicates.
+// Required payload:
+//
+//	list_json: array
+//	op:        eq | ne | gt | gte | lt | lte | contains | not_contains |
+//	           starts_with | ends_with | regex | in | exists | not_exists | empty | not_empty
+//
+// Optional payload:
+//
+//	field:           dotted path inside each element ("price", "author.name"); empty = the element itself
+//	value:           right-hand side (an array for "in")
+//	conditions_json: [{field, op, value}] instead of field/op/value
+//	match:           "all" (default) or "any" for several conditions
+//	case_sensitive:  default false for string comparisons
+//
+// Output:
+//
+//	{ "list_json": "<[...]>", "count": int }
+func handleFilter(_ context.Context, payload map[string]any) (map[string]any, error) {
+	arr, err := arrayPayload(payload, "list_json")
+	if err != nil {
+		return nil, err
+	}
+
+	var conds []condition
+	if raw, ok := payload["conditions_json"]; ok {
+		b, _ := json.Marshal(raw)
+		if s, ok := raw.(string); ok {
+			b = []byte(s)
+		}
+		if err := json.Unmarshal(b, &conds); err != nil {
+			return nil, fmt.Errorf("conditions_json must be an array of {field, op, value}: %w", err)
+		}
+	} else {
+		op, err := utils.GetStringPayload(payload, "op")
+		if err != nil {
+			return nil, err
+		}
+		field, _ := payload["field"].(string)
+		conds = []condition{{Field: field, Op: op, Value: payload["value"]}}
+	}
+	if len(conds) == 0 {
+		return nil, fmt.Errorf("list.filter needs at least one condition")
+	}
+	matchAny := strings.EqualFold(fmt.Sprint(payload["match"]), "any")
+	caseSensitive, _ := payload["case_sensitive"].(bool)
+
+	preds := make([]func(any) bool, len(conds))
+	for i, c := range conds {
+		p, err := predicate(c, caseSensitive)
+		if err != nil {
+			return nil, err
+		}
+		preds[i] = p
+	}
+
+	out := make([]any, 0, len(arr))
+	for _, el := range arr {
+		keep := !matchAny
+		for _, p := range preds {
+			if p(el) == matchAny {
+				keep = matchAny
+				break
+			}
+		}
+		if keep {
+			out = append(out, el)
+		}
+	}
+	b, _ := json.Marshal(out)
+	return map[string]any{"list_json": string(b), "count": len(out)}, nil
+}
+
+func predicate(c condition, caseSensitive bool) (func(any) bool, error) {
+	op := strings.ToLower(strings.TrimSpace(c.Op))
+	fold := func(s string) string {
+		if caseSensitive {
+			return s
+		}
+		return strings.ToLower(s)
+	}
+	want := fold(utils.ToText(c.Value))
+	get := func(el any) (any, bool) { return lookup(el, c.Field) }
+
+	switch op {
+	case "exists", "not_exists":
+		return func(el any) bool {
+			v, ok := get(el)
+			return (ok && v != nil) == (op == "exists")
+		}, nil
+	case "empty", "not_empty":
+		return func(el any) bool {
+			v, ok := get(el)
+			empty := !ok || v == nil || utils.ToText(v) == "" || utils.ToText(v) == "[]" || utils.ToText(v) == "{}"
+			return empty == (op == "empty")
+		}, nil
+	case "eq", "==", "ne", "!=":
+		neg := op == "ne" || op == "!="
+		return func(el any) bool {
+			v, ok := get(el)
+			eq := ok && compareValues(v, c.Value, caseSensitive) == 0
+			return eq != neg
+		}, nil
+	case "gt", ">", "gte", ">=", "lt", "<", "lte", "<=":
+		return func(el any) bool {
+			v, ok := get(el)
+			if !ok || v == nil {
+				return false
+			}
+			r := compareValues(v, c.Value, caseSensitive)
+			switch op {
+			case "gt", ">":
+				return r > 0
+			case "gte", ">=":
+				return r >= 0
+			case "lt", "<":
+				return r < 0
+			}
+			return r <= 0
+		}, nil
+	case "contains", "not_contains":
+		return func(el any) bool {
+			v, ok := get(el)
+			has := false
+			if arr, isArr := v.([]any); isArr {
+				for _, x := range arr {
+					if compareValues(x, c.Value, caseSensitive) == 0 {
+						has = true
+						break
+					}
+				}
+			} else if ok && v != nil {
+				has = strings.Contains(fold(utils.ToText(v)), want)
+			}
+			return has == (op == "contains")
+		}, nil
+	case "starts_with", "ends_with":
+		return func(el any) bool {
+			v, ok := get(el)
+			if !ok || v == nil {
+				return false
+			}
+			s := fold(utils.ToText(v))
+			if op == "starts_with" {
+				return strings.HasPrefix(s, want)
+			}
+			return strings.HasSuffix(s, want)
+		}, nil
+	case "regex", "matches", "not_regex":
+		pat := utils.ToText(c.Value)
+		if !caseSensitive {
+			pat = "(?i)" + pat
+		}
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %w", utils.ToText(c.Value), err)
+		}
+		return func(el any) bool {
+			v, ok := get(el)
+			m := ok && v != nil && re.MatchString(utils.ToText(v))
+			return m == (op != "not_regex")
+		}, nil
+	case "in", "not_in":
+		set, ok := c.Value.([]any)
+		if !ok {
+			if s, isStr := c.Value.(string); isStr {
+				if err := json.Unmarshal([]byte(s), &set); err != nil {
+					return nil, fmt.Errorf("op %q needs an array value", op)
+				}
+			} else {
+				return nil, fmt.Errorf("op %q needs an array value", op)
+			}
+		}
+		return func(el any) bool {
+			v, ok := get(el)
+			found := false
+			if ok {
+				for _, x := range set {
+					if compareValues(v, x, caseSensitive) == 0 {
+						found = true
+						break
+					}
+				}
+			}
+			return found == (op == "in")
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown filter op %q", c.Op)
+}
+
+// Sorts by a field (or the elements themselves).
+// Required payload:
+//
+//	list_json: array
+//
+// Optional payload:
+//
+//	field: dotted path inside each element
+//	order: "asc" (default) or "desc"
+//	mode:  "auto" (default: numbers numerically, otherwise text), "numeric" or "lexical"
+//
+// Elements missing the field go last. The sort is stable.
+//
+// Output:
+//
+//	{ "list_json": "<[...]>" }
+func handleSort(_ context.Context, payload map[string]any) (map[string]any, error) {
+	arr, err := arrayPayload(payload, "list_json")
+	if err != nil {
+		return nil, err
+	}
+	field, _ := payload["field"].(string)
+	desc := strings.EqualFold(fmt.Sprint(payload["order"]), "desc")
+	mode, _ := payload["mode"].(string)
+	mode = strings.ToLower(mode)
+	switch mode {
+	case "", "auto", "numeric", "lexical":
+	default:
+		return nil, fmt.Errorf("mode must be auto, numeric or lexical, got %q", mode)
+	}
+
+	type keyed struct {
+		el      any
+		key     any
+		missing bool
+	}
+	items := make([]keyed, len(arr))
+	for i, el := range arr {
+		v, ok := lookup(el, field)
+		items[i] = keyed{el: el, key: v, missing: !ok || v == nil}
+	}
+	cmp := func(a, b any) int {
+		switch mode {
+		case "numeric":
+			fa, okA := number(a)
+			fb, okB := number(b)
+			switch {
+			case okA && okB:
+				return compareFloats(fa, fb)
+			case okA:
+				return -1
+			case okB:
+				return 1
+			}
+			return 0
+		case "lexical":
+			return strings.Compare(strings.ToLower(utils.ToText(a)), strings.ToLower(utils.ToText(b)))
+		}
+		return compareValues(a, b, false)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.missing != b.missing {
+			return b.missing
+		}
+		if desc {
+			return cmp(a.key, b.key) > 0
+		}
+		return cmp(a.key, b.key) < 0
+	})
+
+	out := make([]any, len(items))
+	for i, it := range items {
+		out[i] = it.el
+	}
+	b, _ := json.Marshal(out)
+	return map[string]any{"list_json": string(b)}, nil
+}
+
+// Python-style slice.
+// Required payload:
+//
+//	list_json: array
+//
+// Optional payload:
+//
+//	start: first index (default 0; negative counts from the end)
+//	end:   index after the last element (default length; negative counts from the end)
+//
+// Output:
+//
+//	{ "list_json": "<[...]>", "count": int }
+func handleSlice(_ context.Context, payload map[string]any) (map[string]any, error) {
+	arr, err := arrayPayload(payload, "list_json")
+	if err != nil {
+		return nil, err
+	}
+	n := len(arr)
+	bound := func(key string, def int) int {
+		v, ok := payload[key]
+		if !ok || v == nil {
+			return def
+		}
+		i, err := utils.GetIntPayload(map[string]any{"v": v}, "v")
+		if err != nil {
+			return def
+		}
+		if i < 0 {
+			i += n
+		}
+		return min(max(i, 0), n)
+	}
+	start, end := bound("start", 0), bound("end", n)
+	if end < start {
+		end = start
+	}
+	out := append([]any{}, arr[start:end]...)
+	b, _ := json.Marshal(out)
+	return map[string]any{"list_json": string(b), "count": len(out)}, nil
+}
+
+// Splits an array into consecutive chunks (handy for batching into flow.foreach).
+// Required payload:
+//
+//	list_json: array
+//	size:      elements per chunk
+//
+// Output:
+//
+//	{ "chunks_json": "<[[...], ...]>", "count": int }
+func handleChunk(_ context.Context, payload map[string]any) (map[string]any, error) {
+	arr, err := arrayPayload(payload, "list_json")
+	if err != nil {
+		return nil, err
+	}
+	size, err := utils.GetIntPayload(payload, "size")
+	if err != nil {
+		return nil, err
+	}
+	if size < 1 {
+		return nil, fmt.Errorf("size must be >= 1")
+	}
+	chunks := make([][]any, 0, (len(arr)+size-1)/size)
+	for i := 0; i < len(arr); i += size {
+		chunks = append(chunks, arr[i:min(i+size, len(arr))])
+	}
+	b, _ := json.Marshal(chunks)
+	return map[string]any{"chunks_json": string(b), "count": len(chunks)}, nil
+}
+
+// Flattens nested arrays.
+// Required payload:
+//
+//	list_json: array
+//
+// Optional payload:
+//
+//	depth: levels to flatten (default 1; 0 or less = fully)
+//
+// Output:
+//
+//	{ "list_json": "<[...]>" }
+func handleFlatten(_ context.Context, payload map[string]any) (map[string]any, error) {
+	arr, err := arrayPayload(payload, "list_json")
+	if err != nil {
+		return nil, err
+	}
+	depth := 1
+	if v, ok := payload["depth"]; ok {
+		if d, err := utils.GetIntPayload(map[string]any{"v": v}, "v"); err == nil {
+			depth = d
+		}
+	}
+	if depth <= 0 {
+		depth = -1
+	}
+	out := flatten(arr, depth)
+	b, _ := json.Marshal(out)
+	return map[string]any{"list_json": string(b)}, nil
+}
+
+func flatten(arr []any, depth int) []any {
+	out := make([]any, 0, len(arr))
+	for _, v := range arr {
+		if sub, ok := v.([]any); ok && depth != 0 {
+			out = append(out, flatten(sub, depth-1)...)
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// Combines arrays element-wise.
+// Required payload (either):
+//
+//	lists_json:     array of arrays
+//	a_json, b_json: two arrays
+//
+// Optional payload:
+//
+//	keys_json: names for each input, producing objects instead of tuples
+//	longest:   pad shorter inputs with null instead of stopping at the shortest (default false)
+//
+// Output:
+//
+//	{ "list_json": "<[[a0,b0], ...] or [{k1: a0, k2: b0}, ...]>" }
+func handleZip(_ context.Context, payload map[string]any) (map[string]any, error) {
+	var lists [][]any
+	if _, ok := payload["lists_json"]; ok {
+		outer, err := arrayPayload(payload, "lists_json")
+		if err != nil {
+			return nil, err
+		}
+		for i, l := range outer {
+			// Tolerate inner arrays passed as JSON strings
+			if s, ok := l.(string); ok {
+				var v any
+				if json.Unmarshal([]byte(s), &v) == nil {
+					l = v
+				}
+			}
+			arr, ok := l.([]any)
+			if !ok {
+				return nil, fmt.Errorf("lists_json[%d] is not an array", i)
+			}
+			lists = append(lists, arr)
+		}
+	} else {
+		a, err := arrayPayload(payload, "a_json")
+		if err != nil {
+			return nil, err
+		}
+		b, err := arrayPayload(payload, "b_json")
+		if err != nil {
+			return nil, err
+		}
+		lists = [][]any{a, b}
+	}
+	var keys []string
+	if _, ok := payload["keys_json"]; ok {
+		ks, err := arrayPayload(payload, "keys_json")
+		if err != nil {
+			return nil, err
+		}
+		if len(ks) != len(lists) {
+			return nil, fmt.Errorf("keys_json has %d names for %d lists", len(ks), len(lists))
+		}
+		for _, k := range ks {
+			keys = append(keys, utils.ToText(k))
+		}
+	}
+	longest, _ := payload["longest"].(bool)
+
+	n := 0
+	for i, l := range lists {
+		if i == 0 || (longest && len(l) > n) || (!longest && len(l) < n) {
+			n = len(l)
+		}
+	}
+	out := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		row := make([]any, len(lists))
+		for j, l := range lists {
+			if i < len(l) {
+				row[j] = l[i]
+			}
+		}
+		if keys == nil {
+			out = append(out, row)
+			continue
+		}
+		obj := make(map[string]any, len(keys))
+		for j, k := range keys {
+			obj[k] = row[j]
+		}
+		out = append(out, obj)
+	}
+	b, _ := json.Marshal(out)
+	return map[string]any{"list_json": string(b)}, nil
+}
+
+// Groups elements by a field, keeping first-seen order. Values are grouped by
+// their text, the key counts_json uses, so 1 and "1" share a group.
+// Required payload:
+//
+//	list_json: array
+//	field:     dotted path inside each element
+//
+// Output:
+//
+//	{ "groups_json": "<[{key, count, items}]>", "counts_json": "<{key: count}>" }
+func handleGroupBy(_ context.Context, payload map[string]any) (map[string]any, error) {
+	arr, err := arrayPayload(payload, "list_json")
+	if err != nil {
+		return nil, err
+	}
+	field, err := utils.GetStringPayload(payload, "field")
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		Key   any   `json:"key"`
+		Count int   `json:"count"`
+		Items []any `json:"items"`
+	}
+	var groups []*group
+	counts := map[string]int{}
+	index := map[string]*group{}
+	for _, el := range arr {
+		v, _ := lookup(el, field)
+		k := utils.ToText(v)
+		g, ok := index[k]
+		if !ok {
+			g = &group{Key: v}
+			index[k] = g
+			groups = append(groups, g)
+		}
+		g.Items = append(g.Items, el)
+		g.Count++
+		counts[k] = g.Count
+	}
+	if groups == nil {
+		groups = []*group{}
+	}
+	bg, _ := json.Marshal(groups)
+	bc, _ := json.Marshal(counts)
+	return map[string]any{"groups_json": string(bg), "counts_json": string(bc)}, nil
+}
+
+// Parses a JSON array from a string payload (or accepts an inline array).
+func arrayPayload(payload map[string]any, key string) ([]any, error) {
+	v, ok := payload[key]
+	if !ok {
+		return nil, fmt.Errorf("payload is missing required key: '%s'", key)
+	}
+	if arr, ok := v.([]any); ok {
+		return arr, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("payload key '%s' has an invalid type (expected JSON array string)", key)
+	}
+	var arr []any
+	if err := json.Unmarshal([]byte(s), &arr); err != nil {
+		return nil, fmt.Errorf("%s must be a JSON array: %w", key, err)
+	}
+	return arr, nil
+}
+
+// Resolves a dotted path ("a.b.0") inside v; an empty path is v itself.
+func lookup(v any, path string) (any, bool) {
+	path = strings.TrimSpace(path)
+	if path == "" || path == "." {
+		return v, true
+	}
+	cur := v
+	for _, p := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[p]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// Stable identity of a value for de-duplication and grouping (1 and 1.0 match;
+// object keys are sorted by encoding/json).
+func canonical(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func number(v any) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Numbers (or numeric strings) compare numerically, everything else as text.
+func compareValues(a, b any, caseSensitive bool) int {
+	if fa, ok := number(a); ok {
+		if fb, ok := number(b); ok {
+			return compareFloats(fa, fb)
+		}
+	}
+	if ba, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok {
+			if ba == bb {
+				return 0
+			}
+			if bb {
+				return -1
+			}
+			return 1
+		}
+	}
+	sa, sb := utils.ToText(a), utils.ToText(b)
+	if !caseSensitive {
+		sa, sb = strings.ToLower(sa), strings.ToLower(sb)
+	}
+	return strings.Compare(sa, sb)
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -26,6 +26,18 @@ func GenerateContentGemini(ctx context.Context, prompt string, model_name string
 
 func ExtractStructured(ctx context.Context, input string, schema any, instruction, model string) (map[string]any, error) {
 	model = allowedModelOrDefault(model)
+	jsonOut, err := llm_client.GenerateJSON(ctx, extractPrompt(input, instruction), model, schema)
+	if err != nil {
+		return nil, err
+	}
+	var scratch any
+	if err := json.Unmarshal([]byte(jsonOut), &scratch); err != nil {
+		return nil, fmt.Errorf("LLM did not return valid JSON: %w\nRaw: %s", err, jsonOut)
+	}
+	return map[string]any{"json": jsonOut}, nil
+}
+
+func extractPrompt(input, instruction string) string {
 	var sb strings.Builder
 	if strings.TrimSpace(instruction) != "" {
 		sb.WriteString(instruction)
@@ -35,26 +47,14 @@ func ExtractStructured(ctx context.Context, input string, schema any, instructio
 	sb.WriteString("=== Input Start ===\n")
 	sb.WriteString(input)
 	sb.WriteString("\n=== Input End ===\n")
-	jsonOut, err := llm_client.GenerateJSON(ctx, sb.String(), model, schema)
-	if err != nil {
-		return nil, err
-	}
-	var scratch any
-	if err := json.Unmarshal([]byte(jsonOut), &scratch); err != nil {
-		return nil, fmt.Errorf("LLM did not return valid JSON: %w\nRaw: %s", err, jsonOut)
-	}
-	return map[string]any{"json": jsonOut}, nil
+	return sb.String()
 }
 
-func SelectFromList(ctx context.Context, listJSON, instruction, model string, limit int) (map[string]any, error) {
-	model = allowedModelOrDefault(model)
+func selectPrompt(listJSON, instruction string) string {
 	if strings.TrimSpace(instruction) == "" {
 		instruction = "From the input array, return ONLY the items that match the criteria. Do not rewrite items; just copy them. Return a JSON array."
 	}
-	if limit <= 0 {
-		limit = 5000
-	}
-	prompt := fmt.Sprintf(`%s
+	return fmt.Sprintf(`%s
 
 RULES:
 - Input is a JSON array.
@@ -65,8 +65,14 @@ INPUT:
 %s
 
 OUTPUT (JSON only):`, instruction, listJSON)
+}
 
-	jsonOut, err := llm_client.GenerateJSON(ctx, prompt, model, nil)
+func SelectFromList(ctx context.Context, listJSON, instruction, model string, limit int) (map[string]any, error) {
+	model = allowedModelOrDefault(model)
+	if limit <= 0 {
+		limit = 5000
+	}
+	jsonOut, err := llm_client.GenerateJSON(ctx, selectPrompt(listJSON, instruction), model, nil)
 	if err != nil {
 		return nil, err
 	}
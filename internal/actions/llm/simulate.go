@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"a-a/internal/llm_client"
+	"a-a/internal/parser"
+	"a-a/internal/utils"
+)
+
+// Rough prompt size: about four bytes per token for English text and JSON.
+const bytesPerToken = 4
+
+// Estimates the prompt tokens an llm action would send. Inputs that come from
+// earlier actions are only known at run time and are left out of the count.
+func SimulateLlmAction(ctx context.Context, operation string, payload map[string]any) ([]utils.Effect, error) {
+	var prompt string
+	switch operation {
+	case "generate_content":
+		p, err := utils.GetStringPayload(payload, "prompt")
+		if err != nil {
+			return nil, err
+		}
+		prompt = p
+	case "extract_structured":
+		input, err := utils.GetStringPayload(payload, "input")
+		if err != nil {
+			return nil, err
+		}
+		instruction, _ := payload["instruction"].(string)
+		prompt = extractPrompt(input, instruction)
+		// The schema travels with the request
+		if s, ok := payload["schema"].(string); ok {
+			prompt += s
+		} else if b, err := json.Marshal(payload["schema"]); err == nil {
+			prompt += string(b)
+		}
+	case "select_from_list":
+		listJSON, err := utils.GetStringPayload(payload, "list_json")
+		if err != nil {
+			return nil, err
+		}
+		instruction, _ := payload["instruction"].(string)
+		prompt = selectPrompt(listJSON, instruction)
+	default:
+		return nil, fmt.Errorf("unknown llm operation: %s", operation)
+	}
+
+	model, _ := payload["model"].(string)
+	if llm_client.ActiveBackend() != "" {
+		model = allowedModelOrDefault(model)
+	} else if model == "" {
+		model = "default model"
+	}
+	e := utils.Effect{
+		Kind:   utils.EffectLLM,
+		Target: model,
+		Tokens: (len(prompt) + bytesPerToken - 1) / bytesPerToken,
+	}
+	if parser.HasPlaceholder(prompt) {
+		e.Detail = "plus inputs known at run time"
+	}
+	return []utils.Effect{e}, nil
+}
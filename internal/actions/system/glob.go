@@ -0,0 +1,259 @@
+package system
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"a-a/internal/utils"
+)
+
+var errGlobLimit = errors.New("glob: result limit reached")
+
+// GlobOptions tune Glob; the zero value matches regular files only and
+// skips dot-files unless the pattern names them explicitly.
+type GlobOptions struct {
+	Dirs   bool // also match directories
+	Hidden bool // descend into and match dot-files
+	Limit  int  // stop after this many matches (0 = no limit)
+}
+
+// Glob matches pattern against the file tree. On top of filepath.Match
+// syntax it supports "**" (any number of directories) and "{a,b}"
+// alternatives. Relative patterns are resolved against root (default ".").
+// Results are sorted; truncated is true when Limit cut the walk short.
+func Glob(root, pattern string, opts GlobOptions) (matches []string, truncated bool, err error) {
+	if root == "" {
+		root = "."
+	}
+	if strings.HasPrefix(pattern, ".") || strings.Contains(pattern, "/.") {
+		opts.Hidden = true
+	}
+	seen := map[string]struct{}{}
+	for _, p := range expandBraces(filepath.ToSlash(pattern)) {
+		if !path.IsAbs(p) && !filepath.IsAbs(p) {
+			p = path.Join(filepath.ToSlash(root), p)
+		}
+		err = globOne(p, opts, func(m string) error {
+			if _, dup := seen[m]; dup {
+				return nil
+			}
+			if opts.Limit > 0 && len(seen) >= opts.Limit {
+				return errGlobLimit
+			}
+			seen[m] = struct{}{}
+			matches = append(matches, m)
+			return nil
+		})
+		if errors.Is(err, errGlobLimit) {
+			truncated, err = true, nil
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	sort.Strings(matches)
+	return matches, truncated, nil
+}
+
+type globEntry struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified"`
+	IsDir    bool   `json:"is_dir"`
+}
+
+// Finds files by pattern.
+// Required payload:
+//
+//	pattern: glob such as "tmp/**/*.json" or "out/*.{csv,md}" ("**" spans directories)
+//
+// Optional payload:
+//
+//	path:   root for relative patterns (default ".")
+//	dirs:   also match directories (default false)
+//	hidden: include dot-files (default false, implied when the pattern names one)
+//	limit:  max matches (default 10000)
+//
+// Output:
+//
+//	{
+//	  "paths_json": "<[path]>",
+//	  "files_json": "<[{path, size, modified, is_dir}]>",
+//	  "count":      int,
+//	  "truncated":  bool
+//	}
+func handleGlob(payload map[string]any) (map[string]any, error) {
+	pattern, err := utils.GetStringPayload(payload, "pattern")
+	if err != nil {
+		return nil, err
+	}
+	root, _ := payload["path"].(string)
+	opts := GlobOptions{Limit: 10000}
+	opts.Dirs, _ = payload["dirs"].(bool)
+	opts.Hidden, _ = payload["hidden"].(bool)
+	if v, ok := payload["limit"]; ok {
+		if n, err := utils.GetIntPayload(map[string]any{"v": v}, "v"); err == nil && n > 0 {
+			opts.Limit = n
+		}
+	}
+
+	matches, truncated, err := Glob(root, pattern, opts)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]globEntry, 0, len(matches))
+	for _, m := range matches {
+		e := globEntry{Path: m}
+		if fi, err := os.Stat(m); err == nil {
+			e.Size, e.IsDir = fi.Size(), fi.IsDir()
+			e.Modified = fi.ModTime().UTC().Format(time.RFC3339)
+		}
+		files = append(files, e)
+	}
+	if matches == nil {
+		matches = []string{}
+	}
+	bp, _ := json.Marshal(matches)
+	bf, _ := json.Marshal(files)
+	return map[string]any{
+		"paths_json": string(bp),
+		"files_json": string(bf),
+		"count":      len(matches),
+		"truncated":  truncated,
+	}, nil
+}
+
+func globOne(pattern string, opts GlobOptions, emit func(string) error) error {
+	segs := strings.Split(pattern, "/")
+	// Walk from the longest prefix without wildcards
+	static := 0
+	for static < len(segs)-1 && !hasMeta(segs[static]) {
+		static++
+	}
+	if !hasMeta(segs[len(segs)-1]) && static == len(segs)-1 {
+		p := filepath.FromSlash(pattern)
+		fi, err := os.Stat(p)
+		if err != nil || (fi.IsDir() && !opts.Dirs) {
+			return nil
+		}
+		return emit(p)
+	}
+	base := strings.Join(segs[:static], "/")
+	if base == "" && strings.HasPrefix(pattern, "/") {
+		base = "/"
+	} else if base == "" {
+		base = "."
+	}
+	rest := segs[static:]
+	deep := false
+	for _, s := range rest {
+		if s == "**" {
+			deep = true
+		}
+	}
+
+	return filepath.WalkDir(filepath.FromSlash(base), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // missing base or unreadable directory: no matches there
+		}
+		rel, _ := filepath.Rel(filepath.FromSlash(base), p)
+		if rel == "." {
+			return nil
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if !opts.Hidden && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && !deep && len(parts) >= len(rest) {
+			if len(parts) == len(rest) && opts.Dirs && matchSegments(rest, parts) {
+				if err := emit(p); err != nil {
+					return err
+				}
+			}
+			return filepath.SkipDir
+		}
+		if d.IsDir() && !deep && !matchSegments(rest[:len(parts)], parts) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() && !opts.Dirs {
+			return nil
+		}
+		if matchSegments(rest, parts) {
+			return emit(p)
+		}
+		return nil
+	})
+}
+
+func matchSegments(pat, parts []string) bool {
+	if len(pat) == 0 {
+		return len(parts) == 0
+	}
+	if pat[0] == "**" {
+		return matchSegments(pat[1:], parts) || (len(parts) > 0 && matchSegments(pat, parts[1:]))
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pat[0], parts[0])
+	return ok && matchSegments(pat[1:], parts[1:])
+}
+
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// "a/{b,c}/*.{csv,json}" -> four patterns.
+func expandBraces(p string) []string {
+	open := strings.IndexByte(p, '{')
+	if open < 0 {
+		return []string{p}
+	}
+	depth, end := 0, -1
+	for i := open; i < len(p) && end < 0; i++ {
+		switch p[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				end = i
+			}
+		}
+	}
+	if end < 0 {
+		return []string{p}
+	}
+	var alts []string
+	depth, start := 0, open+1
+	for i := open + 1; i < end; i++ {
+		switch p[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alts = append(alts, p[start:i])
+				start = i + 1
+			}
+		}
+	}
+	alts = append(alts, p[start:end])
+	var out []string
+	for _, a := range alts {
+		out = append(out, expandBraces(p[:open]+a+p[end+1:])...)
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"a-a/internal/parser"
+	"a-a/internal/utils"
+)
+
+// Reports the paths a system action would create, overwrite, append to or
+// delete, checked against the real filesystem. Reads report nothing.
+func SimulateSystemAction(ctx context.Context, operation string, payload map[string]any) ([]utils.Effect, error) {
+	switch operation {
+	case "glob", "read_file", "list_directory", "checksum":
+		return nil, nil
+	}
+	path, err := utils.GetStringPayload(payload, "path")
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation {
+	case "create_file", "write_file_atomic":
+		return []utils.Effect{utils.FileEffect(path, false)}, nil
+	case "write_file":
+		e := utils.FileEffect(path, true)
+		if content, ok := payload["content"].(string); ok {
+			e.Detail = joinDetail(e.Detail, fmt.Sprintf("+%d bytes", len(content)))
+		}
+		return []utils.Effect{e}, nil
+	case "delete_file", "delete_folder":
+		if e := utils.DeleteEffect(path); e != nil {
+			return []utils.Effect{*e}, nil
+		}
+		if operation == "delete_file" {
+			return []utils.Effect{{Kind: utils.EffectDelete, Target: path, Detail: "does not exist; the action would fail"}}, nil
+		}
+		return nil, nil
+	case "create_folder":
+		if _, err := os.Stat(path); err == nil && !parser.HasPlaceholder(path) {
+			return nil, nil // already there
+		}
+		e := utils.FileEffect(path, false)
+		if e.Kind == utils.EffectCreate {
+			e.Detail = "folder"
+		}
+		return []utils.Effect{e}, nil
+	default:
+		return nil, fmt.Errorf("unknown system operation: %s", operation)
+	}
+}
+
+func joinDetail(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + ", " + b
+}
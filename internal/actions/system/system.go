@@ -2,9 +2,14 @@ package system
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"a-a/internal/utils"
 )
@@ -106,7 +111,32 @@ func WriteFileAtomic(path string, content string) error {
 	return nil
 }
 
+// Returns SHA-256 and MD5 of a file in one pass. When expected is set (hex,
+// either algorithm) a mismatch is an error.
+func Checksum(path, expected string) (map[string]any, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: %w", err)
+	}
+	defer f.Close()
+	s256, m5 := sha256.New(), md5.New()
+	n, err := io.Copy(io.MultiWriter(s256, m5), f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read file: %w", err)
+	}
+	sum256, sumMD5 := hex.EncodeToString(s256.Sum(nil)), hex.EncodeToString(m5.Sum(nil))
+	if expected = strings.ToLower(strings.TrimSpace(expected)); expected != "" && expected != sum256 && expected != sumMD5 {
+		return nil, fmt.Errorf("checksum mismatch for %s: expected %s, got sha256 %s / md5 %s", path, expected, sum256, sumMD5)
+	}
+	return map[string]any{"path": path, "sha256": sum256, "md5": sumMD5, "bytes": n}, nil
+}
+
 func HandleSystemAction(ctx context.Context, operation string, payload map[string]any) (map[string]any, error) {
+	// glob takes a pattern; "path" is only its optional root
+	if operation == "glob" {
+		return handleGlob(payload)
+	}
+
 	path, err := utils.GetStringPayload(payload, "path")
 	if err != nil {
 		return nil, err
@@ -118,6 +148,14 @@ func HandleSystemAction(ctx context.Context, operation string, payload map[strin
 	default:
 	}
 
+	// Built-in undo for writes, recorded before they run; see undo.go
+	if err := prepareUndo(ctx, operation, path, payload); err != nil {
+		return nil, fmt.Errorf("system.%s: %w", operation, err)
+	}
+	return runOperation(operation, path, payload)
+}
+
+func runOperation(operation, path string, payload map[string]any) (map[string]any, error) {
 	switch operation {
 	case "create_file":
 		return nil, CreateFile(path)
@@ -143,6 +181,9 @@ func HandleSystemAction(ctx context.Context, operation string, payload map[strin
 		return ReadFile(path)
 	case "list_directory":
 		return ListDirectory(path)
+	case "checksum":
+		expected, _ := payload["expected"].(string)
+		return Checksum(path, expected)
 	default:
 		return nil, fmt.Errorf("unknown system operation: %s", operation)
 	}
@@ -0,0 +1,214 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"a-a/internal/utils"
+)
+
+// Content kept in memory to restore overwritten or deleted files, per action
+// journal: all snapshots of an action (every file of a flow.foreach) share it.
+const undoMaxBytes = 32 << 20
+
+// Operations that change the filesystem and can be undone.
+var undoable = map[string]bool{
+	"create_file":       true,
+	"write_file":        true,
+	"write_file_atomic": true,
+	"delete_file":       true,
+	"create_folder":     true,
+	"delete_folder":     true,
+}
+
+// Snapshots what operation is about to change at path and records the
+// matching undo in the mission journal before the operation runs, so a write
+// that fails halfway is rolled back too. It fails when the previous state
+// cannot be kept (too large, unreadable); the action must not run then,
+// unless the payload opts out with "undo": false. Without a journal (no
+// mission, or a rollback running) nothing is captured.
+func prepareUndo(ctx context.Context, operation, path string, payload map[string]any) error {
+	journal := utils.JournalFromContext(ctx)
+	if journal == nil || !undoable[operation] {
+		return nil
+	}
+	if keep, ok := payload["undo"].(bool); ok && !keep {
+		return nil
+	}
+	reserve := func(n int64) error {
+		if !journal.Reserve(n, undoMaxBytes) {
+			return fmt.Errorf("the action's %d MiB undo budget is used up", undoMaxBytes>>20)
+		}
+		return nil
+	}
+	var u utils.Undo
+	var err error
+	switch operation {
+	case "create_folder":
+		u = folderCreationUndo(path)
+	case "delete_folder":
+		u, err = folderSnapshotUndo(path, reserve)
+	default:
+		u, err = fileSnapshotUndo(path, reserve)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot keep the previous state for rollback: %w (set \"undo\": false to run it anyway)", err)
+	}
+	if u.Run != nil {
+		journal.Add(u)
+	}
+	return nil
+}
+
+// Restores the file's previous content, or removes it if it did not exist.
+func fileSnapshotUndo(path string, reserve func(int64) error) (utils.Undo, error) {
+	info, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return utils.Undo{
+			Description: "remove " + path,
+			Run: func(context.Context) error {
+				if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return err
+				}
+				return nil
+			},
+		}, nil
+	case err != nil || info.IsDir():
+		return utils.Undo{}, nil // the operation itself will fail
+	}
+	snap, err := snapshotEntry(path, info, reserve)
+	if err != nil {
+		return utils.Undo{}, err
+	}
+	return utils.Undo{
+		Description: fmt.Sprintf("restore %s (%d bytes)", path, len(snap.content)),
+		Run: func(context.Context) error {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			return snap.restore(path)
+		},
+	}, nil
+}
+
+// Removes the folders create_folder made, deepest first. Folders that are
+// not empty any more are left in place and reported.
+func folderCreationUndo(path string) utils.Undo {
+	var created []string
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if _, err := os.Lstat(p); err == nil || !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		created = append(created, p)
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	if len(created) == 0 {
+		return utils.Undo{}
+	}
+	return utils.Undo{
+		Description: "remove folder " + created[len(created)-1],
+		Run: func(context.Context) error {
+			for _, p := range created {
+				if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// Restores a deleted folder tree from an in-memory copy; entries a failed
+// delete left behind are overwritten.
+func folderSnapshotUndo(path string, reserve func(int64) error) (utils.Undo, error) {
+	if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		return utils.Undo{}, nil
+	}
+	var entries []entrySnapshot
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		snap, err := snapshotEntry(p, info, reserve)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, snap)
+		return nil
+	})
+	if err != nil {
+		return utils.Undo{}, err
+	}
+	return utils.Undo{
+		Description: fmt.Sprintf("restore folder %s (%d entries)", path, len(entries)),
+		Run: func(context.Context) error {
+			for _, e := range entries { // WalkDir lists parents first
+				if err := e.restore(e.path); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}, nil
+}
+
+type entrySnapshot struct {
+	path    string
+	mode    fs.FileMode
+	content []byte // regular files
+	target  string // symlinks
+}
+
+// Regular files are read only if reserve accepts their size.
+func snapshotEntry(path string, info fs.FileInfo, reserve func(int64) error) (entrySnapshot, error) {
+	s := entrySnapshot{path: path, mode: info.Mode()}
+	switch {
+	case info.IsDir():
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return s, err
+		}
+		s.target = target
+	case info.Mode().IsRegular():
+		if err := reserve(info.Size()); err != nil {
+			return s, fmt.Errorf("%s (%d bytes): %w", path, info.Size(), err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return s, err
+		}
+		s.content = b
+	default:
+		return s, fmt.Errorf("%s is not a regular file, folder or symlink", path)
+	}
+	return s, nil
+}
+
+func (s entrySnapshot) restore(path string) error {
+	switch {
+	case s.mode.IsDir():
+		return os.MkdirAll(path, s.mode.Perm())
+	case s.mode&fs.ModeSymlink != 0:
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return os.Symlink(s.target, path)
+	default:
+		if err := os.WriteFile(path, s.content, s.mode.Perm()); err != nil {
+			return err
+		}
+		return os.Chmod(path, s.mode.Perm())
+	}
+}
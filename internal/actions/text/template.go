@@ -0,0 +1,129 @@
+package text
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"a-a/internal/utils"
+)
+
+// Payload keys that configure text.template rather than feed it data.
+var templateOptions = map[string]struct{}{"template": {}, "strict": {}, "data_json": {}}
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"join": func(sep string, v any) string {
+		arr, ok := v.([]any)
+		if !ok {
+			return utils.ToText(v)
+		}
+		parts := make([]string, len(arr))
+		for i, x := range arr {
+			parts[i] = utils.ToText(x)
+		}
+		return strings.Join(parts, sep)
+	},
+	"replace": func(old, repl, s string) string { return strings.ReplaceAll(s, old, repl) },
+	"default": func(def, v any) any {
+		if v == nil || utils.ToText(v) == "" {
+			return def
+		}
+		return v
+	},
+	"json": func(v any) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	},
+	"json_pretty": func(v any) string {
+		b, _ := json.MarshalIndent(v, "", "  ")
+		return string(b)
+	},
+	"text": utils.ToText,
+	"truncate": func(n int, s string) string {
+		r := []rune(s)
+		if len(r) <= n {
+			return s
+		}
+		return string(r[:n]) + "…"
+	},
+	"add": func(a, b int) int { return a + b },
+}
+
+// Renders a Go text/template against named inputs.
+// Required payload:
+//
+//	template: Go text/template source, e.g. "# {{.title}}\n{{range .items}}- {{.name}}\n{{end}}"
+//
+// Every other payload key is template data, typically "@results..." values.
+// Keys ending in "_json" are also decoded and exposed without the suffix
+// ("items_json" -> .items). data_json (an object) is merged in as well.
+//
+// Optional payload:
+//
+//	strict: fail on missing keys instead of rendering them empty (default false)
+//
+// Extra functions: upper, lower, trim, join SEP LIST, replace OLD NEW S,
+// default DEF V, json, json_pretty, text, truncate N S, add A B.
+//
+// Output:
+//
+//	{ "text": string }
+func handleTemplate(_ context.Context, payload map[string]any) (map[string]any, error) {
+	src, err := utils.GetStringPayload(payload, "template")
+	if err != nil {
+		return nil, err
+	}
+	strict, _ := payload["strict"].(bool)
+
+	data := map[string]any{}
+	if raw, ok := payload["data_json"]; ok {
+		obj, ok := raw.(map[string]any)
+		if s, isStr := raw.(string); isStr {
+			if err := json.Unmarshal([]byte(s), &obj); err != nil {
+				return nil, fmt.Errorf("data_json must be a JSON object: %w", err)
+			}
+		} else if !ok {
+			return nil, fmt.Errorf("data_json must be a JSON object")
+		}
+		for k, v := range obj {
+			data[k] = v
+		}
+	}
+	for k, v := range payload {
+		if _, skip := templateOptions[k]; skip {
+			continue
+		}
+		data[k] = v
+		if s, ok := v.(string); ok && strings.HasSuffix(k, "_json") {
+			var decoded any
+			if err := json.Unmarshal([]byte(s), &decoded); err == nil {
+				data[strings.TrimSuffix(k, "_json")] = decoded
+			}
+		}
+	}
+
+	missing := "missingkey=zero"
+	if strict {
+		missing = "missingkey=error"
+	}
+	tpl, err := template.New("text.template").Option(missing).Funcs(templateFuncs).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("render template: %w", err)
+	}
+	out := buf.String()
+	if !strict {
+		// Missing map keys print as "<no value>" even with missingkey=zero
+		out = strings.ReplaceAll(out, "<no value>", "")
+	}
+	return map[string]any{"text": out}, nil
+}
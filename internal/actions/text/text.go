@@ -0,0 +1,366 @@
+package text
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"a-a/internal/utils"
+)
+
+const maxMatches = 10000
+
+// Approximate tokens: runs of letters/digits, or single punctuation marks.
+var tokenRe = regexp.MustCompile(`[\p{L}\p{N}_]+|[^\s\p{L}\p{N}_]`)
+
+// All regex matches with their capture groups.
+// Required payload:
+//
+//	text:    input
+//	pattern: Go (RE2) regular expression
+//
+// Optional payload:
+//
+//	flags:  any of "i" (case-insensitive), "m" (multi-line), "s" (dot matches newline)
+//	unique: drop repeated matches (default false)
+//	limit:  max matches (default 10000)
+//
+// Output:
+//
+//	{
+//	  "matches_json": "<[full match]>",
+//	  "groups_json":  "<[[group1, group2, ...]]>",
+//	  "named_json":   "<[{name: value}]>" (only for named groups),
+//	  "count":        int
+//	}
+func handleRegexFindAll(_ context.Context, payload map[string]any) (map[string]any, error) {
+	text, err := utils.GetStringPayload(payload, "text")
+	if err != nil {
+		return nil, err
+	}
+	re, err := compilePattern(payload)
+	if err != nil {
+		return nil, err
+	}
+	limit := maxMatches
+	if v, ok := payload["limit"]; ok {
+		if n, err := utils.GetIntPayload(map[string]any{"v": v}, "v"); err == nil && n > 0 && n < maxMatches {
+			limit = n
+		}
+	}
+	unique, _ := payload["unique"].(bool)
+
+	names := re.SubexpNames()
+	hasNamed := false
+	for _, n := range names {
+		if n != "" {
+			hasNamed = true
+		}
+	}
+
+	matches := []string{}
+	groups := [][]string{}
+	named := []map[string]string{}
+	seen := map[string]struct{}{}
+	for _, m := range re.FindAllStringSubmatch(text, -1) {
+		if len(matches) >= limit {
+			break
+		}
+		if unique {
+			if _, ok := seen[m[0]]; ok {
+				continue
+			}
+			seen[m[0]] = struct{}{}
+		}
+		matches = append(matches, m[0])
+		groups = append(groups, append([]string{}, m[1:]...))
+		if hasNamed {
+			obj := map[string]string{}
+			for i, n := range names {
+				if n != "" {
+					obj[n] = m[i]
+				}
+			}
+			named = append(named, obj)
+		}
+	}
+
+	bm, _ := json.Marshal(matches)
+	bg, _ := json.Marshal(groups)
+	bn, _ := json.Marshal(named)
+	return map[string]any{
+		"matches_json": string(bm),
+		"groups_json":  string(bg),
+		"named_json":   string(bn),
+		"count":        len(matches),
+	}, nil
+}
+
+// Replaces matches of a regex (or a literal string).
+// Required payload:
+//
+//	text:        input
+//	pattern:     regex, or the literal to replace when literal=true
+//	replacement: replacement ("$1" / "${name}" expand groups unless literal)
+//
+// Optional payload:
+//
+//	literal: treat pattern and replacement as plain strings (default false)
+//	flags:   "i", "m", "s"
+//
+// Output:
+//
+//	{ "text": string, "replacements": int }
+func handleReplace(_ context.Context, payload map[string]any) (map[string]any, error) {
+	text, err := utils.GetStringPayload(payload, "text")
+	if err != nil {
+		return nil, err
+	}
+	replacement, ok := payload["replacement"]
+	if !ok {
+		return nil, fmt.Errorf("payload is missing required key: 'replacement'")
+	}
+	repl := fmt.Sprint(replacement)
+	if replacement == nil {
+		repl = ""
+	}
+	literal, _ := payload["literal"].(bool)
+
+	if literal {
+		pattern, err := utils.GetStringPayload(payload, "pattern")
+		if err != nil {
+			return nil, err
+		}
+		if pattern == "" {
+			return nil, fmt.Errorf("pattern must not be empty")
+		}
+		n := strings.Count(text, pattern)
+		return map[string]any{"text": strings.ReplaceAll(text, pattern, repl), "replacements": n}, nil
+	}
+
+	re, err := compilePattern(payload)
+	if err != nil {
+		return nil, err
+	}
+	locs := re.FindAllStringSubmatchIndex(text, -1)
+	var out []byte
+	last := 0
+	for _, loc := range locs {
+		out = append(out, text[last:loc[0]]...)
+		out = re.ExpandString(out, repl, text, loc)
+		last = loc[1]
+	}
+	out = append(out, text[last:]...)
+	return map[string]any{"text": string(out), "replacements": len(locs)}, nil
+}
+
+// Splits text into parts.
+// Required payload:
+//
+//	text: input
+//
+// Optional payload:
+//
+//	separator:  string (default "\n"); a regex when regex=true
+//	regex:      treat separator as a regular expression (default false)
+//	trim:       trim whitespace around parts (default true)
+//	keep_empty: keep empty parts (default false)
+//
+// Output:
+//
+//	{ "parts_json": "<[string]>", "count": int }
+func handleSplit(_ context.Context, payload map[string]any) (map[string]any, error) {
+	text, err := utils.GetStringPayload(payload, "text")
+	if err != nil {
+		return nil, err
+	}
+	sep := "\n"
+	if s, ok := payload["separator"].(string); ok && s != "" {
+		sep = s
+	}
+	trim := true
+	if v, ok := payload["trim"].(bool); ok {
+		trim = v
+	}
+	keepEmpty, _ := payload["keep_empty"].(bool)
+
+	var raw []string
+	if isRegex, _ := payload["regex"].(bool); isRegex {
+		re, err := regexp.Compile(sep)
+		if err != nil {
+			return nil, fmt.Errorf("invalid separator regex %q: %w", sep, err)
+		}
+		raw = re.Split(text, -1)
+	} else {
+		if sep == "\n" {
+			text = strings.ReplaceAll(text, "\r\n", "\n")
+		}
+		raw = strings.Split(text, sep)
+	}
+
+	parts := make([]string, 0, len(raw))
+	for _, p := range raw {
+		if trim {
+			p = strings.TrimSpace(p)
+		}
+		if p == "" && !keepEmpty {
+			continue
+		}
+		parts = append(parts, p)
+	}
+	b, _ := json.Marshal(parts)
+	return map[string]any{"parts_json": string(b), "count": len(parts)}, nil
+}
+
+// Joins an array into text; non-string elements are JSON-encoded.
+// Required payload:
+//
+//	list_json: array
+//
+// Optional payload:
+//
+//	separator: default "\n"
+//	prefix:    added before each element (e.g. "- ")
+//	suffix:    added after each element
+//
+// Output:
+//
+//	{ "text": string }
+func handleJoin(_ context.Context, payload map[string]any) (map[string]any, error) {
+	listJSON, err := utils.GetStringPayload(payload, "list_json")
+	if err != nil {
+		return nil, err
+	}
+	var arr []any
+	if err := json.Unmarshal([]byte(listJSON), &arr); err != nil {
+		return nil, fmt.Errorf("list_json must be a JSON array: %w", err)
+	}
+	sep := "\n"
+	if s, ok := payload["separator"].(string); ok {
+		sep = s
+	}
+	prefix, _ := payload["prefix"].(string)
+	suffix, _ := payload["suffix"].(string)
+
+	parts := make([]string, len(arr))
+	for i, v := range arr {
+		parts[i] = prefix + utils.ToText(v) + suffix
+	}
+	return map[string]any{"text": strings.Join(parts, sep)}, nil
+}
+
+// Shortens text to a byte or token budget without splitting UTF-8 characters.
+// Required payload:
+//
+//	text: input
+//	max_bytes or max_tokens (approximate: words and punctuation marks)
+//
+// Optional payload:
+//
+//	ellipsis: appended when truncated (default "")
+//
+// Output:
+//
+//	{ "text": string, "truncated": bool, "bytes": int, "tokens": int }
+func handleTruncate(_ context.Context, payload map[string]any) (map[string]any, error) {
+	text, err := utils.GetStringPayload(payload, "text")
+	if err != nil {
+		return nil, err
+	}
+	ellipsis, _ := payload["ellipsis"].(string)
+	out := text
+
+	switch {
+	case payload["max_bytes"] != nil:
+		n, err := utils.GetIntPayload(payload, "max_bytes")
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("max_bytes must be >= 0")
+		}
+		if len(text) > n {
+			cut := max(n-len(ellipsis), 0)
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+			out = strings.TrimRight(text[:cut], " \t\n") + ellipsis
+		}
+	case payload["max_tokens"] != nil:
+		n, err := utils.GetIntPayload(payload, "max_tokens")
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("max_tokens must be >= 0")
+		}
+		locs := tokenRe.FindAllStringIndex(text, n+1)
+		if len(locs) > n {
+			end := 0
+			if n > 0 {
+				end = locs[n-1][1]
+			}
+			out = text[:end] + ellipsis
+		}
+	default:
+		return nil, fmt.Errorf("payload needs 'max_bytes' or 'max_tokens'")
+	}
+
+	return map[string]any{
+		"text":      out,
+		"truncated": out != text,
+		"bytes":     len(out),
+		"tokens":    len(tokenRe.FindAllStringIndex(out, -1)),
+	}, nil
+}
+
+func compilePattern(payload map[string]any) (*regexp.Regexp, error) {
+	pattern, err := utils.GetStringPayload(payload, "pattern")
+	if err != nil {
+		return nil, err
+	}
+	flags, _ := payload["flags"].(string)
+	prefix := ""
+	for _, f := range flags {
+		switch f {
+		case 'i', 'm', 's':
+			if !strings.ContainsRune(prefix, f) {
+				prefix += string(f)
+			}
+		case 'g':
+			// Always global
+		default:
+			return nil, fmt.Errorf("unsupported regex flag %q (use i, m, s)", f)
+		}
+	}
+	if prefix != "" {
+		pattern = "(?" + prefix + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+func HandleTextAction(ctx context.Context, operation string, payload map[string]any) (map[string]any, error) {
+	switch operation {
+	case "regex_find_all":
+		return handleRegexFindAll(ctx, payload)
+	case "replace":
+		return handleReplace(ctx, payload)
+	case "split":
+		return handleSplit(ctx, payload)
+	case "join":
+		return handleJoin(ctx, payload)
+	case "template":
+		return handleTemplate(ctx, payload)
+	case "truncate":
+		return handleTruncate(ctx, payload)
+	default:
+		return nil, fmt.Errorf("unknown text operation: %s", operation)
+	}
+}
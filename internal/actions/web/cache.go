@@ -0,0 +1,187 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Per-payload cache modes for web.request / web.batch_request.
+const (
+	CacheRevalidate = "revalidate" // Default: conditional request when validators exist
+	CacheForce      = "force"      // Serve a stored copy without touching the network
+	CacheBypass     = "bypass"     // Neither read nor write the cache
+)
+
+type cacheEntry struct {
+	URL          string            `json:"url"`
+	FinalURL     string            `json:"final_url"`
+	StatusCode   int               `json:"status_code"`
+	Headers      map[string]string `json:"headers"`
+	Content      string            `json:"content"`
+	ETag         string            `json:"etag,omitempty"`
+	LastModified string            `json:"last_modified,omitempty"`
+	Vary         map[string]string `json:"vary,omitempty"` // Request header values the response varies on
+	StoredAt     time.Time         `json:"stored_at"`
+}
+
+// All variants of one method+URL live in the same file.
+type cacheFile struct {
+	Variants []cacheEntry `json:"variants"`
+}
+
+var cacheMu sync.Mutex
+
+func cacheModeOf(payload map[string]any) (string, error) {
+	mode, _ := payload["cache"].(string)
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		return "", nil
+	case CacheRevalidate, CacheForce, CacheBypass:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid cache mode %q (expected force, bypass or revalidate)", mode)
+	}
+}
+
+func cachePath(dir, method, url string) string {
+	sum := sha256.Sum256([]byte(method + " " + url))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func readCacheFile(path string) cacheFile {
+	var cf cacheFile
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cf
+	}
+	_ = json.Unmarshal(b, &cf)
+	return cf
+}
+
+// Finds the stored variant whose Vary'd request headers match hdrs.
+func cacheLookup(dir, method, url string, hdrs map[string]string) (*cacheEntry, bool) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	cf := readCacheFile(cachePath(dir, method, url))
+	for i := range cf.Variants {
+		if varyMatches(cf.Variants[i].Vary, hdrs) {
+			e := cf.Variants[i]
+			return &e, true
+		}
+	}
+	return nil, false
+}
+
+func cacheStore(dir, method string, hdrs map[string]string, r *httpResp) {
+	if r.StatusCode != http.StatusOK {
+		return
+	}
+	cc := strings.ToLower(headerValue(r.Headers, "Cache-Control"))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") {
+		return
+	}
+	vary := map[string]string{}
+	for _, name := range strings.Split(headerValue(r.Headers, "Vary"), ",") {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "*" {
+			return
+		}
+		vary[name] = headerValue(hdrs, name)
+	}
+	e := cacheEntry{
+		URL:          r.URL,
+		FinalURL:     r.FinalURL,
+		StatusCode:   r.StatusCode,
+		Headers:      r.Headers,
+		Content:      r.Content,
+		ETag:         headerValue(r.Headers, "ETag"),
+		LastModified: headerValue(r.Headers, "Last-Modified"),
+		Vary:         vary,
+		StoredAt:     time.Now(),
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return
+	}
+	path := cachePath(dir, method, r.URL)
+	cf := readCacheFile(path)
+	replaced := false
+	for i := range cf.Variants {
+		if varyMatches(cf.Variants[i].Vary, hdrs) {
+			cf.Variants[i] = e
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		cf.Variants = append(cf.Variants, e)
+	}
+	b, err := json.Marshal(cf)
+	if err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, path)
+}
+
+// Refresh the stored copy after a 304 (new validators / headers).
+func cacheTouch(dir, method string, hdrs map[string]string, e *cacheEntry, fresh map[string]string) *httpResp {
+	for _, k := range []string{"ETag", "Last-Modified", "Cache-Control", "Expires", "Date"} {
+		if v := headerValue(fresh, k); v != "" {
+			e.Headers[k] = v
+		}
+	}
+	r := e.toResp()
+	cacheStore(dir, method, hdrs, r)
+	r.FromCache = true
+	return r
+}
+
+func (e *cacheEntry) toResp() *httpResp {
+	return &httpResp{
+		URL:        e.URL,
+		StatusCode: e.StatusCode,
+		Content:    e.Content,
+		FinalURL:   e.FinalURL,
+		Headers:    e.Headers,
+	}
+}
+
+func varyMatches(vary, hdrs map[string]string) bool {
+	for k, v := range vary {
+		if headerValue(hdrs, k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Case-insensitive lookup in a flattened header map.
+func headerValue(h map[string]string, name string) string {
+	if v, ok := h[name]; ok {
+		return v
+	}
+	for k, v := range h {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
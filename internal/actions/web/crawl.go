@@ -0,0 +1,411 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"a-a/internal/utils"
+)
+
+const (
+	crawlDefaultDepth       = 2
+	crawlDefaultPages       = 50
+	crawlMaxPages           = 1000
+	crawlDefaultConcurrency = 4
+)
+
+type crawlPage struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Content    string `json:"content"`
+	Depth      int    `json:"depth"`
+	FromCache  bool   `json:"from_cache,omitempty"`
+}
+
+type crawlRules struct {
+	sameDomain bool
+	hosts      map[string]struct{}
+	include    []*regexp.Regexp
+	exclude    []*regexp.Regexp
+}
+
+// Bounded breadth-first crawl.
+// Required payload:
+//
+//	urls_json: JSON array of seed URLs (a single URL string is accepted too)
+//
+// Optional payload:
+//
+//	max_depth:    link hops from the seeds (default 2; pagination does not count)
+//	max_pages:    total pages fetched, > 0 (default 50, capped at 1000)
+//	same_domain:  only follow links on the seeds' hosts (default true)
+//	include:      regex or array of regexes; links must match one
+//	exclude:      regex or array of regexes; links matching any are skipped
+//	follow_next:  follow detected "next page" links (default true)
+//	concurrency:  parallel fetches per level (default 4; per-host limits still apply)
+//	cache:        as for web.request
+//
+// Output:
+//
+//	{ "pages_json": "<[{url,status_code,content,depth}]>", "urls_json": "<[url]>" }
+func handleCrawl(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	seedsRaw, err := utils.GetStringPayload(payload, "urls_json")
+	if err != nil {
+		return nil, err
+	}
+	var seeds []string
+	if strings.HasPrefix(strings.TrimSpace(seedsRaw), "[") {
+		if err := json.Unmarshal([]byte(seedsRaw), &seeds); err != nil {
+			return nil, fmt.Errorf("urls_json must be JSON array of strings: %w", err)
+		}
+	} else if strings.TrimSpace(seedsRaw) != "" {
+		seeds = []string{strings.TrimSpace(seedsRaw)}
+	}
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("web.crawl: no seed URLs")
+	}
+
+	maxDepth := intOr(payload, "max_depth", crawlDefaultDepth)
+	maxPages := intOr(payload, "max_pages", crawlDefaultPages)
+	if maxPages <= 0 {
+		return nil, fmt.Errorf("web.crawl: max_pages must be a positive integer")
+	}
+	maxPages = min(maxPages, crawlMaxPages)
+	conc := intOr(payload, "concurrency", crawlDefaultConcurrency)
+	if conc <= 0 {
+		conc = crawlDefaultConcurrency
+	}
+	followNext := boolOr(payload, "follow_next", true)
+	cacheMode, err := cacheModeOf(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := crawlRules{sameDomain: boolOr(payload, "same_domain", true), hosts: map[string]struct{}{}}
+	if rules.include, err = compilePatterns(payload["include"]); err != nil {
+		return nil, fmt.Errorf("web.crawl: include: %w", err)
+	}
+	if rules.exclude, err = compilePatterns(payload["exclude"]); err != nil {
+		return nil, fmt.Errorf("web.crawl: exclude: %w", err)
+	}
+
+	type queued struct {
+		url   string
+		depth int
+	}
+	seen := map[string]struct{}{}
+	var frontier []queued
+	for _, s := range seeds {
+		n, ok := normalizeURL(s)
+		if !ok {
+			continue
+		}
+		if u, err := neturl.Parse(n); err == nil {
+			rules.hosts[strings.TrimPrefix(u.Hostname(), "www.")] = struct{}{}
+		}
+		if _, dup := seen[n]; dup {
+			continue
+		}
+		seen[n] = struct{}{}
+		frontier = append(frontier, queued{url: n, depth: 0})
+	}
+
+	pages := make([]crawlPage, 0, maxPages)
+	for len(frontier) > 0 && len(pages) < maxPages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if room := maxPages - len(pages); len(frontier) > room {
+			frontier = frontier[:room]
+		}
+
+		// Fetch this level concurrently, keep frontier order in the output
+		level := make([]crawlPage, len(frontier))
+		links := make([][]crawlLink, len(frontier))
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, conc)
+		for i, q := range frontier {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, q queued) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				r, err := doRequest(ctx, q.url, requestOptions{Cache: cacheMode})
+				if err != nil {
+					level[i] = crawlPage{URL: q.url, Depth: q.depth, Content: fmt.Sprintf("ERROR: %v", err)}
+					return
+				}
+				level[i] = crawlPage{URL: q.url, StatusCode: r.StatusCode, Content: r.Content, Depth: q.depth, FromCache: r.FromCache}
+				if r.StatusCode < 400 && isHTML(r.Headers) {
+					base := r.FinalURL
+					if base == "" {
+						base = q.url
+					}
+					links[i] = extractCrawlLinks(r.Content, base)
+				}
+			}(i, q)
+		}
+		wg.Wait()
+		pages = append(pages, level...)
+
+		var next []queued
+		for i, q := range frontier {
+			for _, l := range links[i] {
+				isNext := followNext && l.next
+				depth := q.depth + 1
+				if isNext {
+					depth = q.depth // Pagination stays on the same level
+				} else if depth > maxDepth {
+					continue
+				}
+				n, ok := normalizeURL(l.url)
+				if !ok || !rules.allows(n, isNext) {
+					continue
+				}
+				if _, dup := seen[n]; dup {
+					continue
+				}
+				seen[n] = struct{}{}
+				next = append(next, queued{url: n, depth: depth})
+			}
+		}
+		frontier = next
+	}
+
+	urls := make([]string, 0, len(pages))
+	for _, p := range pages {
+		urls = append(urls, p.URL)
+	}
+	bp, _ := json.Marshal(pages)
+	bu, _ := json.Marshal(urls)
+	return map[string]any{"pages_json": string(bp), "urls_json": string(bu)}, nil
+}
+
+type crawlLink struct {
+	url  string
+	next bool
+}
+
+var nextTexts = map[string]struct{}{
+	"next": {}, "next page": {}, "next »": {}, "next ›": {}, "»": {}, "›": {}, ">": {}, ">>": {},
+	"tiếp": {}, "tiếp theo": {}, "trang sau": {}, "older posts": {},
+}
+
+// All <a href> targets on the page, flagging likely "next page" links.
+func extractCrawlLinks(html, base string) []crawlLink {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil
+	}
+	if b, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		base = utils.Absolute(base, b)
+	}
+	var out []crawlLink
+	doc.Find(`link[rel~="next"][href]`).Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		out = append(out, crawlLink{url: utils.Absolute(base, href), next: true})
+	})
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		out = append(out, crawlLink{url: utils.Absolute(base, href), next: isNextLink(s)})
+	})
+	return out
+}
+
+// NextPageURL finds the "next page" link of an HTML page: the first match of
+// selector when one is given, otherwise a rel=next / "Next" style link as
+// detected by web.crawl. Returns "" when there is none.
+func NextPageURL(html, base, selector string) string {
+	if selector == "" {
+		for _, l := range extractCrawlLinks(html, base) {
+			if l.next && l.url != "" {
+				return l.url
+			}
+		}
+		return ""
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return ""
+	}
+	if b, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		base = utils.Absolute(base, b)
+	}
+	href, ok := doc.Find(selector).First().Attr("href")
+	if !ok || strings.TrimSpace(href) == "" {
+		return ""
+	}
+	return utils.Absolute(base, strings.TrimSpace(href))
+}
+
+func isNextLink(s *goquery.Selection) bool {
+	if rel, _ := s.Attr("rel"); hasToken(rel, "next") {
+		return true
+	}
+	for _, attr := range []string{"class", "aria-label", "title"} {
+		v, _ := s.Attr(attr)
+		v = strings.ToLower(v)
+		if hasToken(v, "next") || strings.Contains(v, "next page") || strings.Contains(v, "pagination-next") {
+			return true
+		}
+	}
+	if p := s.Parent(); p.Length() > 0 {
+		if cls, _ := p.Attr("class"); hasToken(strings.ToLower(cls), "next") {
+			return true
+		}
+	}
+	_, ok := nextTexts[strings.ToLower(strings.Join(strings.Fields(s.Text()), " "))]
+	return ok
+}
+
+func hasToken(list, tok string) bool {
+	for _, f := range strings.Fields(strings.ToLower(list)) {
+		if f == tok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *crawlRules) allows(u string, isNext bool) bool {
+	pu, err := neturl.Parse(u)
+	if err != nil {
+		return false
+	}
+	if r.sameDomain {
+		if _, ok := r.hosts[strings.TrimPrefix(pu.Hostname(), "www.")]; !ok {
+			return false
+		}
+	}
+	for _, re := range r.exclude {
+		if re.MatchString(u) {
+			return false
+		}
+	}
+	if len(r.include) == 0 || isNext {
+		return true
+	}
+	for _, re := range r.include {
+		if re.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// Canonical form used for dedup: lowercase scheme/host, no default port,
+// no fragment, sorted query, no trailing slash (except root).
+func normalizeURL(raw string) (string, bool) {
+	u, err := neturl.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", false
+	}
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	} else if len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = ""
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		keys := make([]string, 0, len(q))
+		for k := range q {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		vals := neturl.Values{}
+		for _, k := range keys {
+			vals[k] = q[k]
+		}
+		u.RawQuery = vals.Encode()
+	}
+	return u.String(), true
+}
+
+func isHTML(h map[string]string) bool {
+	ct := strings.ToLower(headerValue(h, "Content-Type"))
+	return ct == "" || strings.Contains(ct, "html")
+}
+
+// Accepts a regex string, a JSON array string or a []any of strings.
+func compilePatterns(v any) ([]*regexp.Regexp, error) {
+	var pats []string
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if strings.TrimSpace(t) == "" {
+			return nil, nil
+		}
+		if strings.HasPrefix(strings.TrimSpace(t), "[") && json.Unmarshal([]byte(t), &pats) == nil {
+			break
+		}
+		pats = []string{t}
+	case []any:
+		for _, p := range t {
+			if s, ok := p.(string); ok {
+				pats = append(pats, s)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("expected regex string or array, got %T", v)
+	}
+	out := make([]*regexp.Regexp, 0, len(pats))
+	for _, p := range pats {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", p, err)
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+func intOr(payload map[string]any, key string, def int) int {
+	if _, ok := payload[key]; !ok {
+		return def
+	}
+	i, err := utils.GetIntPayload(payload, key)
+	if err != nil {
+		return def
+	}
+	return i
+}
+
+func boolOr(payload map[string]any, key string, def bool) bool {
+	switch t := payload[key].(type) {
+	case bool:
+		return t
+	case string:
+		switch strings.ToLower(strings.TrimSpace(t)) {
+		case "true", "yes", "1":
+			return true
+		case "false", "no", "0":
+			return false
+		}
+	}
+	return def
+}
@@ -0,0 +1,210 @@
+package web
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"a-a/internal/logger"
+	"a-a/internal/utils"
+)
+
+const (
+	downloadChunkBytes    = 32 << 10 // 32KB
+	downloadProgressEvery = 5 * time.Second
+)
+
+// Streams a URL to disk instead of buffering it in memory.
+// Required payload:
+//
+//	url:  source URL
+//	path: destination file path
+//
+// Optional payload:
+//
+//	headers: extra request headers
+//	session: cookie jar name shared with web.request
+//	sha256:  expected hex digest; the download fails (and the file is discarded) on mismatch
+//	resume:  resume from "<path>.part" via HTTP Range (default true)
+//
+// Output:
+//
+//	{ "path": string, "bytes": int64, "content_type": string, "sha256": string }
+func handleDownload(ctx context.Context, payload map[string]any) (map[string]any, error) {
+	url, err := utils.GetStringPayload(payload, "url")
+	if err != nil {
+		return nil, err
+	}
+	path, err := utils.GetStringPayload(payload, "path")
+	if err != nil {
+		return nil, err
+	}
+	expected, _ := payload["sha256"].(string)
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	resume := true
+	if v, ok := payload["resume"].(bool); ok {
+		resume = v
+	}
+	hdrs := stringMap(payload["headers"])
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("download: create dir: %w", err)
+		}
+	}
+	partPath := path + ".part"
+
+	var offset int64
+	if resume {
+		if fi, err := os.Stat(partPath); err == nil {
+			offset = fi.Size()
+		}
+	} else {
+		_ = os.Remove(partPath)
+	}
+
+	session, _ := payload["session"].(string)
+	var resp *http.Response
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("download: new request: %w", err)
+		}
+		for k, v := range hdrs {
+			req.Header.Set(k, v)
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		resp, err = clientForSession(ctx, session).Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("download: do request: %w", err)
+		}
+		if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable || offset == 0 {
+			break
+		}
+		resp.Body.Close()
+		// The partial file only holds the whole body when its size is the
+		// remote length; otherwise it is stale or corrupt -> start over
+		if total, ok := unsatisfiedRangeTotal(resp.Header.Get("Content-Range")); ok && total == offset {
+			return finishDownload(partPath, path, resp.Header.Get("Content-Type"), expected)
+		}
+		logger.Log.Printf("[web.download] %s: %s (%d bytes) does not match the remote file, restarting", url, partPath, offset)
+		offset = 0
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags |= os.O_APPEND
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		// Server ignored the Range header (or there was nothing to resume) -> start over
+		flags |= os.O_TRUNC
+		offset = 0
+	default:
+		return nil, fmt.Errorf("download: unexpected status %d", resp.StatusCode)
+	}
+
+	f, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("download: open partial file: %w", err)
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	written, copyErr := copyWithProgress(ctx, f, resp.Body, url, offset, total)
+	closeErr := f.Close()
+	if copyErr != nil {
+		// Keep the partial file so a retry can resume
+		return nil, fmt.Errorf("download: after %d bytes: %w", offset+written, copyErr)
+	}
+	if closeErr != nil {
+		return nil, fmt.Errorf("download: close: %w", closeErr)
+	}
+	if total >= 0 && offset+written != total {
+		return nil, fmt.Errorf("download: short body (%d of %d bytes)", offset+written, total)
+	}
+
+	return finishDownload(partPath, path, resp.Header.Get("Content-Type"), expected)
+}
+
+func copyWithProgress(ctx context.Context, dst io.Writer, src io.Reader, url string, offset, total int64) (int64, error) {
+	buf := make([]byte, downloadChunkBytes)
+	var written int64
+	lastReport := time.Now()
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		n, rerr := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return written, werr
+			}
+			written += int64(n)
+		}
+		if time.Since(lastReport) >= downloadProgressEvery {
+			lastReport = time.Now()
+			if total > 0 {
+				logger.Log.Printf("[web.download] %s: %d/%d bytes (%.1f%%)", url, offset+written, total, float64(offset+written)*100/float64(total))
+			} else {
+				logger.Log.Printf("[web.download] %s: %d bytes", url, offset+written)
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
+// Total length from a 416's "Content-Range: bytes */<total>".
+func unsatisfiedRangeTotal(v string) (int64, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(v), "bytes */")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(rest), 10, 64)
+	return n, err == nil && n >= 0
+}
+
+// Hash the completed partial file, verify it and move it into place.
+func finishDownload(partPath, path, contentType, expected string) (map[string]any, error) {
+	f, err := os.Open(partPath)
+	if err != nil {
+		return nil, fmt.Errorf("download: reopen partial file: %w", err)
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("download: hash: %w", err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if expected != "" && sum != expected {
+		_ = os.Remove(partPath)
+		return nil, fmt.Errorf("download: sha256 mismatch (expected %s, got %s)", expected, sum)
+	}
+	if err := os.Rename(partPath, path); err != nil {
+		return nil, fmt.Errorf("download: rename: %w", err)
+	}
+	return map[string]any{
+		"path":         path,
+		"bytes":        n,
+		"content_type": contentType,
+		"sha256":       sum,
+	}, nil
+}
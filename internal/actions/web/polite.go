@@ -0,0 +1,265 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings shared by every web.* action (and flow.foreach over them).
+type Config struct {
+	UserAgent       string  // Default User-Agent when a request does not set one
+	RespectRobots   bool    // Enforce robots.txt
+	HostRPS         float64 // Per-host sustained requests/second (<= 0 disables)
+	HostBurst       int     // Per-host token bucket size
+	HostMaxInFlight int     // Per-host concurrent requests (<= 0 disables)
+	MaxRetryAfter   time.Duration
+	CacheDir        string // On-disk HTTP cache for web.request/batch_request ("" disables)
+}
+
+const defaultUserAgent = "a-a-assistant/0.1"
+
+var (
+	cfgMu sync.RWMutex
+	cfg   = Config{
+		UserAgent:       defaultUserAgent,
+		RespectRobots:   true,
+		HostRPS:         2,
+		HostBurst:       4,
+		HostMaxInFlight: 4,
+		MaxRetryAfter:   60 * time.Second,
+	}
+)
+
+// ErrRobotsDisallowed is returned for URLs excluded by the host's robots.txt.
+var ErrRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+const retryAfterAttempts = 2
+
+// Configure replaces the politeness settings. Zero values keep the defaults
+// for UserAgent and MaxRetryAfter.
+func Configure(c Config) {
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+	if strings.TrimSpace(c.UserAgent) == "" {
+		c.UserAgent = defaultUserAgent
+	}
+	if c.MaxRetryAfter <= 0 {
+		c.MaxRetryAfter = 60 * time.Second
+	}
+	if c.HostBurst <= 0 {
+		c.HostBurst = 1
+	}
+	cfg = c
+
+	hostsMu.Lock()
+	hosts = map[string]*hostState{}
+	hostsMu.Unlock()
+}
+
+func currentConfig() Config {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	return cfg
+}
+
+// Per-host limiter state: token bucket, in-flight semaphore and a
+// "not before" instant set by Retry-After / Crawl-delay.
+type hostState struct {
+	mu        sync.Mutex
+	tokens    float64
+	last      time.Time
+	notBefore time.Time
+	interval  time.Duration // Minimum spacing from robots Crawl-delay
+	lastStart time.Time
+	sem       chan struct{}
+}
+
+var (
+	hostsMu sync.Mutex
+	hosts   = map[string]*hostState{}
+)
+
+func hostFor(host string, c Config) *hostState {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	h, ok := hosts[host]
+	if !ok {
+		h = &hostState{tokens: float64(c.HostBurst), last: time.Now()}
+		if c.HostMaxInFlight > 0 {
+			h.sem = make(chan struct{}, c.HostMaxInFlight)
+		}
+		hosts[host] = h
+	}
+	return h
+}
+
+// Blocks until the host allows another request to start.
+func (h *hostState) wait(ctx context.Context, c Config) error {
+	for {
+		h.mu.Lock()
+		now := time.Now()
+		var delay time.Duration
+		if now.Before(h.notBefore) {
+			delay = h.notBefore.Sub(now)
+		} else if h.interval > 0 && now.Sub(h.lastStart) < h.interval {
+			delay = h.interval - now.Sub(h.lastStart)
+		} else if c.HostRPS > 0 {
+			h.tokens += now.Sub(h.last).Seconds() * c.HostRPS
+			if h.tokens > float64(c.HostBurst) {
+				h.tokens = float64(c.HostBurst)
+			}
+			h.last = now
+			if h.tokens < 1 {
+				delay = time.Duration((1 - h.tokens) / c.HostRPS * float64(time.Second))
+			} else {
+				h.tokens--
+			}
+		}
+		if delay == 0 {
+			h.lastStart = now
+			h.mu.Unlock()
+			return nil
+		}
+		h.mu.Unlock()
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (h *hostState) pushBack(until time.Time) {
+	h.mu.Lock()
+	if until.After(h.notBefore) {
+		h.notBefore = until
+	}
+	h.mu.Unlock()
+}
+
+// politeTransport wraps the base transport so every request, whichever
+// action issued it, goes through robots.txt, rate limits and Retry-After.
+type politeTransport struct {
+	base http.RoundTripper
+}
+
+func (t *politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := currentConfig()
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	if c.RespectRobots && req.URL.Path != "/robots.txt" {
+		rules := robotsFor(req.Context(), t.base, req.URL, c.UserAgent)
+		if !rules.allowed(req.URL) {
+			return nil, ErrRobotsDisallowed
+		}
+	}
+
+	h := hostFor(req.URL.Host, c)
+	for attempt := 0; ; attempt++ {
+		if err := h.wait(req.Context(), c); err != nil {
+			return nil, err
+		}
+		if h.sem != nil {
+			select {
+			case h.sem <- struct{}{}:
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			h.release()
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				if d > c.MaxRetryAfter {
+					d = c.MaxRetryAfter
+				}
+				h.pushBack(time.Now().Add(d))
+				if attempt < retryAfterAttempts && rewindable(req) {
+					io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+					resp.Body.Close()
+					h.release()
+					if req, err = rewind(req); err != nil {
+						return nil, err
+					}
+					continue
+				}
+			}
+		}
+
+		// Hold the in-flight slot until the caller finishes reading the body
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: h.release}
+		return resp, nil
+	}
+}
+
+func (h *hostState) release() {
+	if h.sem != nil {
+		<-h.sem
+	}
+}
+
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("rewind request body: %w", err)
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
+
+// Retry-After is either delay-seconds or an HTTP date.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,242 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	robotsTTL      = 1 * time.Hour
+	robotsMaxBytes = 512 << 10 // 512KB
+	robotsTimeout  = 10 * time.Second
+)
+
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+type robotsRules struct {
+	rules       []robotsRule
+	crawlDelay  time.Duration
+	disallowAll bool
+	fetched     time.Time
+}
+
+var (
+	robotsMu    sync.Mutex
+	robotsCache = map[string]*robotsRules{}
+	robotsGroup singleflight.Group // One fetch per origin at a time
+)
+
+// Returns the (cached) rules that apply to our User-Agent for u's origin.
+// Fetch errors and 4xx mean "allow everything"; 5xx means "disallow" as
+// recommended by RFC 9309. The fetch does not depend on ctx, so a cancelled
+// caller cannot leave the origin unprotected for robotsTTL.
+func robotsFor(ctx context.Context, base http.RoundTripper, u *neturl.URL, ua string) *robotsRules {
+	origin := u.Scheme + "://" + u.Host
+
+	robotsMu.Lock()
+	r, ok := robotsCache[origin]
+	robotsMu.Unlock()
+	if ok && time.Since(r.fetched) < robotsTTL {
+		return r
+	}
+
+	ch := robotsGroup.DoChan(origin, func() (any, error) {
+		fr, ok := fetchRobots(context.WithoutCancel(ctx), base, origin, ua)
+		if ok {
+			robotsMu.Lock()
+			robotsCache[origin] = fr
+			robotsMu.Unlock()
+		}
+		return fr, nil
+	})
+	select {
+	case res := <-ch:
+		r = res.Val.(*robotsRules)
+	case <-ctx.Done():
+		return &robotsRules{} // the request fails on ctx anyway
+	}
+
+	if r.crawlDelay > 0 {
+		h := hostFor(u.Host, currentConfig())
+		h.mu.Lock()
+		h.interval = r.crawlDelay
+		h.mu.Unlock()
+	}
+	return r
+}
+
+// Reports false when the result must not be cached: the fetch timed out, so
+// the next request tries again.
+func fetchRobots(ctx context.Context, base http.RoundTripper, origin, ua string) (*robotsRules, bool) {
+	empty := &robotsRules{fetched: time.Now()}
+
+	rctx, cancel := context.WithTimeout(ctx, robotsTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(rctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return empty, true
+	}
+	req.Header.Set("User-Agent", ua)
+	client := &http.Client{Transport: base}
+	resp, err := client.Do(req)
+	if err != nil {
+		return empty, rctx.Err() == nil
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return &robotsRules{disallowAll: true, fetched: time.Now()}, true
+	case resp.StatusCode != http.StatusOK:
+		return empty, true
+	}
+	r := parseRobots(io.LimitReader(resp.Body, robotsMaxBytes), productToken(ua))
+	return r, rctx.Err() == nil
+}
+
+// "a-a-assistant/0.1 (...)" -> "a-a-assistant"
+func productToken(ua string) string {
+	tok := strings.Fields(ua)
+	if len(tok) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.SplitN(tok[0], "/", 2)[0])
+}
+
+// Picks the group whose user-agent best matches token, falling back to "*".
+func parseRobots(r io.Reader, token string) *robotsRules {
+	type group struct {
+		agents []string
+		rules  []robotsRule
+		delay  time.Duration
+	}
+	var groups []*group
+	var cur *group
+	inAgents := false
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.TrimSpace(val)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				cur = &group{}
+				groups = append(groups, cur)
+			}
+			cur.agents = append(cur.agents, strings.ToLower(val))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			if cur == nil || (key == "disallow" && val == "") {
+				continue
+			}
+			cur.rules = append(cur.rules, robotsRule{pattern: val, allow: key == "allow"})
+		case "crawl-delay":
+			inAgents = false
+			if cur == nil {
+				continue
+			}
+			if f, err := strconv.ParseFloat(val, 64); err == nil && f > 0 {
+				cur.delay = time.Duration(f * float64(time.Second))
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	var best, star *group
+	bestLen := 0
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if a == "*" {
+				if star == nil {
+					star = g
+				}
+				continue
+			}
+			if token != "" && strings.Contains(token, a) && len(a) > bestLen {
+				best, bestLen = g, len(a)
+			}
+		}
+	}
+	if best == nil {
+		best = star
+	}
+	out := &robotsRules{fetched: time.Now()}
+	if best != nil {
+		out.rules = best.rules
+		out.crawlDelay = best.delay
+	}
+	return out
+}
+
+// Longest matching pattern wins; Allow wins ties.
+func (r *robotsRules) allowed(u *neturl.URL) bool {
+	if r.disallowAll {
+		return false
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	allow, bestLen := true, -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		n := len(rule.pattern)
+		if n > bestLen || (n == bestLen && rule.allow) {
+			allow, bestLen = rule.allow, n
+		}
+	}
+	return allow
+}
+
+// Prefix match supporting '*' (any run) and a trailing '$' (end anchor).
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if i == len(parts)-1 && anchored {
+			return strings.HasSuffix(path[pos:], parts[i])
+		}
+		j := strings.Index(path[pos:], parts[i])
+		if j < 0 {
+			return false
+		}
+		pos += j + len(parts[i])
+	}
+	return !anchored || pos == len(path)
+}
@@ -0,0 +1,277 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/", "/anything", true},
+		{"/private", "/private", true},
+		{"/private", "/private/x", true},
+		{"/private", "/privateer", true}, // plain prefix
+		{"/private", "/public", false},
+		{"/private/", "/private", false},
+		{"/*.pdf", "/docs/a.pdf", true},
+		{"/*.pdf", "/docs/a.pdf?x=1", true},
+		{"/*.pdf$", "/docs/a.pdf", true},
+		{"/*.pdf$", "/docs/a.pdf?x=1", false},
+		{"/*.pdf$", "/a.pdf.html", false},
+		{"/a*b*c", "/a-x-b-y-c-z", true},
+		{"/a*b*c", "/a-x-c-y-b", false},
+		{"/exact$", "/exact", true},
+		{"/exact$", "/exact/", false},
+		{"*", "/x", true},
+		{"/*?session=", "/page?session=1", true},
+	}
+	for _, tc := range tests {
+		if got := robotsMatch(tc.pattern, tc.path); got != tc.want {
+			t.Errorf("robotsMatch(%q, %q) = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestRobotsAllowed(t *testing.T) {
+	const robots = `
+# comments are ignored
+User-agent: *
+Disallow: /private
+Allow: /private/open
+Disallow: /*.pdf$
+Allow: /page
+Disallow: /page
+Disallow: /search?
+Disallow:
+
+User-agent: other-bot
+Disallow: /
+`
+	r := parseRobots(strings.NewReader(robots), "a-a-assistant")
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://x.test/", true},
+		{"https://x.test", true},
+		{"https://x.test/private", false},
+		{"https://x.test/private/secret", false},
+		{"https://x.test/private/open", true},      // longer Allow beats shorter Disallow
+		{"https://x.test/private/open/deep", true}, // prefix of the Allow
+		{"https://x.test/files/report.pdf", false},
+		{"https://x.test/files/report.pdf?dl=1", true}, // "$" anchors at the end
+		{"https://x.test/page", true},                  // Allow wins a tie
+		{"https://x.test/search?q=1", false},           // query is part of the path
+		{"https://x.test/search", true},
+	}
+	for _, tc := range tests {
+		u, _ := neturl.Parse(tc.url)
+		if got := r.allowed(u); got != tc.want {
+			t.Errorf("allowed(%s) = %v, want %v", tc.url, got, tc.want)
+		}
+	}
+}
+
+func TestParseRobotsGroups(t *testing.T) {
+	const robots = `
+User-agent: *
+Disallow: /star
+
+User-agent: a-a
+User-agent: a-a-assistant
+Disallow: /ours
+Crawl-delay: 1.5
+
+user-agent: a
+disallow: /short
+`
+	tests := []struct {
+		token     string
+		wantPath  string
+		wantDelay time.Duration
+	}{
+		{"a-a-assistant", "/ours", 1500 * time.Millisecond}, // longest agent match
+		{"somebot", "/star", 0},                             // falls back to "*"
+		{"", "/star", 0},
+	}
+	for _, tc := range tests {
+		r := parseRobots(strings.NewReader(robots), tc.token)
+		if len(r.rules) != 1 || r.rules[0].pattern != tc.wantPath || r.crawlDelay != tc.wantDelay {
+			t.Errorf("token %q: rules %+v, delay %v", tc.token, r.rules, r.crawlDelay)
+		}
+	}
+
+	if r := parseRobots(strings.NewReader("Disallow: /orphan\n"), "x"); len(r.rules) != 0 {
+		t.Errorf("rules outside a group: %+v", r.rules)
+	}
+	if got := productToken("A-A-Assistant/0.1 (+https://x.test)"); got != "a-a-assistant" {
+		t.Errorf("productToken = %q", got)
+	}
+}
+
+// Installs c for the duration of the test.
+func withConfig(t *testing.T, c Config) {
+	t.Helper()
+	old := currentConfig()
+	Configure(c)
+	t.Cleanup(func() { Configure(old) })
+}
+
+func politeGet(t *testing.T, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&politeTransport{base: http.DefaultTransport}).RoundTrip(req)
+	if err == nil {
+		t.Cleanup(func() { resp.Body.Close() })
+	}
+	return resp, err
+}
+
+func TestPoliteTransportRobots(t *testing.T) {
+	withConfig(t, Config{RespectRobots: true})
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nDisallow: /admin\n")
+			return
+		}
+		hits.Add(1)
+	}))
+	defer srv.Close()
+
+	if _, err := politeGet(t, srv.URL+"/admin/users"); !errors.Is(err, ErrRobotsDisallowed) {
+		t.Fatalf("disallowed path: err = %v", err)
+	}
+	if _, err := politeGet(t, srv.URL+"/public"); err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("server saw %d requests, want 1", hits.Load())
+	}
+
+	// A 5xx robots.txt disallows the whole origin
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer down.Close()
+	if _, err := politeGet(t, down.URL+"/"); !errors.Is(err, ErrRobotsDisallowed) {
+		t.Fatalf("5xx robots.txt: err = %v", err)
+	}
+}
+
+func TestPoliteTransportRetryAfter(t *testing.T) {
+	withConfig(t, Config{MaxRetryAfter: 200 * time.Millisecond})
+
+	tests := []struct {
+		name       string
+		failures   int32  // 429s before a 200
+		retryAfter string // header on the 429s
+		wantStatus int
+		wantCalls  int32
+		minElapsed time.Duration
+	}{
+		{"retried after the delay", 1, "1", http.StatusOK, 2, 200 * time.Millisecond},
+		{"delay capped by MaxRetryAfter", 2, "3600", http.StatusOK, 3, 400 * time.Millisecond},
+		{"gives up after the retry budget", 10, "0", http.StatusTooManyRequests, retryAfterAttempts + 1, 0},
+		{"no header is returned as is", 1, "", http.StatusTooManyRequests, 1, 0},
+		{"unparsable header is returned as is", 1, "soon", http.StatusTooManyRequests, 1, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tc.failures {
+					if tc.retryAfter != "" {
+						w.Header().Set("Retry-After", tc.retryAfter)
+					}
+					w.WriteHeader(http.StatusTooManyRequests)
+				}
+			}))
+			defer srv.Close()
+
+			start := time.Now()
+			resp, err := politeGet(t, srv.URL+"/x")
+			if err != nil {
+				t.Fatal(err)
+			}
+			elapsed := time.Since(start)
+			if resp.StatusCode != tc.wantStatus || calls.Load() != tc.wantCalls {
+				t.Fatalf("status %d after %d calls, want %d after %d", resp.StatusCode, calls.Load(), tc.wantStatus, tc.wantCalls)
+			}
+			if elapsed < tc.minElapsed {
+				t.Fatalf("took %v, want at least %v", elapsed, tc.minElapsed)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d, ok := parseRetryAfter("120"); !ok || d != 2*time.Minute {
+		t.Errorf("seconds: %v %v", d, ok)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if d, ok := parseRetryAfter(date); !ok || d < 59*time.Minute || d > time.Hour {
+		t.Errorf("HTTP date: %v %v", d, ok)
+	}
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	if d, ok := parseRetryAfter(past); !ok || d != 0 {
+		t.Errorf("past date: %v %v", d, ok)
+	}
+	for _, v := range []string{"", "-1", "later"} {
+		if _, ok := parseRetryAfter(v); ok {
+			t.Errorf("parseRetryAfter(%q) accepted", v)
+		}
+	}
+}
+
+func TestHostTokenBucket(t *testing.T) {
+	c := Config{HostRPS: 20, HostBurst: 2}
+	h := &hostState{tokens: float64(c.HostBurst), last: time.Now()}
+	ctx := context.Background()
+
+	// The burst goes through at once
+	start := time.Now()
+	for range 2 {
+		if err := h.wait(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > 30*time.Millisecond {
+		t.Fatalf("burst took %v", d)
+	}
+
+	// Then one request per 1/HostRPS
+	start = time.Now()
+	for range 2 {
+		if err := h.wait(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Fatalf("two requests over the burst took %v, want about 100ms", d)
+	}
+
+	// Waiting gives up with the context
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	h.pushBack(time.Now().Add(time.Hour))
+	if err := h.wait(cctx, c); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+}
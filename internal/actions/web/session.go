@@ -0,0 +1,149 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"a-a/internal/utils"
+)
+
+// Named cookie jars, scoped per mission: "<mission_id>/<session>".
+var (
+	sessionsMu sync.Mutex
+	sessions   = map[string]*http.Client{}
+)
+
+// Returns a client sharing the default transport but with a persistent
+// cookie jar for the given session name. Empty name -> default client.
+func clientForSession(ctx context.Context, name string) *http.Client {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return httpClient
+	}
+	key := utils.MissionIDFromContext(ctx) + "/" + name
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if c, ok := sessions[key]; ok {
+		return c
+	}
+	jar, _ := cookiejar.New(nil)
+	c := &http.Client{Transport: httpClient.Transport, Jar: jar}
+	sessions[key] = c
+	return c
+}
+
+// ReleaseSessions drops all cookie jars created under the given mission.
+func ReleaseSessions(missionID string) {
+	prefix := missionID + "/"
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	for k := range sessions {
+		if strings.HasPrefix(k, prefix) {
+			delete(sessions, k)
+		}
+	}
+}
+
+// Builds the request body from the first of: files/form (multipart or
+// urlencoded), json, body. Returns a nil reader when none is set.
+func buildRequestBody(payload map[string]any) (io.Reader, string, error) {
+	form := stringMap(payload["form"])
+	files := stringMap(payload["files"])
+
+	if len(files) > 0 {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, k := range sortedKeys(form) {
+			if err := mw.WriteField(k, form[k]); err != nil {
+				return nil, "", fmt.Errorf("multipart field %q: %w", k, err)
+			}
+		}
+		for _, k := range sortedKeys(files) {
+			path := files[k]
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, "", fmt.Errorf("multipart file %q: %w", k, err)
+			}
+			part, err := mw.CreateFormFile(k, filepath.Base(path))
+			if err == nil {
+				_, err = io.Copy(part, f)
+			}
+			f.Close()
+			if err != nil {
+				return nil, "", fmt.Errorf("multipart file %q: %w", k, err)
+			}
+		}
+		if err := mw.Close(); err != nil {
+			return nil, "", fmt.Errorf("multipart close: %w", err)
+		}
+		return &buf, mw.FormDataContentType(), nil
+	}
+
+	if len(form) > 0 {
+		vals := neturl.Values{}
+		for k, v := range form {
+			vals.Set(k, v)
+		}
+		return strings.NewReader(vals.Encode()), "application/x-www-form-urlencoded", nil
+	}
+
+	if v, ok := payload["json"]; ok && v != nil {
+		// A string is taken as already-encoded JSON (e.g. from @results)
+		if s, ok := v.(string); ok {
+			if !json.Valid([]byte(s)) {
+				return nil, "", fmt.Errorf("json payload is not valid JSON")
+			}
+			return strings.NewReader(s), "application/json", nil
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, "", fmt.Errorf("encode json payload: %w", err)
+		}
+		return bytes.NewReader(b), "application/json", nil
+	}
+
+	if s, ok := payload["body"].(string); ok && s != "" {
+		return strings.NewReader(s), "", nil
+	}
+	return nil, "", nil
+}
+
+func stringMap(v any) map[string]string {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, val := range m {
+		switch t := val.(type) {
+		case string:
+			out[k] = t
+		case nil:
+		default:
+			out[k] = fmt.Sprintf("%v", t)
+		}
+	}
+	return out
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,94 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"a-a/internal/utils"
+)
+
+// Reports the hosts a web action would contact and the files it would write.
+func SimulateWebAction(ctx context.Context, operation string, payload map[string]any) ([]utils.Effect, error) {
+	switch operation {
+	case "request":
+		url, err := utils.GetStringPayload(payload, "url")
+		if err != nil {
+			return nil, err
+		}
+		method, _ := payload["method"].(string)
+		if method == "" {
+			method = "GET"
+			for _, key := range []string{"body", "json", "form", "files"} {
+				if payload[key] != nil {
+					method = "POST"
+				}
+			}
+		}
+		return []utils.Effect{utils.NetworkEffect(url, strings.ToUpper(method)+" "+url)}, nil
+	case "batch_request":
+		urlsJSON, err := utils.GetStringPayload(payload, "urls_json")
+		if err != nil {
+			return nil, err
+		}
+		return hostEffects(urlsJSON, "GET"), nil
+	case "download":
+		url, err := utils.GetStringPayload(payload, "url")
+		if err != nil {
+			return nil, err
+		}
+		path, err := utils.GetStringPayload(payload, "path")
+		if err != nil {
+			return nil, err
+		}
+		return []utils.Effect{utils.NetworkEffect(url, "GET "+url), utils.FileEffect(path, false)}, nil
+	case "crawl":
+		seeds, err := utils.GetStringPayload(payload, "urls_json")
+		if err != nil {
+			return nil, err
+		}
+		maxPages := intOr(payload, "max_pages", crawlDefaultPages)
+		if maxPages <= 0 {
+			return nil, fmt.Errorf("web.crawl: max_pages must be a positive integer")
+		}
+		effects := hostEffects(seeds, "crawl")
+		scope := "any host"
+		if boolOr(payload, "same_domain", true) {
+			scope = "same host"
+		}
+		for i := range effects {
+			effects[i].Repeated = fmt.Sprintf("up to %d pages, depth %d, %s",
+				min(maxPages, crawlMaxPages), intOr(payload, "max_depth", crawlDefaultDepth), scope)
+		}
+		return effects, nil
+	default:
+		return nil, fmt.Errorf("unknown web operation: %s", operation)
+	}
+}
+
+// One effect per host of a JSON array of URLs (or a single URL).
+func hostEffects(urlsJSON, verb string) []utils.Effect {
+	var urls []string
+	if err := json.Unmarshal([]byte(urlsJSON), &urls); err != nil {
+		urls = []string{strings.TrimSpace(urlsJSON)}
+	}
+	if len(urls) == 0 {
+		return []utils.Effect{utils.NetworkEffect(urlsJSON, verb+": URLs known at run time")}
+	}
+	var effects []utils.Effect
+	index := map[string]int{}
+	counts := map[string]int{}
+	for _, u := range urls {
+		e := utils.NetworkEffect(u, "")
+		if _, seen := index[e.Target]; !seen {
+			index[e.Target] = len(effects)
+			effects = append(effects, e)
+		}
+		counts[e.Target]++
+	}
+	for host, i := range index {
+		effects[i].Detail = fmt.Sprintf("%s, %d URL(s)", verb, counts[host])
+	}
+	return effects
+}
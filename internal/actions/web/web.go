@@ -6,80 +6,186 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"a-a/internal/utils"
 )
 
-var httpClient = &http.Client{
-	Transport: &http.Transport{
-		Proxy:                 http.ProxyFromEnvironment,
-		MaxIdleConns:          100,
-		MaxIdleConnsPerHost:   10,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		ResponseHeaderTimeout: 15 * time.Second,
-	},
+// Base transport; all clients reach it through politeTransport.
+var baseTransport = &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   10,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+	ResponseHeaderTimeout: 15 * time.Second,
 }
 
+var httpClient = &http.Client{Transport: &politeTransport{base: baseTransport}}
+
 const maxBodyBytes = 5 << 20 // 5MB
 
 type httpResp struct {
-	URL        string `json:"url"`
-	StatusCode int    `json:"status_code"`
-	Content    string `json:"content"`
+	URL        string            `json:"url"`
+	StatusCode int               `json:"status_code"`
+	Content    string            `json:"content"`
+	FinalURL   string            `json:"final_url,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	FromCache  bool              `json:"from_cache"`
+}
+
+type requestOptions struct {
+	Method      string
+	Headers     map[string]string
+	Body        io.Reader
+	ContentType string
+	Client      *http.Client // nil -> httpClient
+	Cache       string       // "", CacheRevalidate, CacheForce or CacheBypass
 }
 
-func doRequest(ctx context.Context, method, url string, headers map[string]string) (*httpResp, error) {
+func doRequest(ctx context.Context, url string, opts requestOptions) (*httpResp, error) {
+	method := opts.Method
 	if method == "" {
 		method = "GET"
 	}
-	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+
+	// Only plain GETs are cacheable
+	cacheDir := currentConfig().CacheDir
+	useCache := cacheDir != "" && opts.Cache != CacheBypass && method == http.MethodGet && opts.Body == nil
+	var cached *cacheEntry
+	if useCache {
+		if e, ok := cacheLookup(cacheDir, method, url, opts.Headers); ok {
+			if opts.Cache == CacheForce {
+				r := e.toResp()
+				r.FromCache = true
+				return r, nil
+			}
+			cached = e
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, opts.Body)
 	if err != nil {
 		return nil, fmt.Errorf("new request: %w", err)
 	}
-	for k, v := range headers {
+	if opts.ContentType != "" {
+		req.Header.Set("Content-Type", opts.ContentType)
+	}
+	for k, v := range opts.Headers {
 		req.Header.Set(k, v)
 	}
+	if cached != nil {
+		if cached.ETag != "" && req.Header.Get("If-None-Match") == "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" && req.Header.Get("If-Modified-Since") == "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
 
-	resp, err := httpClient.Do(req)
+	client := opts.Client
+	if client == nil {
+		client = httpClient
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("do request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		return cacheTouch(cacheDir, method, opts.Headers, cached, flattenHeader(resp.Header)), nil
+	}
+
 	// Cap body size
 	lr := io.LimitReader(resp.Body, maxBodyBytes+1)
 	b, _ := io.ReadAll(lr)
 	if int64(len(b)) > maxBodyBytes {
 		return nil, fmt.Errorf("response too large (> %d bytes)", maxBodyBytes)
 	}
-	return &httpResp{URL: url, StatusCode: resp.StatusCode, Content: string(b)}, nil
+
+	r := &httpResp{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		Content:    string(b),
+		FinalURL:   resp.Request.URL.String(),
+		Headers:    flattenHeader(resp.Header),
+	}
+	if useCache {
+		cacheStore(cacheDir, method, opts.Headers, r)
+	}
+	return r, nil
 }
 
+func flattenHeader(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+// Get fetches url through the shared client (politeness limits and cache
+// included) for other action packages that need raw page content.
+func Get(ctx context.Context, url string) (string, int, error) {
+	r, err := doRequest(ctx, url, requestOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+	return r.Content, r.StatusCode, nil
+}
+
+// Optional payload on top of url/method/headers:
+//
+//	body:    raw request body string
+//	json:    object/array (encoded) or JSON string, sent as application/json
+//	form:    { field: value } sent urlencoded, or as multipart when files is set
+//	files:   { field: "<local path>" } multipart file parts
+//	session: name of a cookie jar persisted across actions of the same mission
+//	cache:   "revalidate" (default), "force" or "bypass"; session requests bypass unless set
 func handleRequest(ctx context.Context, payload map[string]any) (map[string]any, error) {
 	url, err := utils.GetStringPayload(payload, "url")
 	if err != nil {
 		return nil, err
 	}
 	method, _ := payload["method"].(string)
-	hdrs := map[string]string{}
-	if m, ok := payload["headers"].(map[string]any); ok {
-		for k, v := range m {
-			if sv, ok := v.(string); ok {
-				hdrs[k] = sv
-			}
-		}
+	body, contentType, err := buildRequestBody(payload)
+	if err != nil {
+		return nil, err
+	}
+	if method == "" && body != nil {
+		method = "POST"
 	}
-	r, err := doRequest(ctx, method, url, hdrs)
+	session, _ := payload["session"].(string)
+	cacheMode, err := cacheModeOf(payload)
 	if err != nil {
 		return nil, err
 	}
+	if cacheMode == "" && strings.TrimSpace(session) != "" {
+		cacheMode = CacheBypass // Cookies are invisible to the cache key
+	}
+
+	r, err := doRequest(ctx, url, requestOptions{
+		Method:      method,
+		Headers:     stringMap(payload["headers"]),
+		Body:        body,
+		ContentType: contentType,
+		Client:      clientForSession(ctx, session),
+		Cache:       cacheMode,
+	})
+	if err != nil {
+		return nil, err
+	}
+	hb, _ := json.Marshal(r.Headers)
 	return map[string]any{
-		"url":         r.URL,
-		"status_code": r.StatusCode,
-		"content":     r.Content,
+		"url":          r.URL,
+		"status_code":  r.StatusCode,
+		"content":      r.Content,
+		"final_url":    r.FinalURL,
+		"headers_json": string(hb),
+		"from_cache":   r.FromCache,
 	}, nil
 }
 
@@ -92,6 +198,15 @@ func handleBatchRequest(ctx context.Context, payload map[string]any) (map[string
 	if err := json.Unmarshal([]byte(urlsJSON), &urls); err != nil {
 		return nil, fmt.Errorf("urls_json must be JSON array of strings: %w", err)
 	}
+	session, _ := payload["session"].(string)
+	client := clientForSession(ctx, session)
+	cacheMode, err := cacheModeOf(payload)
+	if err != nil {
+		return nil, err
+	}
+	if cacheMode == "" && strings.TrimSpace(session) != "" {
+		cacheMode = CacheBypass
+	}
 	conc := 5
 	if v, ok := payload["concurrency"]; ok {
 		if i, err := utils.GetIntPayload(map[string]any{"v": v}, "v"); err == nil && i > 0 {
@@ -105,11 +220,12 @@ func handleBatchRequest(ctx context.Context, payload map[string]any) (map[string
 
 	worker := func() {
 		for j := range jobs {
-			r, err := doRequest(ctx, "GET", j.u, nil)
+			r, err := doRequest(ctx, j.u, requestOptions{Client: client, Cache: cacheMode})
 			if err != nil {
 				results <- &httpResp{URL: j.u, StatusCode: 0, Content: fmt.Sprintf("ERROR: %v", err)}
 				continue
 			}
+			r.Headers = nil // Keep responses_json compact
 			results <- r
 		}
 	}
@@ -141,6 +257,10 @@ func HandleWebAction(ctx context.Context, operation string, payload map[string]a
 		return handleRequest(ctx, payload)
 	case "batch_request":
 		return handleBatchRequest(ctx, payload)
+	case "download":
+		return handleDownload(ctx, payload)
+	case "crawl":
+		return handleCrawl(ctx, payload)
 	default:
 		return nil, fmt.Errorf("unknown web operation: %s", operation)
 	}
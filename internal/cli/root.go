@@ -14,7 +14,10 @@ import (
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 
+	"a-a/internal/actions/ask"
+	"a-a/internal/actions/web"
 	"a-a/internal/display"
+	"a-a/internal/executor"
 	"a-a/internal/listener"
 	"a-a/internal/llm_client"
 	"a-a/internal/logger"
@@ -30,35 +33,37 @@ var approvalMu sync.Mutex
 var awaitingApproval bool
 var awaitingMissionID string
 
+// ask.user questions shown to the user, oldest first; the next input line
+// answers the first one (managed by the question handler and the main loop)
+var questionsMu sync.Mutex
+var pendingQuestions []supervisor.UserQuestion
+
 func updateCliHistoryFromResults(ctx context.Context, cliHistory *[]parser.ConversationTurn, mu *sync.Mutex) {
 	for {
 		select {
 		case result := <-supervisor.ResultChannel:
-			mu.Lock()
-			newTurn := parser.ConversationTurn{
-				UserGoal:      result.OriginalGoal,
-				AssistantPlan: result.FinalPlan,
-			}
-			if result.Error != "" {
-				newTurn.ExecutionError = result.Error
+			if result.ParentID == "" { // sub-missions are part of their parent's turn
+				appendCliHistory(cliHistory, mu, result)
 			}
-			*cliHistory = append(*cliHistory, newTurn)
-			if len(*cliHistory) > maxCliHistory {
-				*cliHistory = (*cliHistory)[1:]
-			}
-			mu.Unlock()
 
 			// Print mission completion without breaking current input
 			lines := []string{}
+			name := "Mission " + result.MissionID
+			if result.ParentID != "" {
+				name = fmt.Sprintf("Sub-mission %s of %s", result.MissionID, result.ParentID)
+			}
 			if result.Error != "" {
 				lbl := "FAILED"
 				lower := strings.ToLower(result.Error)
 				if strings.Contains(lower, "cancel") || strings.Contains(lower, "canceled") || strings.Contains(lower, "cancelled") {
 					lbl = "CANCELLED"
 				}
-				lines = append(lines, fmt.Sprintf("[Mission %s %s]", result.MissionID, lbl))
+				lines = append(lines, fmt.Sprintf("[%s %s]", name, lbl))
 			} else {
-				lines = append(lines, fmt.Sprintf("[Mission %s SUCCEEDED]", result.MissionID))
+				lines = append(lines, fmt.Sprintf("[%s SUCCEEDED]", name))
+			}
+			if len(result.Children) > 0 {
+				lines = append(lines, "Sub-missions: "+strings.Join(result.Children, ", "))
 			}
 			if result.Metrics != nil {
 				lines = append(lines, display.FormatMissionMetrics(result.Metrics))
@@ -71,16 +76,67 @@ func updateCliHistoryFromResults(ctx context.Context, cliHistory *[]parser.Conve
 	}
 }
 
+func appendCliHistory(cliHistory *[]parser.ConversationTurn, mu *sync.Mutex, result supervisor.MissionResult) {
+	mu.Lock()
+	newTurn := parser.ConversationTurn{
+		UserGoal:      result.OriginalGoal,
+		AssistantPlan: result.FinalPlan,
+	}
+	if result.Error != "" {
+		newTurn.ExecutionError = result.Error
+	}
+	*cliHistory = append(*cliHistory, newTurn)
+	if len(*cliHistory) > maxCliHistory {
+		*cliHistory = (*cliHistory)[1:]
+	}
+	mu.Unlock()
+}
+
 var (
 	flagLLM        string
 	flagModelName  string
 	flagOllamaHost string
+
+	flagUserAgent       string
+	flagHostRPS         float64
+	flagHostMaxInFlight int
+	flagIgnoreRobots    bool
+	flagHTTPCacheDir    string
+
+	flagAskTimeout time.Duration
 )
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&flagLLM, "llm", "gemini", "LLM backend: gemini | ollama")
 	rootCmd.PersistentFlags().StringVar(&flagModelName, "model-name", "", "Model name, e.g. gemini-2.0-flash or llama3.2")
 	rootCmd.PersistentFlags().StringVar(&flagOllamaHost, "ollama-host", "", "Ollama host URL")
+
+	rootCmd.PersistentFlags().StringVar(&flagUserAgent, "user-agent", "", "Default User-Agent for web.* requests")
+	rootCmd.PersistentFlags().Float64Var(&flagHostRPS, "host-rps", 2, "Max requests per second to a single host (0 = unlimited)")
+	rootCmd.PersistentFlags().IntVar(&flagHostMaxInFlight, "host-max-inflight", 4, "Max concurrent requests to a single host (0 = unlimited)")
+	rootCmd.PersistentFlags().BoolVar(&flagIgnoreRobots, "ignore-robots", false, "Do not enforce robots.txt for web.* requests")
+	rootCmd.PersistentFlags().StringVar(&flagHTTPCacheDir, "http-cache-dir", "", "On-disk HTTP cache for web.request/batch_request, e.g. tmp/http_cache (disabled when empty)")
+
+	rootCmd.PersistentFlags().DurationVar(&flagAskTimeout, "ask-timeout", 5*time.Minute, "How long ask.user waits for an answer when the plan sets no timeout_s")
+}
+
+// Sends input to the oldest waiting ask.user question. Questions that timed
+// out or whose mission ended are dropped; returns false when none is left so
+// the input is handled as a new goal.
+func answerPendingQuestion(input string) bool {
+	questionsMu.Lock()
+	defer questionsMu.Unlock()
+	for len(pendingQuestions) > 0 {
+		q := pendingQuestions[0]
+		pendingQuestions = pendingQuestions[1:]
+		if err := supervisor.AnswerQuestion(q.ID, input); err != nil {
+			listener.AsyncPrintln(fmt.Sprintf("[Mission %s] question expired: %s", q.MissionID, q.Prompt))
+			continue
+		}
+		listener.AsyncPrintln(fmt.Sprintf("[Answer sent to mission %s]", q.MissionID))
+		return true
+	}
+	return false
 }
 
 // Try to make a file-based plan behave as an initial/seed plan for re-planning.
@@ -135,6 +191,16 @@ var rootCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		web.Configure(web.Config{
+			UserAgent:       flagUserAgent,
+			RespectRobots:   !flagIgnoreRobots,
+			HostRPS:         flagHostRPS,
+			HostBurst:       flagHostMaxInFlight,
+			HostMaxInFlight: flagHostMaxInFlight,
+			CacheDir:        flagHTTPCacheDir,
+		})
+		ask.Configure(ask.Config{DefaultTimeout: flagAskTimeout})
+
 		supervisor.StartSupervisor()
 
 		// Application lifetime context (cancelled on SIGINT/SIGTERM)
@@ -164,7 +230,14 @@ var rootCmd = &cobra.Command{
 					_ = json.Unmarshal([]byte(prev.PlanJSON), &plan)
 					pretty := display.FormatPlan(&plan)
 
-					listener.AsyncPrintln("\n[Re-plan proposed]\n" + pretty)
+					title := "[Re-plan proposed]"
+					if prev.ParentID != "" {
+						title = fmt.Sprintf("[Plan proposed for sub-mission %s of %s]", prev.MissionID, prev.ParentID)
+					}
+					listener.AsyncPrintln("\n" + title + "\n" + pretty)
+					if prev.DryRun != "" {
+						listener.AsyncPrintln(prev.DryRun)
+					}
 
 					approvalMu.Lock()
 					awaitingApproval = true
@@ -177,6 +250,33 @@ var rootCmd = &cobra.Command{
 			}
 		}(appCtx)
 
+		// Progress of long-running actions, e.g. "[Mission 1a2b] fetch: 120/300 done, 4 failed"
+		go func(ctx context.Context) {
+			for {
+				select {
+				case p := <-supervisor.ProgressChannel:
+					listener.AsyncPrintln(display.FormatProgress(p.MissionID, p.Progress))
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(appCtx)
+
+		// ask.user questions: print and queue; answered by the main loop
+		go func(ctx context.Context) {
+			for {
+				select {
+				case q := <-supervisor.QuestionChannel:
+					questionsMu.Lock()
+					pendingQuestions = append(pendingQuestions, q)
+					questionsMu.Unlock()
+					listener.AsyncPrintln("\n" + display.FormatQuestion(q.MissionID, q.Question))
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(appCtx)
+
 		listener.AsyncPrintln("Hello! How can I help you today? (type 'exit' or press Ctrl+C to quit)")
 
 	loop:
@@ -218,6 +318,11 @@ var rootCmd = &cobra.Command{
 			}
 			approvalMu.Unlock()
 
+			// If a mission asked a question, this input is the answer to the oldest one.
+			if answerPendingQuestion(inputText) {
+				continue
+			}
+
 			// Copy LLM context safely
 			historyMutex.Lock()
 			missionHistory := make([]parser.ConversationTurn, len(cliConversationHistory))
@@ -334,6 +439,10 @@ var rootCmd = &cobra.Command{
 				// Show catalog if confirmation requested
 				if intent.RequiresConfirmation {
 					listener.AsyncPrintln(display.FormatPlansCatalog(intent.ManualPlansPath, plans))
+					for _, p := range plans {
+						effects, dryErr := executor.DryRun(appCtx, p.Plan, map[string]map[string]any{}, &sync.Mutex{})
+						listener.AsyncPrintln(fmt.Sprintf("%s — %s", p.Name, display.FormatSideEffects(effects, dryErr)))
+					}
 					listener.AsyncPrintln(fmt.Sprintf("About to run %d mission(s) from %s.", len(plans), intent.ManualPlansPath))
 					ans := listener.GetConfirmation(appCtx, "Proceed? [y/n] > ")
 					if ans != "y" && ans != "yes" {
@@ -388,6 +497,8 @@ var rootCmd = &cobra.Command{
 			if needsConfirm {
 				pretty := display.FormatPlan(plan)
 				listener.AsyncPrintln(pretty)
+				effects, dryErr := executor.DryRun(appCtx, plan, map[string]map[string]any{}, &sync.Mutex{})
+				listener.AsyncPrintln(display.FormatSideEffects(effects, dryErr))
 
 				ans := listener.GetConfirmation(appCtx, "Do you want to execute this plan? [y/n] > ")
 				if ans == "y" || ans == "yes" {
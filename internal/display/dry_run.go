@@ -0,0 +1,78 @@
+package display
+
+import (
+	"fmt"
+	"strings"
+
+	"a-a/internal/utils"
+)
+
+// FormatSideEffects renders a dry-run report for the confirmation prompt:
+// files, hosts and LLM calls, each with the action that causes it.
+func FormatSideEffects(effects []utils.Effect, err error) string {
+	var sb strings.Builder
+	sb.WriteString("Dry run (nothing executed yet):\n")
+	if err != nil {
+		sb.WriteString(fmt.Sprintf("  ! the simulation stopped: %v\n", err))
+	}
+	var files, network, llm []utils.Effect
+	for _, e := range effects {
+		switch e.Kind {
+		case utils.EffectNetwork:
+			network = append(network, e)
+		case utils.EffectLLM:
+			llm = append(llm, e)
+		default:
+			files = append(files, e)
+		}
+	}
+	if len(effects) == 0 && err == nil {
+		sb.WriteString("  no file changes, network requests or LLM calls\n")
+		return sb.String()
+	}
+
+	if len(files) > 0 {
+		sb.WriteString("  Files:\n")
+		for _, e := range files {
+			sb.WriteString(fmt.Sprintf("    %-9s %s%s\n", e.Kind, e.Target, effectSuffix(e)))
+		}
+	}
+	if len(network) > 0 {
+		sb.WriteString("  Network:\n")
+		for _, e := range network {
+			sb.WriteString(fmt.Sprintf("    %s%s\n", e.Target, effectSuffix(e)))
+		}
+	}
+	if len(llm) > 0 {
+		total := 0
+		sb.WriteString("  LLM:\n")
+		for _, e := range llm {
+			total += e.Tokens
+			sb.WriteString(fmt.Sprintf("    %s  ~%d prompt tokens%s\n", e.Target, e.Tokens, effectSuffix(e)))
+		}
+		if len(llm) > 1 {
+			sb.WriteString(fmt.Sprintf("    total ~%d prompt tokens in %d calls (before repeats)\n", total, len(llm)))
+		}
+	}
+	return sb.String()
+}
+
+// " (detail)  [action id]  per item  if <guard>"
+func effectSuffix(e utils.Effect) string {
+	var sb strings.Builder
+	if e.Detail != "" {
+		sb.WriteString(" (" + e.Detail + ")")
+	}
+	if e.ActionID != "" {
+		sb.WriteString("  [" + e.ActionID + "]")
+	} else {
+		sb.WriteString("  [" + e.Action + "]")
+	}
+	if e.Repeated != "" {
+		sb.WriteString("  " + e.Repeated)
+	}
+	if e.When != "" {
+		sb.WriteString("  if " + e.When)
+	}
+	return sb.String()
+}
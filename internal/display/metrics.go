@@ -15,16 +15,61 @@ func FormatMissionMetrics(mm *metrics.MissionMetrics) string {
 	sb.WriteString("Execution metrics:\n")
 	sb.WriteString(fmt.Sprintf("- Total: %d ms  (success=%v)\n", mm.DurationMs, mm.Succeeded))
 	for _, s := range mm.Stages {
-		sb.WriteString(fmt.Sprintf("  Stage %d: %d ms\n",
-			s.Stage, s.DurationMs))
+		skipped := ""
+		if s.Skipped > 0 {
+			skipped = fmt.Sprintf("  (%d skipped)", s.Skipped)
+		}
+		sb.WriteString(fmt.Sprintf("  Stage %d: %d ms%s\n",
+			s.Stage, s.DurationMs, skipped))
 		for _, a := range s.Actions {
 			status := "ok"
-			if !a.Success {
+			switch {
+			case a.Skipped:
+				status = "skip"
+			case a.Continued:
+				status = "err, continued"
+			case !a.Success:
 				status = "err"
 			}
+			if a.Attempts > 1 {
+				status += fmt.Sprintf(", %d attempts", a.Attempts)
+			}
 			sb.WriteString(fmt.Sprintf("    • %-12s %-22s %5d ms  [%s]\n",
 				a.ID, "("+a.Action+")", a.DurationMs, status))
+			if a.Continued && a.Err != "" {
+				sb.WriteString(fmt.Sprintf("        %s\n", a.Err))
+			}
+			if a.Skipped && a.SkipReason != "" {
+				sb.WriteString(fmt.Sprintf("        %s\n", a.SkipReason))
+			}
+			if it := a.Items; it != nil && it.Total > 0 {
+				sb.WriteString(fmt.Sprintf("        items: %d (%d ok, %d failed)  p50 %d ms  p95 %d ms\n",
+					it.Total, it.Succeeded, it.Failed, it.P50Ms, it.P95Ms))
+				slow := make([]string, 0, len(it.Slowest))
+				for _, s := range it.Slowest {
+					slow = append(slow, fmt.Sprintf("%s %d ms", s.ID, s.DurationMs))
+				}
+				sb.WriteString(fmt.Sprintf("        slowest: %s\n", strings.Join(slow, ", ")))
+			}
+		}
+	}
+	if len(mm.Rollbacks) > 0 {
+		sb.WriteString(fmt.Sprintf("  Rolled back (%d):\n", len(mm.Rollbacks)))
+		for _, r := range mm.Rollbacks {
+			status := "ok"
+			if !r.Success {
+				status = "err"
+			}
+			sb.WriteString(fmt.Sprintf("    • %-12s %s  [%s]\n", r.ActionID, r.Description, status))
+			if r.Err != "" {
+				sb.WriteString(fmt.Sprintf("        %s\n", r.Err))
+			}
 		}
 	}
 	return sb.String()
 }
+
+// FormatProgress renders a progress line for a running flow.foreach.
+func FormatProgress(missionID string, p metrics.Progress) string {
+	return fmt.Sprintf("[Mission %s] %s: %d/%d done, %d failed", missionID, p.ActionID, p.Done, p.Total, p.Failed)
+}
@@ -2,6 +2,7 @@ package display
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"a-a/internal/parser"
@@ -43,11 +44,34 @@ func formatPlanInternal(plan *parser.ExecutionPlan, limit int) string {
 
 	// Print out meta
 	sb.WriteString(fmt.Sprintf("Meta:\n  - plan_type: %s\n  - replan: %v\n  - handoff_path: %s\n", plan.Meta.PlanType, plan.Meta.Replan, plan.Meta.HandoffPath))
+	if len(plan.Meta.Outputs) > 0 {
+		names := make([]string, 0, len(plan.Meta.Outputs))
+		for name := range plan.Meta.Outputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		sb.WriteString("  - outputs:\n")
+		for _, name := range names {
+			sb.WriteString(fmt.Sprintf("      %s: %s\n", name, plan.Meta.Outputs[name]))
+		}
+	}
 
 	for _, stage := range plan.Plan {
 		sb.WriteString(fmt.Sprintf("Stage %d:\n", stage.Stage))
 		for _, action := range stage.Actions {
 			sb.WriteString(fmt.Sprintf("  - Action: %s (ID: %s)\n", action.Action, action.ID))
+			if action.When != "" {
+				sb.WriteString(fmt.Sprintf("    When: %s\n", action.When))
+			}
+			if policy := formatPolicy(action); policy != "" {
+				sb.WriteString(fmt.Sprintf("    Policy: %s\n", policy))
+			}
+			if action.Compensate != nil {
+				sb.WriteString(fmt.Sprintf("    Compensate: %s\n", action.Compensate.Action))
+			}
+			if action.OnFailure != nil {
+				sb.WriteString(fmt.Sprintf("    On failure: %s\n", action.OnFailure.Action))
+			}
 			if len(action.Payload) > 0 {
 				sb.WriteString("    Payload:\n")
 				for key, val := range action.Payload {
@@ -70,3 +94,22 @@ func formatValueForDisplay(value any, limit int) string {
 	}
 	return s
 }
+
+// One line for the optional per-action execution settings.
+func formatPolicy(a parser.Action) string {
+	var parts []string
+	if a.TimeoutMs > 0 {
+		parts = append(parts, fmt.Sprintf("timeout %d ms", a.TimeoutMs))
+	}
+	if a.Retries > 0 {
+		p := fmt.Sprintf("%d retries", a.Retries)
+		if a.BackoffMs > 0 {
+			p += fmt.Sprintf(" (backoff %d ms)", a.BackoffMs)
+		}
+		parts = append(parts, p)
+	}
+	if a.ContinueOnError {
+		parts = append(parts, "continue on error")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,41 @@
+package display
+
+import (
+	"fmt"
+	"strings"
+
+	"a-a/internal/utils"
+)
+
+// FormatQuestion renders an ask.user question, e.g.
+//
+//	[Mission 1a2b asks] Which product should I order?
+//	  1) Blue kettle
+//	  2) Red kettle
+//	  Answer with a number or label (default: 1, waiting 5m0s)
+func FormatQuestion(missionID string, q utils.Question) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("[Mission %s asks] %s\n", missionID, q.Prompt))
+	hint := "Type your answer"
+	switch q.Kind {
+	case utils.AskChoice:
+		for i, c := range q.Choices {
+			sb.WriteString(fmt.Sprintf("  %d) %s\n", i+1, c))
+		}
+		hint = "Answer with a number or label"
+	case utils.AskYesNo:
+		hint = "Answer y/n"
+	}
+	var notes []string
+	if q.Default != "" {
+		notes = append(notes, "default: "+q.Default)
+	}
+	if q.Timeout > 0 {
+		notes = append(notes, "waiting "+q.Timeout.String())
+	}
+	sb.WriteString("  " + hint)
+	if len(notes) > 0 {
+		sb.WriteString(" (" + strings.Join(notes, ", ") + ")")
+	}
+	return sb.String()
+}
@@ -3,13 +3,13 @@ package executor
 import (
 	"context"
 	"fmt"
-	"regexp"
 	"sync"
 	"time"
 
 	"a-a/internal/actions"
 	"a-a/internal/metrics"
 	"a-a/internal/parser"
+	"a-a/internal/utils"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -17,15 +17,28 @@ import (
 const defaultActionTimeout = 30 * time.Second
 const stageConcurrencyDefault = 16
 
-var resultsRef = regexp.MustCompile(`@results\.([A-Za-z0-9_\-]+)\.([A-Za-z0-9_]+)`)
-
-func ExecutePlan(ctx context.Context, plan *parser.ExecutionPlan, sharedResults map[string]map[string]any, sharedMu *sync.Mutex) (*metrics.MissionMetrics, error) {
-	mm := &metrics.MissionMetrics{Start: time.Now()}
+func ExecutePlan(ctx context.Context, plan *parser.ExecutionPlan, sharedResults map[string]map[string]any, sharedMu *sync.Mutex) (mm *metrics.MissionMetrics, err error) {
+	mm = &metrics.MissionMetrics{Start: time.Now()}
 	defer func() {
 		mm.End = time.Now()
 		mm.DurationMs = mm.End.Sub(mm.Start).Milliseconds()
 	}()
 
+	// A failed attempt is undone before the supervisor retries; a successful
+	// one hands its undos to the mission in case a later plan fails
+	journal := utils.NewJournal()
+	defer func() {
+		if err != nil {
+			mm.Rollbacks = utils.RollBack(ctx, journal.Take())
+			return
+		}
+		utils.JournalFromContext(ctx).Merge(journal, "")
+	}()
+
+	results := utils.NewResults(sharedResults, sharedMu)
+	ctx = utils.WithResults(ctx, results)
+	dryRun := utils.DryRunFromContext(ctx)
+
 	for _, stage := range plan.Plan { // stages sequential
 		if err := ctx.Err(); err != nil {
 			mm.Succeeded = false
@@ -38,6 +51,9 @@ func ExecutePlan(ctx context.Context, plan *parser.ExecutionPlan, sharedResults
 		// errgroup to run actions in parallel with a concurrency cap
 		g, gctx := errgroup.WithContext(stageCtx)
 		g.SetLimit(stageConcurrencyDefault)
+		if dryRun != nil {
+			g.SetLimit(1) // report effects in plan order
+		}
 
 		var amu sync.Mutex // Protects sm.Actions
 
@@ -51,37 +67,68 @@ func ExecutePlan(ctx context.Context, plan *parser.ExecutionPlan, sharedResults
 					}
 				}()
 
-				// Resolve placeholders using mission-shared results (snapshot inside)
-				act.Payload = resolvePayload(act.Payload, sharedResults, sharedMu)
-
-				timeout := defaultActionTimeout
-				if def, ok := parser.GetActionDefinition(act.Action); ok && def.DefaultTimeoutMs > 0 {
-					timeout = time.Duration(def.DefaultTimeoutMs) * time.Millisecond
+				// Guards and placeholders read the same snapshot of mission-shared results
+				snap := results.Snapshot()
+				if dryRun != nil {
+					return simulate(gctx, &act, snap, results, dryRun, &sm, &amu)
+				}
+				reason, err := parser.SkipReason(&act, snap, results.SkippedAmong)
+				if err != nil {
+					now := time.Now()
+					amu.Lock()
+					sm.Actions = append(sm.Actions, metrics.ActionMetrics{ID: act.ID, Action: act.Action, Start: now, End: now, Err: err.Error()})
+					amu.Unlock()
+					return fmt.Errorf("action '%s' (%s) failed: %w", act.Action, act.ID, err)
+				}
+				if reason != "" {
+					now := time.Now()
+					results.Skip(act.ID, reason)
+					amu.Lock()
+					sm.Actions = append(sm.Actions, metrics.ActionMetrics{ID: act.ID, Action: act.Action, Start: now, End: now, Success: true, Skipped: true, SkipReason: reason})
+					amu.Unlock()
+					return nil
 				}
-				actionCtx, cancelAction := context.WithTimeout(gctx, timeout)
-				defer cancelAction()
+				act.Payload = parser.ResolvePayload(act.Payload, snap, parser.RawPayloadKeys(act.Action)...)
 
+				// Each attempt reports foreach items to a fresh recorder
+				var rec *metrics.ItemRecorder
+				undos := utils.NewJournal()
 				am := metrics.ActionMetrics{ID: act.ID, Action: act.Action, Start: time.Now()}
-				output, err := actions.Execute(actionCtx, &act)
+				output, attempts, err := utils.RunAction(gctx, &act, defaultActionTimeout, func(c context.Context) (map[string]any, error) {
+					rec = metrics.NewItemRecorder(act.ID, metrics.ProgressFromContext(ctx))
+					return actions.Execute(utils.WithJournal(metrics.WithItemRecorder(c, rec), undos), &act)
+				})
 				am.End = time.Now()
+				if err == nil && output != nil {
+					results.Set(act.ID, output)
+				}
+				// Declared compensation runs before the built-in undos of the same action
+				if u, ok := utils.Compensation(&act, err != nil, results.Snapshot(), actions.Execute); ok {
+					undos.Add(u)
+				}
+				journal.Merge(undos, act.ID)
+				if items := rec.Items(); len(items) > 0 {
+					am.Items = metrics.SummarizeItems(items)
+				}
 				am.DurationMs = am.End.Sub(am.Start).Milliseconds()
+				am.Attempts = attempts
 				am.Success = err == nil
 				if err != nil {
 					am.Err = err.Error()
+					am.Continued = act.ContinueOnError && gctx.Err() == nil
 				}
 
 				amu.Lock()
 				sm.Actions = append(sm.Actions, am)
 				amu.Unlock()
 
+				if am.Continued {
+					results.Skip(act.ID, "failed: "+err.Error())
+					return nil
+				}
 				if err != nil {
 					return fmt.Errorf("action '%s' (%s) failed: %w", act.Action, act.ID, err)
 				}
-				if output != nil {
-					sharedMu.Lock()
-					sharedResults[act.ID] = output
-					sharedMu.Unlock()
-				}
 				return nil
 			})
 		}
@@ -107,41 +154,58 @@ func ExecutePlan(ctx context.Context, plan *parser.ExecutionPlan, sharedResults
 	return mm, nil
 }
 
-func resolvePayload(payload map[string]any, results map[string]map[string]any, m *sync.Mutex) map[string]any {
-	// Take a snapshot under lock
-	m.Lock()
-	snap := make(map[string]map[string]any, len(results))
-	for k, v := range results {
-		snap[k] = v
+// DryRun simulates plan against a copy of results: each action reports the
+// side effects it would have, and @results are filled with placeholders
+// shaped by the registry's output_schema.
+func DryRun(ctx context.Context, plan *parser.ExecutionPlan, sharedResults map[string]map[string]any, sharedMu *sync.Mutex) ([]utils.Effect, error) {
+	sharedMu.Lock()
+	results := make(map[string]map[string]any, len(sharedResults))
+	for id, out := range sharedResults {
+		results[id] = out
 	}
-	m.Unlock()
-	return resolvePayloadWithSnapshot(payload, snap)
+	sharedMu.Unlock()
+
+	report := utils.NewDryRunReport()
+	_, err := ExecutePlan(utils.WithDryRun(utils.WithJournal(ctx, nil), report), plan, results, &sync.Mutex{})
+	return report.Effects(), err
 }
 
-func resolvePayloadWithSnapshot(payload map[string]any, snap map[string]map[string]any) map[string]any {
-	resolved := make(map[string]any, len(payload))
+// Dry-run counterpart of running an action. Guards are not evaluated (their
+// inputs are placeholders); effects of guarded actions carry the guard.
+func simulate(ctx context.Context, act *parser.Action, snap map[string]map[string]any, results *utils.Results, report *utils.DryRunReport, sm *metrics.StageMetrics, amu *sync.Mutex) error {
+	act.Payload = parser.ResolvePayload(act.Payload, snap, parser.RawPayloadKeys(act.Action)...)
+	am := metrics.ActionMetrics{ID: act.ID, Action: act.Action, Start: time.Now()}
+	effects, err := actions.Simulate(ctx, act)
+	am.End = time.Now()
+	am.DurationMs = am.End.Sub(am.Start).Milliseconds()
+	am.Success = err == nil
+	if err != nil {
+		am.Err = err.Error()
+	}
+	amu.Lock()
+	sm.Actions = append(sm.Actions, am)
+	amu.Unlock()
+	if err != nil {
+		return fmt.Errorf("action '%s' (%s) failed: %w", act.Action, act.ID, err)
+	}
 
-	for key, val := range payload {
-		str, ok := val.(string)
-		if !ok {
-			resolved[key] = val
-			continue
+	for i := range effects {
+		e := &effects[i]
+		if e.ActionID == "" {
+			e.ActionID = act.ID
+		}
+		if e.Action == "" {
+			e.Action = act.Action
+		}
+		switch {
+		case act.When == "":
+		case e.When == "":
+			e.When = act.When
+		default:
+			e.When = act.When + " && " + e.When
 		}
-
-		out := resultsRef.ReplaceAllStringFunc(str, func(match string) string {
-			sub := resultsRef.FindStringSubmatch(match)
-			if len(sub) != 3 {
-				return ""
-			}
-			actionID, outKey := sub[1], sub[2]
-			if m, ok := snap[actionID]; ok {
-				if v, ok := m[outKey]; ok {
-					return fmt.Sprintf("%v", v)
-				}
-			}
-			return ""
-		})
-		resolved[key] = out
 	}
-	return resolved
+	report.Add(effects...)
+	results.Set(act.ID, parser.PlaceholderOutput(act))
+	return nil
 }
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	slowestItems     = 3
+	progressInterval = 2 * time.Second
+)
+
+// ItemSummary rolls the items of a flow.foreach up into its ActionMetrics.
+type ItemSummary struct {
+	Total     int           `json:"total"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	P50Ms     int64         `json:"p50_ms"`
+	P95Ms     int64         `json:"p95_ms"`
+	Slowest   []ItemMetrics `json:"slowest,omitempty"`
+	Items     []ItemMetrics `json:"items,omitempty"`
+}
+
+// SummarizeItems computes counts, nearest-rank latency percentiles and the
+// slowest items.
+func SummarizeItems(items []ItemMetrics) *ItemSummary {
+	s := &ItemSummary{Total: len(items), Items: items}
+	if len(items) == 0 {
+		return s
+	}
+	byDuration := make([]ItemMetrics, len(items))
+	copy(byDuration, items)
+	sort.SliceStable(byDuration, func(i, j int) bool { return byDuration[i].DurationMs > byDuration[j].DurationMs })
+	for _, it := range items {
+		if it.Success {
+			s.Succeeded++
+		} else {
+			s.Failed++
+		}
+	}
+	// Nearest rank over durations in ascending order
+	pct := func(p float64) int64 {
+		rank := int(math.Ceil(p*float64(len(byDuration)))) - 1
+		return byDuration[len(byDuration)-1-max(rank, 0)].DurationMs
+	}
+	s.P50Ms, s.P95Ms = pct(0.50), pct(0.95)
+	s.Slowest = byDuration[:min(slowestItems, len(byDuration))]
+	return s
+}
+
+// Progress is a snapshot of a running flow.foreach.
+type Progress struct {
+	ActionID string
+	Done     int
+	Failed   int
+	Total    int
+}
+
+// ItemRecorder collects the item metrics of one action while it runs and
+// reports progress at most every two seconds.
+type ItemRecorder struct {
+	mu         sync.Mutex
+	items      []ItemMetrics
+	total      int
+	failed     int
+	actionID   string
+	onProgress func(Progress)
+	last       time.Time
+}
+
+// NewItemRecorder returns a recorder for actionID; onProgress may be nil.
+func NewItemRecorder(actionID string, onProgress func(Progress)) *ItemRecorder {
+	return &ItemRecorder{actionID: actionID, onProgress: onProgress, last: time.Now()}
+}
+
+// SetTotal announces how many items will be recorded.
+func (r *ItemRecorder) SetTotal(n int) {
+	r.mu.Lock()
+	r.total = n
+	r.mu.Unlock()
+}
+
+// Record adds a finished item.
+func (r *ItemRecorder) Record(it ItemMetrics) {
+	r.mu.Lock()
+	r.items = append(r.items, it)
+	if !it.Success {
+		r.failed++
+	}
+	var p *Progress
+	if r.onProgress != nil && time.Since(r.last) >= progressInterval && len(r.items) < r.total {
+		r.last = time.Now()
+		p = &Progress{ActionID: r.actionID, Done: len(r.items), Failed: r.failed, Total: r.total}
+	}
+	r.mu.Unlock()
+	if p != nil {
+		r.onProgress(*p)
+	}
+}
+
+// Items returns the recorded items ordered by index.
+func (r *ItemRecorder) Items() []ItemMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]ItemMetrics, len(r.items))
+	copy(out, r.items)
+	sort.Slice(out, func(i, j int) bool { return out[i].Index < out[j].Index })
+	return out
+}
+
+type recorderKey struct{}
+type progressKey struct{}
+
+// WithItemRecorder attaches r to ctx; nil hides an outer recorder from
+// nested flow actions.
+func WithItemRecorder(ctx context.Context, r *ItemRecorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// ItemRecorderFromContext returns the recorder set by WithItemRecorder, or nil.
+func ItemRecorderFromContext(ctx context.Context) *ItemRecorder {
+	r, _ := ctx.Value(recorderKey{}).(*ItemRecorder)
+	return r
+}
+
+// WithProgress registers the function that receives foreach progress.
+func WithProgress(ctx context.Context, fn func(Progress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// ProgressFromContext returns the function set by WithProgress, or nil.
+func ProgressFromContext(ctx context.Context) func(Progress) {
+	fn, _ := ctx.Value(progressKey{}).(func(Progress))
+	return fn
+}
@@ -3,13 +3,29 @@ package metrics
 import "time"
 
 type ActionMetrics struct {
-	ID         string    `json:"id"`
-	Action     string    `json:"action"`
-	Start      time.Time `json:"start"`
-	End        time.Time `json:"end"`
-	DurationMs int64     `json:"duration_ms"`
-	Success    bool      `json:"success"`
-	Err        string    `json:"err,omitempty"`
+	ID         string       `json:"id"`
+	Action     string       `json:"action"`
+	Start      time.Time    `json:"start"`
+	End        time.Time    `json:"end"`
+	DurationMs int64        `json:"duration_ms"`
+	Success    bool         `json:"success"`
+	Err        string       `json:"err,omitempty"`
+	Skipped    bool         `json:"skipped,omitempty"` // guard was false; not a failure
+	SkipReason string       `json:"skip_reason,omitempty"`
+	Items      *ItemSummary `json:"items,omitempty"` // flow.foreach items
+	Attempts   int          `json:"attempts,omitempty"`
+	Continued  bool         `json:"continued,omitempty"` // failed, but continue_on_error kept the stage going
+}
+
+// ItemMetrics describes one flow.foreach item, labelled with its item ID
+// (id_prefix + 1-based index).
+type ItemMetrics struct {
+	ID         string `json:"id"`
+	Index      int    `json:"index"`
+	DurationMs int64  `json:"duration_ms"`
+	Attempts   int    `json:"attempts"`
+	Success    bool   `json:"success"`
+	Err        string `json:"err,omitempty"`
 }
 
 type StageMetrics struct {
@@ -18,6 +34,7 @@ type StageMetrics struct {
 	End        time.Time       `json:"end"`
 	DurationMs int64           `json:"duration_ms"`
 	Actions    []ActionMetrics `json:"actions"`
+	Skipped    int             `json:"skipped,omitempty"`
 }
 
 type MissionMetrics struct {
@@ -27,9 +44,25 @@ type MissionMetrics struct {
 	DurationMs int64          `json:"duration_ms"`
 	Succeeded  bool           `json:"succeeded"`
 	Stages     []StageMetrics `json:"stages"`
+	Rollbacks  []Rollback     `json:"rollbacks,omitempty"`
+}
+
+// Rollback reports one undo run after a failed or cancelled mission.
+type Rollback struct {
+	ActionID    string `json:"action_id"`
+	Description string `json:"description"`
+	DurationMs  int64  `json:"duration_ms"`
+	Success     bool   `json:"success"`
+	Err         string `json:"err,omitempty"`
 }
 
 // Compute derived fields for a stage.
 func (s *StageMetrics) Finalize() {
 	s.DurationMs = s.End.Sub(s.Start).Milliseconds()
+	s.Skipped = 0
+	for _, a := range s.Actions {
+		if a.Skipped {
+			s.Skipped++
+		}
+	}
 }
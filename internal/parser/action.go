@@ -4,6 +4,17 @@ type Action struct {
 	ID      string         `json:"id"`
 	Action  string         `json:"action"`
 	Payload map[string]any `json:"payload"`
+	When    string         `json:"when,omitempty"` // guard; the action is skipped when false
+
+	// Execution policy (all optional)
+	TimeoutMs       int  `json:"timeout_ms,omitempty"`        // per attempt; overrides default_timeout_ms
+	Retries         int  `json:"retries,omitempty"`           // extra attempts after a failure
+	BackoffMs       int  `json:"backoff_ms,omitempty"`        // wait before the first retry, doubled after each
+	ContinueOnError bool `json:"continue_on_error,omitempty"` // a failure does not fail the stage
+
+	// Rollback (both optional); run in reverse order when the mission fails or is cancelled
+	Compensate *Action `json:"compensate,omitempty"` // undoes this action after it succeeded
+	OnFailure  *Action `json:"on_failure,omitempty"` // cleans up after this action failed
 }
 
 type ExecutionStage struct {
@@ -15,6 +26,10 @@ type PlanMeta struct {
 	PlanType    string `json:"plan_type,omitempty"`    // "exploration", "extraction", ...
 	Replan      bool   `json:"replan,omitempty"`       // true if this plan is a replan
 	HandoffPath string `json:"handoff_path,omitempty"` // path to handoff context file if any
+
+	// Declared outputs of the mission, name -> "@results.<id>.<key>[.<path>]";
+	// returned to the parent of a sub-mission (flow.mission)
+	Outputs map[string]string `json:"outputs,omitempty"`
 }
 
 type ExecutionPlan struct {
@@ -0,0 +1,603 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Condition is a compiled "when" guard or flow.if condition, e.g.
+//
+//	@results.fetch.status_code == 200
+//	len(@results.links.links_json) > 0 && !contains(@results.page.content, "captcha")
+//
+// Operands are numbers, 'single' or "double" quoted strings, true/false/null
+// and @results.<id>.<key>[.<path>] references (a path reaches into *_json
+// outputs). Operators: == != < <= > >= && || ! (also and/or/not) and
+// parentheses. Functions: len, empty, exists, contains, starts_with,
+// ends_with, matches (RE2), lower, number. Scope variables (see WithScope)
+// are read as prev.<key>, item.<field>, item and iteration.
+type Condition struct {
+	src  string
+	eval condFn
+	refs []string
+}
+
+type condFn func(results map[string]map[string]any) (any, error)
+
+// ParseCondition compiles src; an error means the expression is malformed.
+func ParseCondition(src string) (*Condition, error) {
+	toks, err := lexCondition(src)
+	if err != nil {
+		return nil, fmt.Errorf("condition %q: %w", src, err)
+	}
+	p := &condParser{toks: toks}
+	fn, err := p.or()
+	if err == nil && p.i < len(p.toks) {
+		err = fmt.Errorf("unexpected %q", p.toks[p.i].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("condition %q: %w", src, err)
+	}
+	return &Condition{src: src, eval: fn, refs: p.refs}, nil
+}
+
+func (c *Condition) String() string { return c.src }
+
+// Refs lists the action IDs the condition reads, in order of appearance.
+func (c *Condition) Refs() []string { return c.refs }
+
+// Eval runs the condition against the mission's results and reports whether
+// it holds. Missing results evaluate as null rather than failing.
+func (c *Condition) Eval(results map[string]map[string]any) (bool, error) {
+	v, err := c.eval(results)
+	if err != nil {
+		return false, fmt.Errorf("condition %q: %w", c.src, err)
+	}
+	return Truthy(v), nil
+}
+
+// Truthy: null, false, 0, "", "0", "false", "[]", "{}" and empty
+// arrays/objects are false; everything else is true.
+func Truthy(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case int:
+		return t != 0
+	case int64:
+		return t != 0
+	case string:
+		s := strings.TrimSpace(t)
+		switch strings.ToLower(s) {
+		case "", "0", "false", "null", "[]", "{}":
+			return false
+		}
+		return true
+	case []any:
+		return len(t) > 0
+	case map[string]any:
+		return len(t) > 0
+	}
+	return true
+}
+
+// ---- lexer ----
+
+type condTok struct {
+	kind string // num, str, ref, ident, op
+	text string
+	num  float64
+}
+
+var (
+	condRefRe   = regexp.MustCompile(`^@results\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_]+(?:\.[A-Za-z0-9_\-]+)*`)
+	condScopeRe = regexp.MustCompile(`^(?:prev|item)\.[A-Za-z0-9_\-]+(?:\.[A-Za-z0-9_\-]+)*`)
+)
+
+// ScopeKey is the results entry holding scope variables; "$" never appears
+// in action IDs.
+const ScopeKey = "$scope"
+
+var scopeVars = map[string]bool{"prev": true, "item": true, "iteration": true}
+
+// WithScope copies a results snapshot and adds scope variables: "prev" (a
+// loop's previous output), "item" (the current flow.foreach item) and
+// "iteration".
+func WithScope(snap map[string]map[string]any, vars map[string]any) map[string]map[string]any {
+	env := make(map[string]map[string]any, len(snap)+1)
+	for k, v := range snap {
+		env[k] = v
+	}
+	scope := map[string]any{}
+	for k, v := range snap[ScopeKey] {
+		scope[k] = v
+	}
+	for k, v := range vars {
+		scope[k] = v
+	}
+	env[ScopeKey] = scope
+	return env
+}
+
+func lexCondition(s string) ([]condTok, error) {
+	var toks []condTok
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '@':
+			m := condRefRe.FindString(s[i:])
+			if m == "" {
+				return nil, fmt.Errorf("malformed reference at %q (want @results.<id>.<key>)", s[i:])
+			}
+			toks = append(toks, condTok{kind: "ref", text: m})
+			i += len(m)
+		case c == '"' || c == '\'':
+			j := i + 1
+			var b strings.Builder
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			toks = append(toks, condTok{kind: "str", text: b.String()})
+			i = j + 1
+		case c >= '0' && c <= '9' || (c == '-' || c == '.') && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9' && expectsOperand(toks):
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == 'e' || s[j] == 'E') {
+				j++
+			}
+			n, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad number %q", s[i:j])
+			}
+			toks = append(toks, condTok{kind: "num", text: s[i:j], num: n})
+			i = j
+		case condScopeRe.MatchString(s[i:]):
+			m := condScopeRe.FindString(s[i:])
+			toks = append(toks, condTok{kind: "ref", text: m})
+			i += len(m)
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			word := s[i:j]
+			switch strings.ToLower(word) {
+			case "and":
+				toks = append(toks, condTok{kind: "op", text: "&&"})
+			case "or":
+				toks = append(toks, condTok{kind: "op", text: "||"})
+			case "not":
+				toks = append(toks, condTok{kind: "op", text: "!"})
+			default:
+				toks = append(toks, condTok{kind: "ident", text: word})
+			}
+			i = j
+		default:
+			op := ""
+			for _, cand := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", ","} {
+				if strings.HasPrefix(s[i:], cand) {
+					op = cand
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			toks = append(toks, condTok{kind: "op", text: op})
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+// A leading '-' is a sign only where an operand is expected.
+func expectsOperand(toks []condTok) bool {
+	if len(toks) == 0 {
+		return true
+	}
+	last := toks[len(toks)-1]
+	return last.kind == "op" && last.text != ")"
+}
+
+// ---- parser ----
+
+type condParser struct {
+	toks []condTok
+	i    int
+	refs []string
+}
+
+func (p *condParser) peek(text string) bool {
+	return p.i < len(p.toks) && p.toks[p.i].kind == "op" && p.toks[p.i].text == text
+}
+
+func (p *condParser) or() (condFn, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("||") {
+		p.i++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r map[string]map[string]any) (any, error) {
+			a, err := l(r)
+			if err != nil || Truthy(a) {
+				return Truthy(a), err
+			}
+			b, err := right(r)
+			return Truthy(b), err
+		}
+	}
+	return left, nil
+}
+
+func (p *condParser) and() (condFn, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("&&") {
+		p.i++
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(r map[string]map[string]any) (any, error) {
+			a, err := l(r)
+			if err != nil || !Truthy(a) {
+				return false, err
+			}
+			b, err := right(r)
+			return Truthy(b), err
+		}
+	}
+	return left, nil
+}
+
+func (p *condParser) not() (condFn, error) {
+	if p.peek("!") {
+		p.i++
+		inner, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(r map[string]map[string]any) (any, error) {
+			v, err := inner(r)
+			return !Truthy(v), err
+		}, nil
+	}
+	return p.compare()
+}
+
+func (p *condParser) compare() (condFn, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if !p.peek(op) {
+			continue
+		}
+		p.i++
+		right, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		return func(r map[string]map[string]any) (any, error) {
+			a, err := left(r)
+			if err != nil {
+				return nil, err
+			}
+			b, err := right(r)
+			if err != nil {
+				return nil, err
+			}
+			return compareOp(op, a, b), nil
+		}, nil
+	}
+	return left, nil
+}
+
+func (p *condParser) primary() (condFn, error) {
+	if p.i >= len(p.toks) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	t := p.toks[p.i]
+	p.i++
+	switch t.kind {
+	case "num":
+		n := t.num
+		return func(map[string]map[string]any) (any, error) { return n, nil }, nil
+	case "str":
+		s := t.text
+		return func(map[string]map[string]any) (any, error) { return s, nil }, nil
+	case "ref":
+		var parts []string
+		if rest, ok := strings.CutPrefix(t.text, "@results."); ok {
+			parts = strings.Split(rest, ".")
+			p.refs = append(p.refs, parts[0])
+		} else {
+			parts = append([]string{ScopeKey}, strings.Split(t.text, ".")...)
+		}
+		return func(r map[string]map[string]any) (any, error) { return lookupRef(r, parts), nil }, nil
+	case "ident":
+		switch strings.ToLower(t.text) {
+		case "true":
+			return func(map[string]map[string]any) (any, error) { return true, nil }, nil
+		case "false":
+			return func(map[string]map[string]any) (any, error) { return false, nil }, nil
+		case "null", "nil":
+			return func(map[string]map[string]any) (any, error) { return nil, nil }, nil
+		}
+		if scopeVars[t.text] && !p.peek("(") {
+			parts := []string{ScopeKey, t.text}
+			return func(r map[string]map[string]any) (any, error) { return lookupRef(r, parts), nil }, nil
+		}
+		return p.call(t.text)
+	case "op":
+		if t.text == "(" {
+			inner, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if !p.peek(")") {
+				return nil, fmt.Errorf("missing ')'")
+			}
+			p.i++
+			return inner, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+var condFuncArity = map[string]int{
+	"len": 1, "empty": 1, "exists": 1, "lower": 1, "number": 1,
+	"contains": 2, "starts_with": 2, "ends_with": 2, "matches": 2,
+}
+
+func (p *condParser) call(name string) (condFn, error) {
+	name = strings.ToLower(name)
+	arity, ok := condFuncArity[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function or word %q", name)
+	}
+	if !p.peek("(") {
+		return nil, fmt.Errorf("%s needs arguments in parentheses", name)
+	}
+	p.i++
+	var args []condFn
+	for !p.peek(")") {
+		if len(args) > 0 {
+			if !p.peek(",") {
+				return nil, fmt.Errorf("expected ',' in %s(...)", name)
+			}
+			p.i++
+		}
+		a, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+	}
+	p.i++
+	if len(args) != arity {
+		return nil, fmt.Errorf("%s takes %d argument(s), got %d", name, arity, len(args))
+	}
+
+	var re *regexp.Regexp
+	if name == "matches" {
+		// Compile constant patterns once
+		if pat, err := args[1](nil); err == nil {
+			if s, ok := pat.(string); ok {
+				if re, err = regexp.Compile(s); err != nil {
+					return nil, fmt.Errorf("matches: %w", err)
+				}
+			}
+		}
+	}
+
+	return func(r map[string]map[string]any) (any, error) {
+		vals := make([]any, len(args))
+		for i, a := range args {
+			v, err := a(r)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = v
+		}
+		switch name {
+		case "len":
+			return float64(length(vals[0])), nil
+		case "empty":
+			return length(vals[0]) == 0, nil
+		case "exists":
+			return vals[0] != nil, nil
+		case "lower":
+			return strings.ToLower(condText(vals[0])), nil
+		case "number":
+			n, _ := condNumber(vals[0])
+			return n, nil
+		case "contains":
+			if arr, ok := decodeJSONish(vals[0]).([]any); ok {
+				for _, x := range arr {
+					if compareOp("==", x, vals[1]) {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+			return strings.Contains(condText(vals[0]), condText(vals[1])), nil
+		case "starts_with":
+			return strings.HasPrefix(condText(vals[0]), condText(vals[1])), nil
+		case "ends_with":
+			return strings.HasSuffix(condText(vals[0]), condText(vals[1])), nil
+		case "matches":
+			rx := re
+			if rx == nil {
+				var err error
+				if rx, err = regexp.Compile(condText(vals[1])); err != nil {
+					return nil, fmt.Errorf("matches: %w", err)
+				}
+			}
+			return rx.MatchString(condText(vals[0])), nil
+		}
+		return nil, fmt.Errorf("unknown function %s", name)
+	}, nil
+}
+
+// ---- values ----
+
+func lookupRef(results map[string]map[string]any, parts []string) any {
+	out, ok := results[parts[0]]
+	if !ok {
+		return nil
+	}
+	cur, ok := out[parts[1]]
+	if !ok {
+		return nil
+	}
+	for _, seg := range parts[2:] {
+		switch node := decodeJSONish(cur).(type) {
+		case map[string]any:
+			cur = node[seg]
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			cur = node[i]
+		default:
+			return nil
+		}
+	}
+	return cur
+}
+
+// Strings holding a JSON array or object (the *_json outputs) decode to
+// their value; anything else is returned unchanged.
+func decodeJSONish(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	t := strings.TrimSpace(s)
+	if t == "" || (t[0] != '[' && t[0] != '{') {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal([]byte(t), &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func length(v any) int {
+	switch t := decodeJSONish(v).(type) {
+	case nil:
+		return 0
+	case []any:
+		return len(t)
+	case map[string]any:
+		return len(t)
+	case string:
+		return utf8.RuneCountInString(t)
+	}
+	return len(condText(v))
+}
+
+func condText(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func condNumber(v any) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// Numbers (and numeric strings) compare numerically, everything else as text.
+func compareOp(op string, a, b any) bool {
+	cmp := 0
+	if x, ok := condNumber(a); ok {
+		if y, ok := condNumber(b); ok {
+			switch {
+			case x < y:
+				cmp = -1
+			case x > y:
+				cmp = 1
+			}
+			return applyCmp(op, cmp)
+		}
+	}
+	if ab, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok {
+			if op == "==" {
+				return ab == bb
+			}
+			if op == "!=" {
+				return ab != bb
+			}
+		}
+	}
+	cmp = strings.Compare(condText(a), condText(b))
+	return applyCmp(op, cmp)
+}
+
+func applyCmp(op string, cmp int) bool {
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var condResults = map[string]map[string]any{
+	"fetch": {
+		"status_code": 200.0,
+		"content":     "Welcome, please solve the CAPTCHA",
+		"body_json":   `{"user": {"name": "Ada", "age": 36}, "tags": ["a", "b"]}`,
+		"empty_json":  `[]`,
+		"count":       "12",
+		"ok":          true,
+	},
+	"links": {"links_json": `["https://a.example", "https://b.example"]`},
+}
+
+func TestConditionEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// comparisons
+		{"@results.fetch.status_code == 200", true},
+		{"@results.fetch.status_code != 200", false},
+		{"@results.fetch.count > 9", true},     // numeric string compares as a number
+		{"@results.fetch.count > '9'", true},   // both numeric: still a number
+		{"'abc' < 'abd'", true},                // text comparison
+		{"@results.fetch.ok == true", true},    // booleans
+		{"@results.missing.key == null", true}, // missing results are null
+		{"@results.fetch.nope == null", true},  // missing keys too
+		{"@results.fetch.body_json.user.age >= 36", true},
+		{"@results.fetch.body_json.tags.1 == 'b'", true}, // index into a *_json array
+		{"@results.fetch.body_json.tags.9 == null", true},
+
+		// precedence: ! > comparison > && > ||
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"!false && false", false},
+		{"!(false && false)", true},
+		{"false or true and true", true},
+		{"not false and not false", true},
+		{"!@results.fetch.nope", true},
+
+		// truthiness of bare operands
+		{"@results.fetch.ok", true},
+		{"@results.fetch.empty_json", false},
+		{"@results.links.links_json", true},
+		{"'0'", false},
+		{"'false'", false},
+		{"0", false},
+		{"'x'", true},
+
+		// functions
+		{"len(@results.links.links_json) == 2", true},
+		{"len('héllo') == 5", true},
+		{"len(@results.fetch.body_json) == 2", true},
+		{"empty(@results.fetch.empty_json)", true},
+		{"empty(@results.links.links_json)", false},
+		{"exists(@results.fetch.status_code)", true},
+		{"exists(@results.fetch.nope)", false},
+		{"contains(@results.fetch.content, 'CAPTCHA')", true},
+		{"contains(lower(@results.fetch.content), 'captcha')", true},
+		{"contains(@results.links.links_json, 'https://b.example')", true},
+		{"contains(@results.links.links_json, 'https://c.example')", false},
+		{"starts_with(@results.fetch.content, 'Welcome')", true},
+		{"ends_with(@results.fetch.content, 'CAPTCHA')", true},
+		{"matches(@results.fetch.content, '^Wel+come')", true},
+		{"matches(@results.fetch.content, '[0-9]')", false},
+		{"number('3.5') > 3", true},
+		{"LEN(@results.links.links_json) > 1", true}, // function names are case-insensitive
+	}
+	for _, tc := range tests {
+		t.Run(tc.src, func(t *testing.T) {
+			c, err := ParseCondition(tc.src)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			got, err := c.Eval(condResults)
+			if err != nil {
+				t.Fatalf("eval: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConditionScope(t *testing.T) {
+	env := WithScope(condResults, map[string]any{
+		"prev":      map[string]any{"status": "pending", "rows_json": `[1, 2, 3]`},
+		"item":      map[string]any{"name": "kettle", "price": 25.0},
+		"iteration": 2,
+	})
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"prev.status == 'pending'", true},
+		{"len(prev.rows_json) == 3", true},
+		{"prev.rows_json.0 == 1", true},
+		{"item.price > 20 && item.name == 'kettle'", true},
+		{"item.missing == null", true},
+		{"item", true},
+		{"iteration == 2", true},
+		{"iteration < 2", false},
+		{"@results.fetch.status_code == 200 && iteration >= 1", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.src, func(t *testing.T) {
+			c, err := ParseCondition(tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.Eval(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// Nested scopes keep the outer variables they do not override
+	inner := WithScope(env, map[string]any{"item": "bolt"})
+	c, err := ParseCondition("item == 'bolt' && iteration == 2 && prev.status == 'pending'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.Eval(inner); err != nil || !ok {
+		t.Fatalf("nested scope: %v, %v", ok, err)
+	}
+
+	// Without a scope the variables are null
+	c, _ = ParseCondition("item == null && prev.status == null")
+	if ok, err := c.Eval(condResults); err != nil || !ok {
+		t.Fatalf("no scope: %v, %v", ok, err)
+	}
+}
+
+func TestConditionRefs(t *testing.T) {
+	c, err := ParseCondition("@results.fetch.ok && len(@results.links.links_json) > 0 || item.x == @results.fetch.count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"fetch", "links", "fetch"}; !reflect.DeepEqual(c.Refs(), want) {
+		t.Fatalf("refs = %v, want %v", c.Refs(), want)
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	tests := []struct {
+		src, wantErr string
+	}{
+		{"", "unexpected end"},
+		{"@results.fetch.ok &&", "unexpected end"},
+		{"(true", "missing ')'"},
+		{"true)", "unexpected"},
+		{"frobnicate(1)", "unknown function"},
+		{"len", "parentheses"},
+		{"len(1, 2)", "argument"},
+		{"contains('a')", "argument"},
+		{"matches('a', '(')", "matches"},
+		{"'unterminated", ""},
+		{"1 2", "unexpected"},
+		{"1 < 2 == true", "unexpected"},          // comparisons do not chain
+		{"number(@results.fetch.count) + 1", ""}, // no arithmetic
+	}
+	for _, tc := range tests {
+		t.Run(tc.src, func(t *testing.T) {
+			_, err := ParseCondition(tc.src)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("ParseCondition(%q) error = %v, want one containing %q", tc.src, err, tc.wantErr)
+			}
+		})
+	}
+
+	// A pattern only known at run time fails on evaluation
+	c, err := ParseCondition("matches('x', @results.fetch.content)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Eval(map[string]map[string]any{"fetch": {"content": "("}}); err == nil {
+		t.Fatal("want an error for a bad run-time pattern")
+	}
+}
@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dry runs fill @results with placeholders shaped by each action's
+// output_schema: 0 for counts, false for flags, "[]"/"{}" for *_json keys
+// and "<dry-run:id.key>" for everything else.
+const placeholderPrefix = "<dry-run:"
+
+var numericOutputs = map[string]bool{
+	"count": true, "bytes": true, "status_code": true, "rows": true, "lines": true,
+	"files": true, "page_count": true, "chars": true, "succeeded": true, "failed": true,
+	"tables_count": true, "replacements": true, "length": true, "tokens": true,
+	"skipped": true, "deleted": true, "attempts": true,
+}
+
+var boolOutputs = map[string]bool{
+	"truncated": true, "valid": true, "from_cache": true,
+}
+
+var objectOutputs = map[string]bool{
+	"json": true, "headers_json": true, "metadata_json": true, "counts_json": true,
+	"last_json": true, "named_json": true,
+}
+
+// Placeholder is the dry-run stand-in for @results.<id>.<key>.
+func Placeholder(id, key string) string {
+	return fmt.Sprintf("%s%s.%s>", placeholderPrefix, id, key)
+}
+
+// HasPlaceholder reports whether s still contains a value that is only known
+// at run time: a dry-run placeholder or a {{...}} template placeholder.
+func HasPlaceholder(s string) bool {
+	return strings.Contains(s, placeholderPrefix) || strings.Contains(s, "{{")
+}
+
+// PlaceholderOutput returns a dry-run output for a. String outputs named
+// like a payload key (path, url, dest, ...) echo the payload value.
+func PlaceholderOutput(a *Action) map[string]any {
+	out := map[string]any{}
+	def, ok := GetActionDefinition(a.Action)
+	if !ok {
+		return out
+	}
+	for _, key := range def.OutputSchema.Keys {
+		switch {
+		case numericOutputs[key]:
+			out[key] = 0
+		case boolOutputs[key]:
+			out[key] = false
+		case objectOutputs[key]:
+			out[key] = "{}"
+		case strings.HasSuffix(key, "_json"):
+			out[key] = "[]"
+		default:
+			if s, ok := a.Payload[key].(string); ok && s != "" {
+				out[key] = s
+			} else {
+				out[key] = Placeholder(a.ID, key)
+			}
+		}
+	}
+	return out
+}
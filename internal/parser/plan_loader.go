@@ -52,20 +52,121 @@ func validateStageDependencies(plan *ExecutionPlan) error {
 	for si, stage := range plan.Plan {
 		// Check all actions' payloads in this stage
 		for _, act := range stage.Actions {
-			if err := checkNoIntraStageRefs(act.Payload, seen, si, act.ID); err != nil {
+			if err := checkActionRefs(act, seen, si); err != nil {
 				return err
 			}
 		}
 		// Mark actions from this stage as available for later stages
 		for _, act := range stage.Actions {
-			if act.ID != "" {
-				seen[act.ID] = struct{}{}
+			markProduced(act, seen)
+		}
+	}
+	return nil
+}
+
+// Guards count as references. flow.if branch actions run in order, so each
+// may also read the siblings before it.
+func checkActionRefs(act Action, seen map[string]struct{}, stageIdx int) error {
+	if err := checkNoIntraStageRefs(act.When, seen, stageIdx, act.ID); err != nil {
+		return err
+	}
+	if err := checkCompensationRefs(act, seen, stageIdx); err != nil {
+		return err
+	}
+	if act.Action == "flow.foreach" {
+		return checkForeachRefs(act, seen, stageIdx)
+	}
+	if act.Action != "flow.if" {
+		return checkNoIntraStageRefs(act.Payload, seen, stageIdx, act.ID)
+	}
+	if err := checkNoIntraStageRefs(act.Payload["condition"], seen, stageIdx, act.ID); err != nil {
+		return err
+	}
+	for _, key := range []string{"then", "else"} {
+		branch, _ := BranchActions(act.Payload[key])
+		local := make(map[string]struct{}, len(seen)+len(branch))
+		for id := range seen {
+			local[id] = struct{}{}
+		}
+		for _, sub := range branch {
+			if err := checkActionRefs(sub, local, stageIdx); err != nil {
+				return err
 			}
+			markProduced(sub, local)
 		}
 	}
 	return nil
 }
 
+// A compensation runs after its action, so compensate may also read the
+// action's own outputs.
+func checkCompensationRefs(act Action, seen map[string]struct{}, stageIdx int) error {
+	if act.OnFailure != nil {
+		if err := checkNoIntraStageRefs(act.OnFailure.Payload, seen, stageIdx, act.ID); err != nil {
+			return fmt.Errorf("on_failure: %w", err)
+		}
+	}
+	if act.Compensate == nil {
+		return nil
+	}
+	local := make(map[string]struct{}, len(seen)+1)
+	for id := range seen {
+		local[id] = struct{}{}
+	}
+	local[act.ID] = struct{}{}
+	if err := checkNoIntraStageRefs(act.Compensate.Payload, local, stageIdx, act.ID); err != nil {
+		return fmt.Errorf("compensate: %w", err)
+	}
+	return nil
+}
+
+// A mini-plan template sees earlier stages of the mission plus its own
+// earlier stages; its IDs stay private to each item.
+func checkForeachRefs(act Action, seen map[string]struct{}, stageIdx int) error {
+	tpl, _ := act.Payload["template"].(map[string]any)
+	stages, isPlan, _ := TemplatePlan(tpl)
+	if !isPlan {
+		return checkNoIntraStageRefs(act.Payload, seen, stageIdx, act.ID)
+	}
+	for k, v := range act.Payload {
+		if k == "template" {
+			continue
+		}
+		if err := checkNoIntraStageRefs(v, seen, stageIdx, act.ID); err != nil {
+			return err
+		}
+	}
+	local := make(map[string]struct{}, len(seen))
+	for id := range seen {
+		local[id] = struct{}{}
+	}
+	for _, st := range stages {
+		for _, sub := range st.Actions {
+			if err := checkActionRefs(sub, local, stageIdx); err != nil {
+				return fmt.Errorf("flow.foreach '%s' template: %w", act.ID, err)
+			}
+		}
+		for _, sub := range st.Actions {
+			markProduced(sub, local)
+		}
+	}
+	return nil
+}
+
+func markProduced(act Action, seen map[string]struct{}) {
+	if act.ID != "" {
+		seen[act.ID] = struct{}{}
+	}
+	if act.Action == "flow.if" {
+		for _, key := range []string{"then", "else"} {
+			branch, _ := BranchActions(act.Payload[key])
+			for _, sub := range branch {
+				markProduced(sub, seen)
+			}
+		}
+	}
+}
+
 /*
 LoadExecutionPlansFromFile loads one or many plans from a JSON file and always
 returns a slice. It supports these shapes:
@@ -243,14 +344,36 @@ func ValidatePlan(plan *ExecutionPlan) error {
 			if action.ID == "" {
 				return fmt.Errorf("action missing id")
 			}
-			if _, ok := seen[action.ID]; ok {
-				return fmt.Errorf("duplicate action id '%s' in plan", action.ID)
-			}
-			seen[action.ID] = struct{}{}
 			if err := registry.ValidateAction(&action); err != nil {
 				return err
 			}
+			ids := map[string]struct{}{}
+			markProduced(action, ids)
+			for id := range ids {
+				if _, ok := seen[id]; ok {
+					return fmt.Errorf("duplicate action id '%s' in plan", id)
+				}
+				seen[id] = struct{}{}
+			}
 		}
 	}
+	if err := validateOutputs(plan); err != nil {
+		return err
+	}
 	return validateStageDependencies(plan)
 }
+
+// Declared outputs may point at results of earlier plans of the mission, so
+// only their form is checked.
+func validateOutputs(plan *ExecutionPlan) error {
+	for name, ref := range plan.Meta.Outputs {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("meta.outputs: empty output name")
+		}
+		ref = strings.TrimSpace(ref)
+		if condRefRe.FindString(ref) != ref {
+			return fmt.Errorf("meta.outputs.%s: want a single @results.<id>.<key> reference, got %q", name, ref)
+		}
+	}
+	return nil
+}
@@ -24,7 +24,8 @@ OUTPUT SHAPE (not a schema; just the shape):
   "meta": {
     "plan_type": "<string>",            // e.g., "exploration", "extraction", "refinement"
     "replan": <bool>,                   // true if a follow-up plan is required
-    "handoff_path": "<tmp/... or empty>"
+    "handoff_path": "<tmp/... or empty>",
+    "outputs": { "<name>": "@results.<id>.<key>" } // only when the goal lists DECLARED OUTPUTS
   },
   "plan": [
     { "stage": <int>, "actions": [
@@ -62,13 +63,30 @@ ACTION USAGE RULES
 - NETWORK I/O:
   - Single URL -> "web.request".
   - Many URLs -> "flow.foreach" with template.action="web.request".
+  - Listing/directory sites with several pages (pagination, profile pages) -> "web.crawl" with include patterns instead of chains of web.request + html.links + flow.foreach.
+  - Following "next page" links of ONE listing -> "flow.paginate" (url, optional next_selector, max_pages) instead of re-planning once per page; use its pages_json.
+  - Repeating an action until a condition holds (cursor/offset APIs, "load more") -> "flow.while" with {{prev.<key>}} in template.payload and "until" (e.g. "empty(prev.next_cursor)") plus "max_iterations".
+  - News/blog sites -> prefer their RSS/Atom feed or sitemap ("feed.parse", "feed.sitemap") over scraping front pages with html.links.
+  - Logins / multi-step forms -> "web.request" with "form" or "json" and the SAME "session" name on every related request.
+  - Files (PDF, images, archives, anything large or binary) -> "web.download" to a path; never "web.request".
+  - PDF / Word documents -> "web.download", then "doc.pdf_text" / "doc.docx_text" with the downloaded "path"; pass their "text" to llm.* actions (use "max_chars" for long files).
 - HTML PARSING:
   - Use "html.links" to extract all <a> links (returns an array of {text,url}). Always provide "base_url" so relative hrefs resolve.
   - "html.select_all" returns an array of OUTER HTML STRINGS (NOT objects). Do NOT pipe that into list.pluck.
     If you need hrefs/URLs, prefer "html.links" + list.pluck(field="url").
+  - Before sending a page to an llm.* action, shrink it with "html.main_content" (articles) or "html.to_markdown"; do NOT pass raw HTML or html.inner_text of a whole page.
+  - Tabular pages (staff directories, price lists, schedules) -> "html.table" instead of html.select_all + llm.extract_structured.
+  - Repeated records with a clear structure (cards, result lists) -> "html.extract" with a row "selector" and "fields" map (e.g. {"name":"h3 a@text","url":"h3 a@href"}) instead of select_all + flow.foreach + llm.extract_structured.
+- JSON RESHAPING:
+  - Rename/filter/reshape JSON outputs with "json.query" (jq-style or JSONPath) instead of an llm.* call; combine results from several pages with "json.merge" (arrays: "concat").
+  - Check extracted data with "json.validate" before persisting it when a schema is known.
+- TEXT:
+  - Pull emails/phones/IDs out of fetched content with "text.regex_find_all" rather than an llm.* call when a pattern is obvious.
+  - Assemble final reports from several @results with "text.template" (Go text/template; pass each input as its own payload key), then "system.write_file_atomic".
 - LIST DISCIPLINE:
   - If you have an array of OBJECTS and need a field -> "list.pluck(field=...)" first to get an array of STRINGS.
-  - Operations like "url.normalize", "list.unique", "list.concat", and "flow.foreach.items_json" expect arrays of STRINGS.
+  - "url.normalize" and "flow.foreach.items_json" expect arrays of STRINGS; other list.* operations keep element types.
+  - Filter/sort/dedupe/group arrays of objects with "list.filter", "list.sort", "list.unique(field=...)", "list.group_by" instead of an llm.* call.
   - Never mix arrays of objects and arrays of strings.
 - URL RESOLUTION: Provide "base_url" for "html.links" and "url.normalize".
 - FILES: All temp/evidence under "tmp/"; final outputs with correct extension.
@@ -86,12 +104,42 @@ Use EXACTLY this shape for foreach:
   }
 }
 Do NOT put "action" at the top-level payload; it MUST be inside template.
+Optional foreach payload keys (top level, next to items_json): "concurrency" (lower it for fragile sites), "retries" (flaky networks), "on_error" ("fail_fast" when every item is required, "20%" to tolerate a few failures), "preserve_order": true when results must line up with items_json, "include_item": true to keep each source item next to its result.
+Several steps per item (fetch -> extract -> llm) -> ONE foreach whose template is a mini-plan instead of several foreach passes:
+  "template": { "plan": [
+      { "stage": 1, "actions": [ { "id": "page", "action": "web.request", "payload": { "url": "{{item}}" } } ] },
+      { "stage": 2, "actions": [ { "id": "text", "action": "html.main_content", "payload": { "html": "@results.page.content" } } ] }
+    ], "output": "text" }
+  Inside the mini-plan @results.<id> refers to the same item's actions (and to earlier mission stages); "when" may use item.<field>.
+
+CONDITIONS ("when" AND FLOW.IF)
+- Any action may carry "when": "<expression>" next to "id"; if it evaluates false the action is SKIPPED (not failed), and later actions that use its @results are skipped too unless they have their own "when".
+- Expressions: "@results.fetch.status_code == 200", "len(@results.links.links_json) > 0", "contains(@results.page.content, \"Next\")", combined with && || ! and parentheses. Also: empty(x), exists(x), starts_with, ends_with, matches(x, "regex"), lower(x).
+- Guard follow-up stages instead of running them on empty input (e.g. skip pagination when html.links found nothing).
+- Two alternative paths -> "flow.if" with "condition", "then": [actions], "else": [actions]; branch actions use the same {id, action, payload} shape and their IDs must be unique in the plan.
+
+EXECUTION SETTINGS (optional, next to "id")
+- "timeout_ms": per-attempt timeout for slow actions (large downloads, long llm calls).
+- "retries" (max 5) and "backoff_ms" (milliseconds, e.g. 2000; the canonical name, "backoff": "2s" is read as the same setting): retry flaky network actions in place instead of failing the mission.
+- "continue_on_error": true for optional enrichments whose failure should not stop the mission; later actions using their @results are skipped.
+- system.* file/folder changes are undone automatically if the mission fails; for writes that replace very large files (over 32 MiB per action) add "undo": false to the payload. For other side effects (POST/PUT requests, uploads) add "compensate": {"action": ..., "payload": ...} that undoes them (may use the action's own @results), or "on_failure" for cleanup when the action itself fails.
+
+SUB-MISSIONS
+- A big goal made of independent sub-goals ("research these 10 products") -> "flow.mission" per sub-goal (usually as a flow.foreach template with a low "concurrency"); each plans and runs on its own. Do not use it for small steps a few actions can do.
+- Give the sub-mission a self-contained "goal" and list the values you need in "outputs_json" (e.g. ["summary","price"]); read them as @results.<id>.summary (inside flow.foreach via results_json).
+- If YOUR goal ends with "DECLARED OUTPUTS: a, b", set meta.outputs {"a": "@results.<id>.<key>", ...} in the plan that finishes the work (with replan, in the final plan).
+
+ASKING THE USER
+- Use "ask.user" only for decisions you cannot make from the goal or the data (which of several found products to order, which account to log in with); otherwise decide yourself.
+- Prefer "kind": "choice" with "choices_json" from @results, or "yes_no" before an irreversible step; give a sensible "default" so the mission continues if nobody answers. Use @results.<id>.answer / choice_json / confirmed afterwards (e.g. in "when").
 
 IDS
 - Action IDs must be short, unique, lowercase. Never reuse a prior action ID; refer to old outputs via @results.
 
 FINAL OUTPUTS
 - Persist final deliverables with "system.write_file_atomic" using correct extension.
+- Several deliverables or "give me everything as one file" -> "archive.zip" (or "archive.tar_gz") with inputs_json globs such as ["out/*", "tmp/**/*.json"]; use "system.glob" to find files instead of system.list_directory when you need paths by pattern.
+- If the user wants a spreadsheet/table, convert the array of objects with "format.to_csv" (".csv") or "format.to_markdown_table" (".md") before writing; use "format.to_jsonl" for ".jsonl".
 - Keep JSON outputs compact (no unnecessary prose).
 
 AVAILABLE ACTIONS & PAYLOADS:
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	MaxActionRetries = 5
+	MaxActionTimeout = time.Hour
+	DefaultBackoff   = time.Second
+	maxBackoff       = 5 * time.Minute
+)
+
+// Timeout returns the per-attempt timeout: the action's timeout_ms, else the
+// registry's default_timeout_ms, else fallback.
+func (a *Action) Timeout(fallback time.Duration) time.Duration {
+	if a.TimeoutMs > 0 {
+		return time.Duration(a.TimeoutMs) * time.Millisecond
+	}
+	if def, ok := GetActionDefinition(a.Action); ok && def.DefaultTimeoutMs > 0 {
+		return time.Duration(def.DefaultTimeoutMs) * time.Millisecond
+	}
+	return fallback
+}
+
+// BackoffDuration is the wait before the first retry (DefaultBackoff when
+// backoff_ms is unset).
+func (a *Action) BackoffDuration() time.Duration {
+	if a.BackoffMs > 0 {
+		return time.Duration(a.BackoffMs) * time.Millisecond
+	}
+	return DefaultBackoff
+}
+
+// UnmarshalJSON also accepts "backoff" for backoff_ms (the canonical name):
+// a duration such as "2s" or a number of milliseconds. A malformed value is
+// an error rather than being dropped.
+func (a *Action) UnmarshalJSON(b []byte) error {
+	type plain Action
+	aux := struct {
+		*plain
+		Backoff any `json:"backoff"`
+	}{plain: (*plain)(a)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	if aux.Backoff == nil {
+		return nil
+	}
+	var ms int
+	switch v := aux.Backoff.(type) {
+	case string:
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("action '%s': backoff must be a duration like \"2s\" (or use backoff_ms), got %q", a.ID, v)
+		}
+		ms = int(d.Milliseconds())
+	case float64:
+		ms = int(v)
+	default:
+		return fmt.Errorf("action '%s': backoff must be a duration like \"2s\" (or use backoff_ms)", a.ID)
+	}
+	if a.BackoffMs != 0 && a.BackoffMs != ms {
+		return fmt.Errorf("action '%s': set either backoff_ms or backoff, not both", a.ID)
+	}
+	a.BackoffMs = ms
+	return nil
+}
+
+func validatePolicy(a *Action) error {
+	if a.TimeoutMs < 0 || time.Duration(a.TimeoutMs)*time.Millisecond > MaxActionTimeout {
+		return fmt.Errorf("action '%s': timeout_ms must be between 0 and %d", a.ID, MaxActionTimeout.Milliseconds())
+	}
+	if a.Retries < 0 || a.Retries > MaxActionRetries {
+		return fmt.Errorf("action '%s': retries must be between 0 and %d", a.ID, MaxActionRetries)
+	}
+	if a.BackoffMs < 0 || time.Duration(a.BackoffMs)*time.Millisecond > maxBackoff {
+		return fmt.Errorf("action '%s': backoff_ms must be between 0 and %d", a.ID, maxBackoff.Milliseconds())
+	}
+	return nil
+}
+
+// Compensations are single actions: they cannot declare their own.
+func validateCompensations(r *ActionRegistry, a *Action) error {
+	for key, c := range map[string]*Action{"compensate": a.Compensate, "on_failure": a.OnFailure} {
+		if c == nil {
+			continue
+		}
+		if c.Compensate != nil || c.OnFailure != nil {
+			return fmt.Errorf("action '%s': %s cannot declare its own compensate/on_failure", a.ID, key)
+		}
+		if c.When != "" || c.ContinueOnError {
+			return fmt.Errorf("action '%s': %s does not support when or continue_on_error", a.ID, key)
+		}
+		if err := r.ValidateAction(c); err != nil {
+			return fmt.Errorf("action '%s': %s: %w", a.ID, key, err)
+		}
+	}
+	return nil
+}
@@ -61,6 +61,13 @@ func (r *ActionRegistry) ValidateAction(action *Action) error {
 		return fmt.Errorf("action '%s' is not defined in the registry", action.Action)
 	}
 
+	if err := validatePolicy(action); err != nil {
+		return err
+	}
+	if err := validateCompensations(r, action); err != nil {
+		return err
+	}
+
 	for _, requiredKey := range def.PayloadSchema.Required {
 		if _, ok := action.Payload[requiredKey]; !ok {
 			return fmt.Errorf("action '%s' is missing required payload key: '%s'", action.Action, requiredKey)
@@ -72,13 +79,87 @@ func (r *ActionRegistry) ValidateAction(action *Action) error {
 		if !ok {
 			return fmt.Errorf("flow.foreach: payload.template must be an object")
 		}
-		if _, ok := tpl["action"].(string); !ok {
+		stages, isPlan, err := TemplatePlan(tpl)
+		if err != nil {
+			return fmt.Errorf("flow.foreach: %w", err)
+		}
+		if isPlan {
+			ids := map[string]struct{}{}
+			for _, st := range stages {
+				for i := range st.Actions {
+					sub := &st.Actions[i]
+					if _, dup := ids[sub.ID]; dup {
+						return fmt.Errorf("flow.foreach: duplicate action id '%s' in template", sub.ID)
+					}
+					ids[sub.ID] = struct{}{}
+					if err := r.ValidateAction(sub); err != nil {
+						return fmt.Errorf("flow.foreach: template: %w", err)
+					}
+				}
+			}
+			if out, _ := tpl["output"].(string); out != "" {
+				if _, ok := ids[out]; !ok {
+					return fmt.Errorf("flow.foreach: template.output '%s' is not an action of the template", out)
+				}
+			}
+		} else if _, ok := tpl["action"].(string); !ok {
 			return fmt.Errorf("flow.foreach: template.action (string) is required")
 		}
-		if _, ok := tpl["payload"].(map[string]any); !ok {
+		if _, ok := tpl["payload"].(map[string]any); !ok && !isPlan {
 			return fmt.Errorf("flow.foreach: template.payload (object) is required")
 		}
 	}
+
+	if action.Action == "flow.while" {
+		tpl, ok := action.Payload["template"].(map[string]any)
+		if !ok {
+			return fmt.Errorf("flow.while: payload.template must be an object")
+		}
+		inner, _ := tpl["action"].(string)
+		if _, found := r.GetDefinition(inner); !found {
+			return fmt.Errorf("flow.while: template.action '%s' is not defined in the registry", inner)
+		}
+		if _, ok := tpl["payload"].(map[string]any); !ok {
+			return fmt.Errorf("flow.while: template.payload (object) is required")
+		}
+	}
+	if action.Action == "flow.while" || action.Action == "flow.paginate" {
+		for _, key := range []string{"until", "while"} {
+			if src, ok := action.Payload[key].(string); ok && src != "" {
+				if _, err := ParseCondition(src); err != nil {
+					return fmt.Errorf("%s: %s: %w", action.Action, key, err)
+				}
+			}
+		}
+	}
+
+	// Guards with {{item}} placeholders are checked once filled in per item
+	if action.When != "" && !strings.Contains(action.When, "{{") {
+		if _, err := ParseCondition(action.When); err != nil {
+			return fmt.Errorf("action '%s' has an invalid when: %w", action.ID, err)
+		}
+	}
+
+	if action.Action == "flow.if" {
+		cond, ok := action.Payload["condition"].(string)
+		if !ok {
+			return fmt.Errorf("flow.if: payload.condition must be a string")
+		}
+		if _, err := ParseCondition(cond); err != nil {
+			return fmt.Errorf("flow.if: %w", err)
+		}
+		for _, key := range []string{"then", "else"} {
+			branch, err := BranchActions(action.Payload[key])
+			if err != nil {
+				return fmt.Errorf("flow.if: %s: %w", key, err)
+			}
+			for i := range branch {
+				if err := r.ValidateAction(&branch[i]); err != nil {
+					return fmt.Errorf("flow.if: %s: %w", key, err)
+				}
+			}
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var resultsSubstRe = regexp.MustCompile(`@results\.([A-Za-z0-9_\-]+)\.([A-Za-z0-9_]+)`)
+
+// ResolvePayload replaces @results.<id>.<key> in top-level string values with
+// the referenced output (formatted with %v); unknown references become "".
+// Keys listed in raw are copied untouched.
+func ResolvePayload(payload map[string]any, snap map[string]map[string]any, raw ...string) map[string]any {
+	resolved := make(map[string]any, len(payload))
+
+	for key, val := range payload {
+		str, ok := val.(string)
+		if !ok || contains(raw, key) {
+			resolved[key] = val
+			continue
+		}
+
+		out := resultsSubstRe.ReplaceAllStringFunc(str, func(match string) string {
+			sub := resultsSubstRe.FindStringSubmatch(match)
+			if len(sub) != 3 {
+				return ""
+			}
+			actionID, outKey := sub[1], sub[2]
+			if m, ok := snap[actionID]; ok {
+				if v, ok := m[outKey]; ok {
+					return fmt.Sprintf("%v", v)
+				}
+			}
+			return ""
+		})
+		resolved[key] = out
+	}
+	return resolved
+}
+
+// ResultRefs lists the action IDs referenced anywhere in v (strings, nested
+// objects and arrays).
+func ResultRefs(v any) []string {
+	var ids []string
+	var walk func(any)
+	walk = func(v any) {
+		switch t := v.(type) {
+		case map[string]any:
+			for _, vv := range t {
+				walk(vv)
+			}
+		case []any:
+			for _, vv := range t {
+				walk(vv)
+			}
+		case string:
+			for _, m := range resultsRefRe.FindAllStringSubmatch(t, -1) {
+				ids = append(ids, m[1])
+			}
+		}
+	}
+	walk(v)
+	return ids
+}
+
+// LookupResult returns the value of a single reference
+// "@results.<id>.<key>[.<path>]" (the path reaches into *_json outputs).
+func LookupResult(snap map[string]map[string]any, ref string) (any, bool) {
+	ref = strings.TrimSpace(ref)
+	if condRefRe.FindString(ref) != ref {
+		return nil, false
+	}
+	v := lookupRef(snap, strings.Split(strings.TrimPrefix(ref, "@results."), "."))
+	return v, v != nil
+}
+
+// RawPayloadKeys names payload keys the executor must not substitute because
+// the action evaluates them itself.
+func RawPayloadKeys(action string) []string {
+	switch action {
+	case "flow.if":
+		return []string{"condition"}
+	case "flow.while", "flow.paginate":
+		return []string{"until", "while"}
+	}
+	return nil
+}
+
+// BranchActions decodes a flow.if branch: a JSON array (or array string) of
+// {id, action, payload, when} objects. A missing branch is empty.
+func BranchActions(v any) ([]Action, error) {
+	if v == nil {
+		return nil, nil
+	}
+	var raw []byte
+	switch t := v.(type) {
+	case string:
+		if strings.TrimSpace(t) == "" {
+			return nil, nil
+		}
+		raw = []byte(t)
+	case []any:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		raw = b
+	default:
+		return nil, fmt.Errorf("expected an array of actions, got %T", v)
+	}
+	var acts []Action
+	if err := json.Unmarshal(raw, &acts); err != nil {
+		return nil, fmt.Errorf("expected an array of actions: %w", err)
+	}
+	for i, a := range acts {
+		if strings.TrimSpace(a.ID) == "" || strings.TrimSpace(a.Action) == "" {
+			return nil, fmt.Errorf("action #%d needs an id and an action", i+1)
+		}
+		if a.Payload == nil {
+			acts[i].Payload = map[string]any{}
+		}
+	}
+	return acts, nil
+}
+
+// TemplatePlan returns the stages of a flow.foreach template given as a
+// mini-plan: "plan" (an array of {stage, actions}) or "actions" (run one
+// after another). ok is false for a single-action template.
+func TemplatePlan(tpl map[string]any) (stages []ExecutionStage, ok bool, err error) {
+	if raw, has := tpl["plan"]; has {
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return nil, true, err
+		}
+		if s, isStr := raw.(string); isStr {
+			b = []byte(s)
+		}
+		if err := json.Unmarshal(b, &stages); err != nil {
+			return nil, true, fmt.Errorf("template.plan must be an array of stages: %w", err)
+		}
+		if len(stages) == 0 {
+			return nil, true, fmt.Errorf("template.plan has no stages")
+		}
+		for si := range stages {
+			for ai, a := range stages[si].Actions {
+				if strings.TrimSpace(a.ID) == "" || strings.TrimSpace(a.Action) == "" {
+					return nil, true, fmt.Errorf("template.plan stage %d action #%d needs an id and an action", si+1, ai+1)
+				}
+				if a.Payload == nil {
+					stages[si].Actions[ai].Payload = map[string]any{}
+				}
+			}
+		}
+		return stages, true, nil
+	}
+	if raw, has := tpl["actions"]; has {
+		acts, err := BranchActions(raw)
+		if err != nil {
+			return nil, true, fmt.Errorf("template.actions: %w", err)
+		}
+		if len(acts) == 0 {
+			return nil, true, fmt.Errorf("template.actions is empty")
+		}
+		for i, a := range acts {
+			stages = append(stages, ExecutionStage{Stage: i + 1, Actions: []Action{a}})
+		}
+		return stages, true, nil
+	}
+	return nil, false, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SkipReason decides whether a should be skipped. With a when guard the guard
+// alone decides; without one, the action is skipped when it references an
+// action that was itself skipped or failed under continue_on_error
+// (skippedAmong returns that ID, or "").
+func SkipReason(a *Action, snap map[string]map[string]any, skippedAmong func([]string) string) (string, error) {
+	if strings.TrimSpace(a.When) != "" {
+		cond, err := ParseCondition(a.When)
+		if err != nil {
+			return "", err
+		}
+		ok, err := cond.Eval(snap)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return fmt.Sprintf("when %q is false", a.When), nil
+		}
+		return "", nil
+	}
+	if id := skippedAmong(ResultRefs(a.Payload)); id != "" {
+		return fmt.Sprintf("depends on action '%s', which did not produce results", id), nil
+	}
+	return "", nil
+}
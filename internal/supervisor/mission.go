@@ -3,7 +3,9 @@ package supervisor
 import (
 	"sync"
 
+	"a-a/internal/metrics"
 	"a-a/internal/parser"
+	"a-a/internal/utils"
 )
 
 const (
@@ -27,4 +29,33 @@ type Mission struct {
 	Results             map[string]map[string]any
 	ResultsMu           sync.Mutex
 	LastStage           int
+
+	// Sub-missions (flow.mission)
+	ParentID   string
+	Depth      int // 0 for missions submitted by the user
+	childrenMu sync.Mutex
+	children   []string
+	undoInto   *utils.Journal // receives the undos of a succeeded child, so the parent can roll it back
+}
+
+func (m *Mission) addChild(id string) {
+	m.childrenMu.Lock()
+	m.children = append(m.children, id)
+	m.childrenMu.Unlock()
+}
+
+// Builds the mission's result; errMsg is empty on success.
+func (m *Mission) result(finalPlan string, overall *metrics.MissionMetrics, errMsg string) MissionResult {
+	m.childrenMu.Lock()
+	children := append([]string(nil), m.children...)
+	m.childrenMu.Unlock()
+	return MissionResult{
+		MissionID:    m.ID,
+		ParentID:     m.ParentID,
+		Children:     children,
+		OriginalGoal: m.OriginalGoal,
+		FinalPlan:    finalPlan,
+		Error:        errMsg,
+		Metrics:      overall,
+	}
 }
@@ -0,0 +1,60 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"a-a/internal/utils"
+)
+
+// Questions waiting for an answer, by question ID.
+var (
+	questionsMu sync.Mutex
+	questions   = map[string]chan string{}
+)
+
+// AnswerQuestion delivers the user's answer to a waiting ask.user action.
+// It fails when the question is no longer waiting (answered, timed out or
+// its mission ended).
+func AnswerQuestion(id, answer string) error {
+	questionsMu.Lock()
+	ch, ok := questions[id]
+	delete(questions, id)
+	questionsMu.Unlock()
+	if !ok {
+		return fmt.Errorf("question %s is no longer waiting for an answer", id)
+	}
+	ch <- answer // buffered; the asker reads it or has gone
+	return nil
+}
+
+// Routes ask.user questions of mission m to the REPL and waits for the answer.
+func askerFor(m *Mission) utils.Asker {
+	return func(ctx context.Context, question utils.Question) (string, error) {
+		q := UserQuestion{ID: uuid.New().String()[:8], MissionID: m.ID, Question: question}
+		ch := make(chan string, 1)
+		questionsMu.Lock()
+		questions[q.ID] = ch
+		questionsMu.Unlock()
+		defer func() {
+			questionsMu.Lock()
+			delete(questions, q.ID)
+			questionsMu.Unlock()
+		}()
+
+		select {
+		case QuestionChannel <- q:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		select {
+		case ans := <-ch:
+			return ans, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
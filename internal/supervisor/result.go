@@ -1,18 +1,26 @@
 package supervisor
 
-import "a-a/internal/metrics"
+import (
+	"a-a/internal/metrics"
+	"a-a/internal/utils"
+)
 
 type MissionResult struct {
 	MissionID    string                  `json:"mission_id"`
+	ParentID     string                  `json:"parent_id,omitempty"` // set for sub-missions (flow.mission)
+	Children     []string                `json:"children,omitempty"`  // sub-missions started by this mission
 	OriginalGoal string                  `json:"original_goal"`
 	FinalPlan    string                  `json:"final_plan"`
+	Outputs      map[string]any          `json:"outputs,omitempty"` // declared outputs (meta.outputs), on success
 	Error        string                  `json:"error,omitempty"`
 	Metrics      *metrics.MissionMetrics `json:"metrics,omitempty"`
 }
 
 type PlanPreview struct {
 	MissionID string `json:"mission_id"`
+	ParentID  string `json:"parent_id,omitempty"` // set for plans of sub-missions
 	PlanJSON  string `json:"plan_json"`
+	DryRun    string `json:"dry_run,omitempty"` // side-effect report shown with the preview
 }
 
 type PlanApproval struct {
@@ -20,8 +28,26 @@ type PlanApproval struct {
 	Approved  bool   `json:"approved"`
 }
 
+// MissionProgress reports how far a long-running action (flow.foreach) got.
+type MissionProgress struct {
+	MissionID string
+	metrics.Progress
+}
+
+// UserQuestion is an ask.user question of a running mission, answered with
+// AnswerQuestion(ID, ...).
+type UserQuestion struct {
+	ID        string
+	MissionID string
+	utils.Question
+}
+
 var PlanPreviewChannel = make(chan PlanPreview, 16)
 var PlanApprovalChannel = make(chan PlanApproval, 16)
 
+var ProgressChannel = make(chan MissionProgress, 16)
+
+var QuestionChannel = make(chan UserQuestion, 16)
+
 // Global channel for all mission results.
 var ResultChannel = make(chan MissionResult, 100)
@@ -0,0 +1,98 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"a-a/internal/logger"
+	"a-a/internal/parser"
+	"a-a/internal/utils"
+)
+
+const maxMissionDepth = 3 // user mission -> child -> grandchild -> great-grandchild
+
+// Starts flow.mission children of parent. A child does not go through the
+// queue (its parent holds the only worker): it runs on the calling action's
+// goroutine, with a context that is cancelled together with the action.
+func spawnerFor(parent *Mission) utils.MissionSpawner {
+	return func(ctx context.Context, req utils.SubMission) (utils.SubMissionResult, error) {
+		if parent.Depth >= maxMissionDepth {
+			return utils.SubMissionResult{}, fmt.Errorf("sub-missions nested more than %d levels deep", maxMissionDepth)
+		}
+		child := newMission(subMissionGoal(req), nil, nil, parent.RequireConfirm)
+		child.ParentID = parent.ID
+		child.Depth = parent.Depth + 1
+		child.undoInto = utils.JournalFromContext(ctx)
+		parent.addChild(child.ID)
+		logger.Log.Printf("[Supervisor] Mission %s starts sub-mission '%s' (ID: %s)", parent.ID, req.Goal, child.ID)
+
+		// Only cancellation is inherited; values of the parent's action context
+		// (results, journal, flow depth) must not leak into the child.
+		runCtx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stop := context.AfterFunc(ctx, cancel)
+		defer stop()
+
+		res := startSubMission(runCtx, child)
+		ResultChannel <- res
+		if res.Error != "" {
+			return utils.SubMissionResult{MissionID: child.ID}, fmt.Errorf("sub-mission %s: %s", child.ID, res.Error)
+		}
+		if err := ctx.Err(); err != nil {
+			return utils.SubMissionResult{MissionID: child.ID}, err
+		}
+		return utils.SubMissionResult{MissionID: child.ID, Outputs: res.Outputs}, nil
+	}
+}
+
+// Plans the child's goal, asks for confirmation when needed and runs it.
+func startSubMission(ctx context.Context, m *Mission) MissionResult {
+	planCtx, cancelPlan := context.WithTimeout(ctx, 20*time.Second)
+	plan, err := parser.GeneratePlan(planCtx, nil, m.OriginalGoal)
+	cancelPlan()
+	if err != nil {
+		m.State = StatusFailed
+		if errors.Is(ctx.Err(), context.Canceled) {
+			m.State = StatusCancelled
+		}
+		return m.result("", nil, fmt.Sprintf("planning failed: %v", err))
+	}
+	m.Plan = plan
+	if !confirmNextPlanIfNeeded(ctx, m, plan) {
+		m.State = StatusCancelled
+		b, _ := json.Marshal(plan)
+		return m.result(string(b), nil, "plan rejected by user")
+	}
+	m.State = StatusRunning
+	return runMission(ctx, m)
+}
+
+// The child's goal tells its planner which outputs the parent expects.
+func subMissionGoal(req utils.SubMission) string {
+	if len(req.Outputs) == 0 {
+		return req.Goal
+	}
+	return fmt.Sprintf("%s\n\nDECLARED OUTPUTS: %s\n(set meta.outputs to {\"<name>\": \"@results.<id>.<key>\"} for each of them)",
+		req.Goal, strings.Join(req.Outputs, ", "))
+}
+
+// Resolves the declared outputs against the mission's results; outputs whose
+// reference has no value are left out.
+func resolveOutputs(m *Mission, declared map[string]string) map[string]any {
+	if len(declared) == 0 {
+		return nil
+	}
+	m.ResultsMu.Lock()
+	defer m.ResultsMu.Unlock()
+	out := make(map[string]any, len(declared))
+	for name, ref := range declared {
+		if v, ok := parser.LookupResult(m.Results, ref); ok {
+			out[name] = v
+		}
+	}
+	return out
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/google/uuid"
 
+	"a-a/internal/actions/web"
 	"a-a/internal/display"
 	"a-a/internal/executor"
 	"a-a/internal/logger"
@@ -26,6 +27,9 @@ var missionQueue = make(chan *Mission, 100) // Main work queue
 var curMu sync.Mutex
 var curMission *Mission
 var curCancel context.CancelFunc
+var subCancels = map[string]context.CancelFunc{} // running sub-missions by ID (guarded by curMu)
+
+var confirmMu sync.Mutex
 
 var workerWG sync.WaitGroup
 
@@ -64,7 +68,7 @@ func StartSupervisor() {
 		for mission := range missionQueue {
 			logger.Log.Printf("[Supervisor] Starting mission '%s' (ID: %s)", mission.OriginalGoal, mission.ID)
 			mission.State = StatusRunning
-			runMission(mission)
+			ResultChannel <- runMission(context.Background(), mission)
 		}
 	})
 }
@@ -96,8 +100,19 @@ func StopSupervisor(ctx context.Context) {
 
 // Submit mission for execution
 func SubmitMission(goal string, plan *parser.ExecutionPlan, history []parser.ConversationTurn, requireConfirm bool) (string, error) {
+	m := newMission(goal, plan, history, requireConfirm)
+	enqueueMu.Lock()
+	defer enqueueMu.Unlock()
+	if !accepting {
+		return "", fmt.Errorf("supervisor is stopping; not accepting new missions")
+	}
+	missionQueue <- m
+	return m.ID, nil
+}
+
+func newMission(goal string, plan *parser.ExecutionPlan, history []parser.ConversationTurn, requireConfirm bool) *Mission {
 	id := uuid.New().String()[:8]
-	newMission := &Mission{
+	m := &Mission{
 		ID:                  id,
 		OriginalGoal:        goal,
 		State:               "PENDING",
@@ -112,14 +127,8 @@ func SubmitMission(goal string, plan *parser.ExecutionPlan, history []parser.Con
 		Results:    make(map[string]map[string]any),
 		LastStage:  0,
 	}
-	_ = os.MkdirAll(newMission.ScratchDir, 0o755)
-	enqueueMu.Lock()
-	defer enqueueMu.Unlock()
-	if !accepting {
-		return "", fmt.Errorf("supervisor is stopping; not accepting new missions")
-	}
-	missionQueue <- newMission
-	return id, nil
+	_ = os.MkdirAll(m.ScratchDir, 0o755)
+	return m
 }
 
 // Cancel a specific mission by ID.
@@ -127,6 +136,10 @@ func CancelMission(id string) (bool, error) {
 	curMu.Lock()
 	defer curMu.Unlock()
 
+	if cancel, ok := subCancels[strings.ToLower(id)]; ok {
+		cancel()
+		return true, nil
+	}
 	if curMission == nil || curMission.State != StatusRunning {
 		return false, fmt.Errorf("no mission is currently running")
 	}
@@ -174,14 +187,21 @@ func readAndPersistEvidence(m *Mission, path string) string {
 	return content
 }
 
-func confirmNextPlanIfNeeded(m *Mission, p *parser.ExecutionPlan) bool {
+func confirmNextPlanIfNeeded(ctx context.Context, m *Mission, p *parser.ExecutionPlan) bool {
 	// Require preview if user asked or plan is risky
 	need := m.RequireConfirm || utils.IsPlanRisky(p)
 	if !need {
 		return true
 	}
+	// One preview at a time: the REPL awaits a single approval, and
+	// sub-missions may ask concurrently
+	confirmMu.Lock()
+	defer confirmMu.Unlock()
+
 	b, _ := json.Marshal(p)
-	PlanPreviewChannel <- PlanPreview{MissionID: m.ID, PlanJSON: string(b)}
+	// Simulated against the mission's real results so far
+	effects, dryErr := executor.DryRun(ctx, p, m.Results, &m.ResultsMu)
+	PlanPreviewChannel <- PlanPreview{MissionID: m.ID, ParentID: m.ParentID, PlanJSON: string(b), DryRun: display.FormatSideEffects(effects, dryErr)}
 
 	timer := time.NewTimer(1 * time.Minute)
 	defer timer.Stop()
@@ -196,11 +216,14 @@ func confirmNextPlanIfNeeded(m *Mission, p *parser.ExecutionPlan) bool {
 			return ans.Approved
 		case <-timer.C:
 			return false
+		case <-ctx.Done():
+			return false
 		}
 	}
 }
 
-func runMission(m *Mission) {
+// Runs m until it succeeds, fails or ctx is cancelled and returns its result.
+func runMission(ctx context.Context, m *Mission) MissionResult {
 	var finalPlan string
 	var finalError error
 
@@ -223,21 +246,39 @@ func runMission(m *Mission) {
 	}
 
 	// Wire up cancel for the running mission
-	missionCtx, cancel := context.WithCancel(context.Background())
+	missionCtx, cancel := context.WithCancel(utils.WithMissionID(ctx, m.ID))
+	journal := utils.NewJournal() // undos of the plans that completed
+	missionCtx = utils.WithJournal(missionCtx, journal)
+	missionCtx = utils.WithAsker(missionCtx, askerFor(m))
+	missionCtx = utils.WithSpawner(missionCtx, spawnerFor(m))
+	missionCtx = metrics.WithProgress(missionCtx, func(p metrics.Progress) {
+		select {
+		case ProgressChannel <- MissionProgress{MissionID: m.ID, Progress: p}:
+		default: // Never block actions on a slow REPL
+		}
+	})
 	curMu.Lock()
-	curMission = m
-	curCancel = cancel
+	if m.ParentID == "" {
+		curMission = m
+		curCancel = cancel
+	} else {
+		subCancels[m.ID] = cancel
+	}
 	curMu.Unlock()
 	defer func() {
 		cancel()
+		web.ReleaseSessions(m.ID)
 		curMu.Lock()
 		if curMission != nil && curMission.ID == m.ID {
 			curMission = nil
 			curCancel = nil
 		}
+		delete(subCancels, m.ID)
 		curMu.Unlock()
 	}()
 
+	declared := map[string]string{} // meta.outputs of the plans that completed
+
 	for {
 		var mm *metrics.MissionMetrics
 		var execErr error
@@ -253,9 +294,13 @@ func runMission(m *Mission) {
 			mm, execErr = executor.ExecutePlan(missionCtx, planForExec, m.Results, &m.ResultsMu)
 			if mm != nil {
 				overall.Stages = append(overall.Stages, mm.Stages...)
+				overall.Rollbacks = append(overall.Rollbacks, mm.Rollbacks...)
 			}
 
 			if execErr == nil {
+				for name, ref := range m.Plan.Meta.Outputs {
+					declared[name] = ref
+				}
 				m.LastStage = maxStage(planForExec) // Advance stage cursor
 				break                               // Plan succeeded
 			}
@@ -266,14 +311,8 @@ func runMission(m *Mission) {
 			if errors.Is(execErr, context.Canceled) || strings.Contains(strings.ToLower(execErr.Error()), "cancel") {
 				logger.Log.Printf("Mission '%s' CANCELLED (ID: %s).", m.OriginalGoal, m.ID)
 				m.State = StatusCancelled
-				ResultChannel <- MissionResult{
-					MissionID:    m.ID,
-					OriginalGoal: m.OriginalGoal,
-					FinalPlan:    finalPlan,
-					Metrics:      overall,
-					Error:        execErr.Error(),
-				}
-				return
+				rollBackMission(missionCtx, m, journal, overall)
+				return m.result(finalPlan, overall, execErr.Error())
 			}
 
 			logger.Log.Printf("Mission '%s' FAILED on attempt %d/%d (ID: %s): %v",
@@ -293,16 +332,10 @@ func runMission(m *Mission) {
 			time.Sleep(1 * time.Second) // Naive backoff
 		}
 
-		// If the plan still failed after retries -> emit result & return
+		// If the plan still failed after retries -> return the result
 		if execErr != nil {
-			ResultChannel <- MissionResult{
-				MissionID:    m.ID,
-				OriginalGoal: m.OriginalGoal,
-				FinalPlan:    finalPlan,
-				Metrics:      overall,
-				Error:        finalError.Error(),
-			}
-			return
+			rollBackMission(missionCtx, m, journal, overall)
+			return m.result(finalPlan, overall, finalError.Error())
 		}
 
 		logger.Log.Printf("Plan completed (type=%s replan=%v).", m.Plan.Meta.PlanType, m.Plan.Meta.Replan)
@@ -327,14 +360,8 @@ func runMission(m *Mission) {
 				logger.Log.Printf("Re-plan generation FAILED (mission %s): %v", m.ID, genErr)
 				finalError = fmt.Errorf("replan failed: %w", genErr)
 				m.State = StatusFailed
-				ResultChannel <- MissionResult{
-					MissionID:    m.ID,
-					OriginalGoal: m.OriginalGoal,
-					FinalPlan:    finalPlan,
-					Metrics:      overall,
-					Error:        finalError.Error(),
-				}
-				return
+				rollBackMission(missionCtx, m, journal, overall)
+				return m.result(finalPlan, overall, finalError.Error())
 			}
 
 			// Disallow reusing any existing action IDs (must reference via @results)
@@ -342,14 +369,8 @@ func runMission(m *Mission) {
 				logger.Log.Printf("Re-plan generation FAILED (mission %s): %v", m.ID, err)
 				finalError = fmt.Errorf("replan failed: %w", err)
 				m.State = StatusFailed
-				ResultChannel <- MissionResult{
-					MissionID:    m.ID,
-					OriginalGoal: m.OriginalGoal,
-					FinalPlan:    finalPlan,
-					Metrics:      overall,
-					Error:        finalError.Error(),
-				}
-				return
+				rollBackMission(missionCtx, m, journal, overall)
+				return m.result(finalPlan, overall, finalError.Error())
 			}
 
 			// Log full re-plan for audit
@@ -357,16 +378,10 @@ func runMission(m *Mission) {
 				m.ID, newPlan.Meta.PlanType, newPlan.Meta.Replan, display.FormatPlanFull(newPlan))
 
 			// Preview/confirm next plan (if required). Abort if user rejects.
-			if !confirmNextPlanIfNeeded(m, newPlan) {
+			if !confirmNextPlanIfNeeded(missionCtx, m, newPlan) {
 				m.State = StatusCancelled
-				ResultChannel <- MissionResult{
-					MissionID:    m.ID,
-					OriginalGoal: m.OriginalGoal,
-					FinalPlan:    planJSON(newPlan),
-					Metrics:      overall,
-					Error:        "replan rejected by user",
-				}
-				return
+				rollBackMission(missionCtx, m, journal, overall)
+				return m.result(planJSON(newPlan), overall, "replan rejected by user")
 			}
 
 			// Save new plan to history, switch, and loop again
@@ -384,14 +399,28 @@ func runMission(m *Mission) {
 		// No replan requested -> mission complete
 		m.State = StatusSucceeded
 		overall.Succeeded = true
-		ResultChannel <- MissionResult{
-			MissionID:    m.ID,
-			OriginalGoal: m.OriginalGoal,
-			FinalPlan:    finalPlan,
-			Metrics:      overall,
-		}
+		m.undoInto.Merge(journal, "")
+		res := m.result(finalPlan, overall, "")
+		res.Outputs = resolveOutputs(m, declared)
+		return res
+	}
+}
+
+// Undoes the plans of a failed or cancelled mission that had completed; the
+// failing plan already rolled itself back.
+func rollBackMission(ctx context.Context, m *Mission, journal *utils.Journal, overall *metrics.MissionMetrics) {
+	undos := journal.Take()
+	if len(undos) == 0 {
 		return
 	}
+	logger.Log.Printf("Mission %s: rolling back %d change(s) of completed plans", m.ID, len(undos))
+	report := utils.RollBack(ctx, undos)
+	for _, r := range report {
+		if !r.Success {
+			logger.Log.Printf("Mission %s: rollback of '%s' (%s) failed: %s", m.ID, r.ActionID, r.Description, r.Err)
+		}
+	}
+	overall.Rollbacks = append(overall.Rollbacks, report...)
 }
 
 func renumberStages(p *parser.ExecutionPlan, offset int) *parser.ExecutionPlan {
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// Kinds of questions ask.user can put to the user.
+const (
+	AskText   = "text"
+	AskChoice = "choice"
+	AskYesNo  = "yes_no"
+)
+
+// Question is put to the user by ask.user while its mission waits.
+type Question struct {
+	Prompt  string        `json:"prompt"`
+	Kind    string        `json:"kind"`
+	Choices []string      `json:"choices,omitempty"` // labels for AskChoice
+	Default string        `json:"default,omitempty"` // used when the user does not answer in time
+	Timeout time.Duration `json:"timeout"`
+}
+
+// Asker delivers q to the user and waits for the reply until ctx is done.
+type Asker func(ctx context.Context, q Question) (string, error)
+
+type askerKey struct{}
+
+// WithAsker registers how actions of the mission reach the user.
+func WithAsker(ctx context.Context, a Asker) context.Context {
+	return context.WithValue(ctx, askerKey{}, a)
+}
+
+// AskerFromContext returns the function set by WithAsker, or nil.
+func AskerFromContext(ctx context.Context) Asker {
+	a, _ := ctx.Value(askerKey{}).(Asker)
+	return a
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"a-a/internal/parser"
+)
+
+// Kinds of side effects a dry run reports.
+const (
+	EffectCreate    = "create"    // new file or folder
+	EffectOverwrite = "overwrite" // existing file replaced or truncated
+	EffectAppend    = "append"    // existing file extended
+	EffectDelete    = "delete"    // existing file or folder removed
+	EffectWrite     = "write"     // path only known at run time
+	EffectNetwork   = "network"   // requests to a host
+	EffectLLM       = "llm"       // model call
+)
+
+// Effect is one side effect an action would have, found by a dry run.
+type Effect struct {
+	ActionID string `json:"action_id"`
+	Action   string `json:"action"`
+	Kind     string `json:"kind"`
+	Target   string `json:"target"` // path, host or model
+	Detail   string `json:"detail,omitempty"`
+	Tokens   int    `json:"tokens,omitempty"`   // estimated prompt tokens (llm)
+	When     string `json:"when,omitempty"`     // only if this guard holds
+	Repeated string `json:"repeated,omitempty"` // e.g. "per item", "per page (max 10)"
+}
+
+// DryRunReport collects the effects of a simulated plan.
+type DryRunReport struct {
+	mu      sync.Mutex
+	effects []Effect
+}
+
+func NewDryRunReport() *DryRunReport {
+	return &DryRunReport{}
+}
+
+// Add records effects.
+func (r *DryRunReport) Add(effects ...Effect) {
+	r.mu.Lock()
+	r.effects = append(r.effects, effects...)
+	r.mu.Unlock()
+}
+
+// Effects returns the recorded effects.
+func (r *DryRunReport) Effects() []Effect {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Effect, len(r.effects))
+	copy(out, r.effects)
+	return out
+}
+
+type dryRunKey struct{}
+
+// WithDryRun switches the executor to simulation: actions report their
+// effects to r instead of running.
+func WithDryRun(ctx context.Context, r *DryRunReport) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, r)
+}
+
+// DryRunFromContext returns the report set by WithDryRun, or nil.
+func DryRunFromContext(ctx context.Context) *DryRunReport {
+	r, _ := ctx.Value(dryRunKey{}).(*DryRunReport)
+	return r
+}
+
+// FileEffect describes writing path, checked against the real filesystem.
+// appending is true for writers that extend an existing file.
+func FileEffect(path string, appending bool) Effect {
+	if parser.HasPlaceholder(path) {
+		return Effect{Kind: EffectWrite, Target: path, Detail: "path known at run time"}
+	}
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return Effect{Kind: EffectCreate, Target: path}
+	case err != nil:
+		return Effect{Kind: EffectWrite, Target: path, Detail: err.Error()}
+	case info.IsDir():
+		return Effect{Kind: EffectWrite, Target: path, Detail: "is a folder; the action would fail"}
+	case appending:
+		return Effect{Kind: EffectAppend, Target: path, Detail: fmt.Sprintf("%d bytes now", info.Size())}
+	default:
+		return Effect{Kind: EffectOverwrite, Target: path, Detail: fmt.Sprintf("%d bytes now", info.Size())}
+	}
+}
+
+// DeleteEffect describes removing path (a file, or a folder and its
+// contents); nil when there is nothing to remove.
+func DeleteEffect(path string) *Effect {
+	if parser.HasPlaceholder(path) {
+		return &Effect{Kind: EffectDelete, Target: path, Detail: "path known at run time"}
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+	if !info.IsDir() {
+		return &Effect{Kind: EffectDelete, Target: path, Detail: fmt.Sprintf("%d bytes", info.Size())}
+	}
+	files, size := 0, int64(0)
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files++
+			if fi, err := d.Info(); err == nil {
+				size += fi.Size()
+			}
+		}
+		return nil
+	})
+	return &Effect{Kind: EffectDelete, Target: path, Detail: fmt.Sprintf("folder, %d files, %d bytes", files, size)}
+}
+
+// NetworkEffect describes a request to rawURL's host.
+func NetworkEffect(rawURL, detail string) Effect {
+	host := "host known at run time"
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" && !parser.HasPlaceholder(u.Host) {
+		host = u.Host
+	}
+	return Effect{Kind: EffectNetwork, Target: host, Detail: detail}
+}
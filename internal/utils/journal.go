@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"a-a/internal/metrics"
+	"a-a/internal/parser"
+)
+
+// Default per-attempt timeout of compensation actions.
+const undoTimeout = 30 * time.Second
+
+// Undo reverts one side effect of a mission.
+type Undo struct {
+	ActionID    string // action whose effect is reverted
+	Description string
+	Run         func(ctx context.Context) error
+}
+
+// Journal collects the undos of a mission in the order their effects
+// happened. A nil *Journal ignores everything, so actions can record
+// unconditionally.
+type Journal struct {
+	mu    sync.Mutex
+	undos []Undo
+	kept  int64 // bytes of snapshots reserved by the undos
+}
+
+func NewJournal() *Journal {
+	return &Journal{}
+}
+
+// Add records an undo.
+func (j *Journal) Add(u Undo) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	j.undos = append(j.undos, u)
+	j.mu.Unlock()
+}
+
+// Merge moves the undos of other into j; entries without an action ID are
+// attributed to actionID.
+func (j *Journal) Merge(other *Journal, actionID string) {
+	for _, u := range other.Take() {
+		if u.ActionID == "" {
+			u.ActionID = actionID
+		}
+		j.Add(u)
+	}
+}
+
+// Reserve counts n bytes of snapshot kept in memory for an undo against
+// limit; when they do not fit it reports false and counts nothing.
+func (j *Journal) Reserve(n, limit int64) bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.kept+n > limit {
+		return false
+	}
+	j.kept += n
+	return true
+}
+
+// Take returns the recorded undos and empties the journal.
+func (j *Journal) Take() []Undo {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	undos := j.undos
+	j.undos = nil
+	return undos
+}
+
+type journalKey struct{}
+
+// WithJournal attaches the journal that actions record their undos in; nil
+// turns recording off (used while rolling back).
+func WithJournal(ctx context.Context, j *Journal) context.Context {
+	return context.WithValue(ctx, journalKey{}, j)
+}
+
+// JournalFromContext returns the journal set by WithJournal, or nil.
+func JournalFromContext(ctx context.Context) *Journal {
+	j, _ := ctx.Value(journalKey{}).(*Journal)
+	return j
+}
+
+// Compensation returns the undo running a's declared compensate action, or
+// its on_failure action when the action failed. The payload is resolved
+// against snap now, so it can use the action's own @results; exec runs it
+// under the compensation's own timeout/retry settings.
+func Compensation(a *parser.Action, failed bool, snap map[string]map[string]any, exec func(context.Context, *parser.Action) (map[string]any, error)) (Undo, bool) {
+	decl, kind := a.Compensate, "compensate"
+	if failed {
+		decl, kind = a.OnFailure, "on_failure"
+	}
+	if decl == nil {
+		return Undo{}, false
+	}
+	comp := *decl
+	if comp.ID == "" {
+		comp.ID = a.ID + "." + kind
+	}
+	comp.Payload = parser.ResolvePayload(comp.Payload, snap, parser.RawPayloadKeys(comp.Action)...)
+	return Undo{
+		ActionID:    a.ID,
+		Description: fmt.Sprintf("%s: %s", kind, comp.Action),
+		Run: func(ctx context.Context) error {
+			_, _, err := RunAction(ctx, &comp, undoTimeout, func(c context.Context) (map[string]any, error) {
+				return exec(c, &comp)
+			})
+			return err
+		},
+	}, true
+}
+
+// RollBack runs undos in reverse order and reports each one. It keeps going
+// after a failed undo and ignores cancellation of ctx, which is usually why
+// the mission is being rolled back.
+func RollBack(ctx context.Context, undos []Undo) []metrics.Rollback {
+	ctx = WithJournal(context.WithoutCancel(ctx), nil)
+	report := make([]metrics.Rollback, 0, len(undos))
+	for i := len(undos) - 1; i >= 0; i-- {
+		u := undos[i]
+		start := time.Now()
+		err := runUndo(ctx, u)
+		r := metrics.Rollback{
+			ActionID:    u.ActionID,
+			Description: u.Description,
+			DurationMs:  time.Since(start).Milliseconds(),
+			Success:     err == nil,
+		}
+		if err != nil {
+			r.Err = err.Error()
+		}
+		report = append(report, r)
+	}
+	return report
+}
+
+func runUndo(ctx context.Context, u Undo) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic in undo: %v", rec)
+		}
+	}()
+	return u.Run(ctx)
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+type missionIDKey struct{}
+
+// WithMissionID tags ctx with the ID of the mission it runs under.
+func WithMissionID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, missionIDKey{}, id)
+}
+
+// MissionIDFromContext returns the mission ID set by WithMissionID, or "".
+func MissionIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(missionIDKey{}).(string)
+	return id
+}
+
+// Results is the mission's @results store. The executor shares it with
+// control-flow actions through the context so they can read typed outputs
+// and publish the outputs of the actions they run.
+type Results struct {
+	mu      *sync.Mutex
+	outputs map[string]map[string]any
+	skipped map[string]string // action ID -> reason
+}
+
+// NewResults wraps an existing outputs map guarded by mu.
+func NewResults(outputs map[string]map[string]any, mu *sync.Mutex) *Results {
+	return &Results{mu: mu, outputs: outputs, skipped: map[string]string{}}
+}
+
+// Snapshot returns a shallow copy that is safe to read without the lock.
+func (r *Results) Snapshot() map[string]map[string]any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snap := make(map[string]map[string]any, len(r.outputs))
+	for k, v := range r.outputs {
+		snap[k] = v
+	}
+	return snap
+}
+
+// Set records an action's output.
+func (r *Results) Set(id string, output map[string]any) {
+	r.mu.Lock()
+	r.outputs[id] = output
+	r.mu.Unlock()
+}
+
+// Skip records that an action did not run and why.
+func (r *Results) Skip(id, reason string) {
+	r.mu.Lock()
+	r.skipped[id] = reason
+	r.mu.Unlock()
+}
+
+// SkippedAmong returns the first of ids that was skipped, or "".
+func (r *Results) SkippedAmong(ids []string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := r.skipped[id]; ok {
+			return id
+		}
+	}
+	return ""
+}
+
+type resultsKey struct{}
+
+// WithResults attaches the mission's results store to ctx.
+func WithResults(ctx context.Context, r *Results) context.Context {
+	return context.WithValue(ctx, resultsKey{}, r)
+}
+
+// ResultsFromContext returns the store set by WithResults, or nil.
+func ResultsFromContext(ctx context.Context) *Results {
+	r, _ := ctx.Value(resultsKey{}).(*Results)
+	return r
+}
@@ -15,6 +15,15 @@ func IsPlanRisky(plan *parser.ExecutionPlan) bool {
 			if _, exists := riskyActions[action.Action]; exists {
 				return true
 			}
+			// Compensations run unattended during a rollback
+			for _, c := range []*parser.Action{action.Compensate, action.OnFailure} {
+				if c == nil {
+					continue
+				}
+				if _, exists := riskyActions[c.Action]; exists {
+					return true
+				}
+			}
 		}
 	}
 	return false
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"a-a/internal/parser"
+)
+
+// RunAction calls run under the action's execution policy: each attempt gets
+// its own timeout (act.Timeout(fallback)) and failures are retried
+// act.Retries times with doubling backoff. Returns the attempts made.
+func RunAction(ctx context.Context, act *parser.Action, fallback time.Duration, run func(context.Context) (map[string]any, error)) (map[string]any, int, error) {
+	timeout := act.Timeout(fallback)
+	wait := act.BackoffDuration()
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		out, err := run(attemptCtx)
+		cancel()
+		if err == nil || attempt > act.Retries || ctx.Err() != nil {
+			return out, attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, attempt, err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
@@ -0,0 +1,32 @@
+package utils
+
+import "context"
+
+// SubMission is a goal delegated by flow.mission to a child mission.
+type SubMission struct {
+	Goal    string
+	Outputs []string // output names the child must declare in meta.outputs
+}
+
+// SubMissionResult is what a succeeded child mission hands back.
+type SubMissionResult struct {
+	MissionID string
+	Outputs   map[string]any // declared outputs, resolved against the child's results
+}
+
+// MissionSpawner plans and runs a child mission and waits for it; cancelling
+// ctx cancels the child.
+type MissionSpawner func(ctx context.Context, req SubMission) (SubMissionResult, error)
+
+type spawnerKey struct{}
+
+// WithSpawner registers how actions of the mission start sub-missions.
+func WithSpawner(ctx context.Context, s MissionSpawner) context.Context {
+	return context.WithValue(ctx, spawnerKey{}, s)
+}
+
+// SpawnerFromContext returns the function set by WithSpawner, or nil.
+func SpawnerFromContext(ctx context.Context) MissionSpawner {
+	s, _ := ctx.Value(spawnerKey{}).(MissionSpawner)
+	return s
+}
@@ -0,0 +1,16 @@
+package utils
+
+import "encoding/json"
+
+// ToText renders an action value as plain text: strings as they are, null as
+// "", anything else as compact JSON.
+func ToText(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
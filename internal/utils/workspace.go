@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Workspace is the directory missions read and write relative paths against:
+// the process working directory.
+func Workspace() (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("workspace: %w", err)
+	}
+	return RealPath(wd), nil
+}
+
+// InWorkspace returns the absolute form of p, failing when p (after
+// resolving symlinks of the part that already exists) lies outside the
+// workspace.
+func InWorkspace(p string) (string, error) {
+	ws, err := Workspace()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	if !Within(ws, RealPath(abs)) {
+		return "", fmt.Errorf("path %q is outside the workspace %s", p, ws)
+	}
+	return abs, nil
+}
+
+// Within reports whether target is root or below it; both must be absolute
+// and clean.
+func Within(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// RealPath resolves symlinks in the longest existing prefix of an absolute
+// path and re-appends the rest, so paths that do not exist yet still compare
+// correctly against their real parent directories.
+func RealPath(abs string) string {
+	rest := ""
+	cur := filepath.Clean(abs)
+	for {
+		if resolved, err := filepath.EvalSymlinks(cur); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return abs
+		}
+		rest = filepath.Join(filepath.Base(cur), rest)
+		cur = parent
+	}
+}